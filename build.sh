@@ -4,17 +4,19 @@ set -e
 OUTPUT_DIR="build"
 mkdir -p $OUTPUT_DIR
 
+LDFLAGS="-X gama-client/internal/version.Version=${VERSION:-dev}"
+
 # Windows (64-bit)
-GOOS=windows GOARCH=amd64 go build -o $OUTPUT_DIR/smp-srv-64w.exe ./cmd/srv/
+GOOS=windows GOARCH=amd64 go build -ldflags "$LDFLAGS" -o $OUTPUT_DIR/smp-srv-64w.exe ./cmd/srv/
 
 # Windows (32-bit)
-GOOS=windows GOARCH=386 go build  -o $OUTPUT_DIR/smp-srv-32w.exe ./cmd/srv/
+GOOS=windows GOARCH=386 go build -ldflags "$LDFLAGS" -o $OUTPUT_DIR/smp-srv-32w.exe ./cmd/srv/
 
 # Linux (64-bit)
-GOOS=linux GOARCH=amd64 go build  -o $OUTPUT_DIR/smp-srv ./cmd/srv/
+GOOS=linux GOARCH=amd64 go build -ldflags "$LDFLAGS" -o $OUTPUT_DIR/smp-srv ./cmd/srv/
 
 # Linux (32-bit)
-GOOS=linux GOARCH=386 go build -o $OUTPUT_DIR/smp-srv32 ./cmd/srv/
+GOOS=linux GOARCH=386 go build -ldflags "$LDFLAGS" -o $OUTPUT_DIR/smp-srv32 ./cmd/srv/
 
 chmod +x build/*
 
@@ -0,0 +1,148 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"gama-client/internal/appconfig"
+	"gama-client/internal/diskinfo"
+	"gama-client/internal/route"
+	"time"
+)
+
+// Event is a change of the status of a disk, or of the check behind it.
+// Resolved events report a disk back to StatusSafe and renotify events an
+// alert still firing.
+type Event struct {
+	Host      string              `json:"host"`
+	Client    string              `json:"client"`
+	Device    string              `json:"device"`
+	DiskID    string              `json:"disk_id"`
+	OldStatus diskinfo.StatusType `json:"old_status"`
+	NewStatus diskinfo.StatusType `json:"new_status"`
+	// PeakStatus is the most severe status notified for the alert, which
+	// also routes its downgrades and its resolution.
+	PeakStatus diskinfo.StatusType `json:"peak_status"`
+	Condition  string              `json:"condition"`
+	Check      string              `json:"check"`
+	Resolved   bool                `json:"resolved"`
+	Renotify   bool                `json:"renotify"`
+	Time       time.Time           `json:"time"`
+	// Disk is the classification the event was raised from, for the
+	// notifiers reporting its health data.
+	Disk diskinfo.DiskInfo `json:"-"`
+}
+
+// State is "resolved" for resolved events and "firing" otherwise.
+func (e Event) State() string {
+	if e.Resolved {
+		return "resolved"
+	}
+	return "firing"
+}
+
+// AlertStatus is the status of the alert: NewStatus, or OldStatus for the
+// resolved events.
+func (e Event) AlertStatus() diskinfo.StatusType {
+	if e.Resolved {
+		return e.OldStatus
+	}
+	return e.NewStatus
+}
+
+// Severity is "critical" for the alerts of disks in Error and "warning"
+// otherwise.
+func (e Event) Severity() string {
+	if e.AlertStatus() == diskinfo.StatusError {
+		return appconfig.SeverityCritical
+	}
+	return appconfig.SeverityWarning
+}
+
+// peak is PeakStatus, or the status of the alert for the events raised
+// without one.
+func (e Event) peak() diskinfo.StatusType {
+	if e.PeakStatus == "" {
+		return e.AlertStatus()
+	}
+	return e.PeakStatus
+}
+
+// result is what the routes match for the event with the status. Resolved
+// events are routed like the alert they resolve.
+func (e Event) result(status diskinfo.StatusType) route.Result {
+	return route.Result{
+		Host:   e.Host,
+		Client: e.Client,
+		Device: e.Device,
+		DiskID: e.DiskID,
+		Status: status,
+		Check:  e.Check,
+	}
+}
+
+// notifies reports whether the router sends the event to the notifier. An event
+// follows the routes of its status and of its peak, so the notifiers told of
+// the most severe status also learn that the alert went down or resolved.
+func notifies(router *route.Router, notifier string, event Event) bool {
+	return router.Notifier(notifier, event.result(event.AlertStatus())) || router.Notifier(notifier, event.result(event.peak()))
+}
+
+// headline is a one line summary of the event.
+func headline(event Event) string {
+	switch {
+	case event.Resolved:
+		return fmt.Sprintf("%s on %s is back to %s", event.Device, event.Host, event.NewStatus)
+	case event.Renotify:
+		return fmt.Sprintf("%s on %s is still %s", event.Device, event.Host, event.NewStatus)
+	default:
+		return fmt.Sprintf("%s on %s changed from %s to %s", event.Device, event.Host, event.OldStatus, event.NewStatus)
+	}
+}
+
+// details is the condition and the origin of the event, for the push
+// notifiers.
+func details(event Event) string {
+	return fmt.Sprintf("%s\nHost: %s\nClient: %s\nCheck: %s", event.Condition, event.Host, event.Client, event.Check)
+}
+
+// filter selects the events delivered by a notifier.
+type filter struct {
+	critical     bool
+	sendResolved bool
+}
+
+func newFilter(config appconfig.NotifyFilter) filter {
+	return filter{critical: config.MinSeverity == appconfig.SeverityCritical, sendResolved: *config.SendResolved}
+}
+
+// allows reports whether the event is delivered. The downgrades and the
+// resolution of an alert that reached Error pass the critical filter too, so
+// a failure is always followed by its recovery.
+func (f filter) allows(event Event) bool {
+	if event.Resolved && !f.sendResolved {
+		return false
+	}
+	return !f.critical || event.peak() == diskinfo.StatusError
+}
+
+// Notifier delivers events. Failures worth retrying are returned as a
+// sink.RetryableError.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, event Event) error
+}
+
+// Refresher is a notifier keeping the alerts active on the receiving side,
+// which expire unless pushed again. Refresh receives every alert firing.
+type Refresher interface {
+	Notifier
+	RefreshInterval() time.Duration
+	Refresh(ctx context.Context, active []Event) error
+}
+
+// DigestNotifier is a notifier able to deliver several events at once, used
+// when it is configured with a digest interval.
+type DigestNotifier interface {
+	Notifier
+	NotifyDigest(ctx context.Context, events []Event) error
+}
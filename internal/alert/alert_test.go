@@ -0,0 +1,262 @@
+package alert
+
+import (
+	"encoding/json"
+	"gama-client/internal/appconfig"
+	"gama-client/internal/diskinfo"
+	"gama-client/internal/route"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testTime = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// firingEvent and resolvedEvent are the alert of a failed disk and its
+// resolution.
+func firingEvent() Event {
+	disk := failingDisk("/dev/sdb")
+	return Event{
+		Host:       "web1",
+		Client:     "acme",
+		Device:     disk.DeviceName,
+		DiskID:     "sdb",
+		OldStatus:  diskinfo.StatusSafe,
+		NewStatus:  diskinfo.StatusError,
+		PeakStatus: diskinfo.StatusError,
+		Condition:  disk.Condition,
+		Check:      disk.Check,
+		Time:       testTime,
+		Disk:       disk,
+	}
+}
+
+func resolvedEvent() Event {
+	event := firingEvent()
+	event.OldStatus, event.NewStatus = diskinfo.StatusError, diskinfo.StatusSafe
+	event.Condition = "All checks passed"
+	event.Resolved = true
+	event.Time = testTime.Add(time.Hour)
+	return event
+}
+
+func notifyFilter(minSeverity string, sendResolved bool) appconfig.NotifyFilter {
+	return appconfig.NotifyFilter{MinSeverity: minSeverity, SendResolved: &sendResolved}
+}
+
+// request is a request received by the test server.
+type request struct {
+	method string
+	path   string
+	header http.Header
+	body   []byte
+}
+
+// startReceiver serves the requests with the statuses in turn, repeating the
+// last one, and returns them in order.
+func startReceiver(t *testing.T, statuses ...int) (string, <-chan request) {
+	t.Helper()
+	requests := make(chan request, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		status := http.StatusOK
+		if len(statuses) > 0 {
+			status = statuses[0]
+			if len(statuses) > 1 {
+				statuses = statuses[1:]
+			}
+		}
+		requests <- request{method: r.Method, path: r.URL.Path, header: r.Header, body: body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, requests
+}
+
+// nextRequest returns the next request received, failing when there is none.
+func nextRequest(t *testing.T, requests <-chan request) request {
+	t.Helper()
+	select {
+	case received := <-requests:
+		return received
+	default:
+		t.Fatal("no request received")
+		return request{}
+	}
+}
+
+// noRequest fails when a request was received.
+func noRequest(t *testing.T, requests <-chan request) {
+	t.Helper()
+	select {
+	case received := <-requests:
+		t.Fatalf("unexpected request %s %s", received.path, received.body)
+	default:
+	}
+}
+
+// decode unmarshals the JSON body of a request.
+func decode(t *testing.T, received request, value interface{}) {
+	t.Helper()
+	if contentType := received.header.Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("got Content-Type %q", contentType)
+	}
+	if err := json.Unmarshal(received.body, value); err != nil {
+		t.Fatalf("invalid body %s: %v", received.body, err)
+	}
+}
+
+func warningDisk(device string) diskinfo.DiskInfo {
+	return diskinfo.DiskInfo{Status: diskinfo.StatusWarning, Check: diskinfo.CheckReallocatedSectors, Condition: "8 reallocated sectors", DeviceName: device}
+}
+
+// notified returns the notifiers the router sends each event of the
+// collections to.
+func notified(t *testing.T, router *route.Router, collections ...diskinfo.DiskInfo) [][]string {
+	t.Helper()
+	tracker, err := NewTracker(testPolicy(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	var got [][]string
+	for i, disk := range collections {
+		events, err := tracker.Update("web1", "acme", []diskinfo.DiskInfo{disk}, now.Add(time.Duration(i)*time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 {
+			t.Fatalf("collection %d: want one event, got %+v", i, events)
+		}
+		var names []string
+		for _, name := range []string{"pagerduty-0", "slack-0"} {
+			if notifies(router, name, events[0]) {
+				names = append(names, name)
+			}
+		}
+		got = append(got, names)
+	}
+	return got
+}
+
+func TestDowngradeAndResolveFollowPeakRoute(t *testing.T) {
+	router := route.NewRouter([]appconfig.RouteConfig{
+		{Match: appconfig.RouteMatch{Statuses: []string{"Error"}}, Notifiers: []string{"pagerduty-0"}},
+		{Match: appconfig.RouteMatch{Statuses: []string{"Warning"}}, Notifiers: []string{"slack-0"}},
+	})
+	tests := []struct {
+		name        string
+		collections []diskinfo.DiskInfo
+		want        [][]string
+	}{
+		{
+			name:        "error, warning, safe",
+			collections: []diskinfo.DiskInfo{failingDisk("/dev/sdb"), warningDisk("/dev/sdb"), safeDisk("/dev/sdb")},
+			want:        [][]string{{"pagerduty-0"}, {"pagerduty-0", "slack-0"}, {"pagerduty-0", "slack-0"}},
+		},
+		{
+			name:        "warning, error, safe",
+			collections: []diskinfo.DiskInfo{warningDisk("/dev/sdb"), failingDisk("/dev/sdb"), safeDisk("/dev/sdb")},
+			want:        [][]string{{"slack-0"}, {"pagerduty-0"}, {"pagerduty-0"}},
+		},
+		{
+			name:        "warning, safe",
+			collections: []diskinfo.DiskInfo{warningDisk("/dev/sdb"), safeDisk("/dev/sdb")},
+			want:        [][]string{{"slack-0"}, {"slack-0"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := notified(t, router, test.collections...)
+			for i := range test.want {
+				if strings.Join(got[i], ",") != strings.Join(test.want[i], ",") {
+					t.Errorf("event %d: got %q, want %q", i, got[i], test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPeakStatusSurvivesRestart(t *testing.T) {
+	stateFile := t.TempDir() + "/alerts.json"
+	now := time.Unix(1700000000, 0)
+	tracker, err := NewTracker(testPolicy(), stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker.Update("web1", "acme", []diskinfo.DiskInfo{failingDisk("/dev/sdb")}, now)
+	tracker.Update("web1", "acme", []diskinfo.DiskInfo{warningDisk("/dev/sdb")}, now.Add(time.Minute))
+
+	restarted, err := NewTracker(testPolicy(), stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := restarted.Update("web1", "acme", []diskinfo.DiskInfo{safeDisk("/dev/sdb")}, now.Add(2*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || !events[0].Resolved || events[0].OldStatus != diskinfo.StatusWarning || events[0].PeakStatus != diskinfo.StatusError {
+		t.Errorf("want a resolved Warning alert peaking at Error, got %+v", events)
+	}
+}
+
+func TestCriticalFilterDeliversRecovery(t *testing.T) {
+	tests := []struct {
+		name        string
+		filter      filter
+		collections []diskinfo.DiskInfo
+		want        []bool
+	}{
+		{
+			name:        "error, warning, safe",
+			filter:      filter{critical: true, sendResolved: true},
+			collections: []diskinfo.DiskInfo{failingDisk("/dev/sdb"), warningDisk("/dev/sdb"), safeDisk("/dev/sdb")},
+			want:        []bool{true, true, true},
+		},
+		{
+			name:        "warning, error, safe",
+			filter:      filter{critical: true, sendResolved: true},
+			collections: []diskinfo.DiskInfo{warningDisk("/dev/sdb"), failingDisk("/dev/sdb"), safeDisk("/dev/sdb")},
+			want:        []bool{false, true, true},
+		},
+		{
+			name:        "warning, safe",
+			filter:      filter{critical: true, sendResolved: true},
+			collections: []diskinfo.DiskInfo{warningDisk("/dev/sdb"), safeDisk("/dev/sdb")},
+			want:        []bool{false, false},
+		},
+		{
+			name:        "without resolved",
+			filter:      filter{critical: true},
+			collections: []diskinfo.DiskInfo{failingDisk("/dev/sdb"), warningDisk("/dev/sdb"), safeDisk("/dev/sdb")},
+			want:        []bool{true, true, false},
+		},
+		{
+			name:        "warning severity",
+			filter:      filter{sendResolved: true},
+			collections: []diskinfo.DiskInfo{warningDisk("/dev/sdb"), safeDisk("/dev/sdb")},
+			want:        []bool{true, true},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tracker, err := NewTracker(testPolicy(), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			now := time.Unix(1700000000, 0)
+			for i, disk := range test.collections {
+				events, _ := tracker.Update("web1", "acme", []diskinfo.DiskInfo{disk}, now.Add(time.Duration(i)*time.Minute))
+				if len(events) != 1 {
+					t.Fatalf("collection %d: want one event, got %+v", i, events)
+				}
+				if got := test.filter.allows(events[0]); got != test.want[i] {
+					t.Errorf("event %d (%s to %s): got %v, want %v", i, events[0].OldStatus, events[0].NewStatus, got, test.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"gama-client/internal/appconfig"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	alertmanagerTimeout = 20 * time.Second
+	// alertmanagerAlertName is the alertname label of every alert.
+	alertmanagerAlertName = "DiskHealth"
+	// alertmanagerExpiry is how many refresh intervals an alert stays active
+	// in Alertmanager without being pushed again.
+	alertmanagerExpiry = 3
+)
+
+// alertmanagerAlert is an alert of the Alertmanager v2 API.
+type alertmanagerAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      time.Time         `json:"endsAt"`
+}
+
+// AlertmanagerNotifier pushes one alert per failing disk to Alertmanager. The
+// alerts are pushed again on every refresh, with an end time a few refresh
+// intervals ahead, so they expire if the agent stops. A disk back to healthy,
+// or whose severity or check changed, ends its previous alert at once.
+type AlertmanagerNotifier struct {
+	name     string
+	url      string
+	username string
+	password string
+	headers  map[string]string
+	labels   map[string]string
+	refresh  time.Duration
+	client   *http.Client
+
+	// pushed is the last alert firing for each device. Notify and Refresh
+	// are only called from the manager goroutine.
+	pushed map[string]alertmanagerAlert
+}
+
+func NewAlertmanagerNotifier(config appconfig.AlertmanagerConfig) *AlertmanagerNotifier {
+	return &AlertmanagerNotifier{
+		name:     config.Name,
+		url:      strings.TrimSuffix(config.URL, "/") + "/api/v2/alerts",
+		username: config.Username,
+		password: config.Password,
+		headers:  config.Headers,
+		labels:   config.Labels,
+		refresh:  time.Duration(config.RefreshSeconds) * time.Second,
+		client:   &http.Client{Timeout: alertmanagerTimeout},
+		pushed:   make(map[string]alertmanagerAlert),
+	}
+}
+
+func (n *AlertmanagerNotifier) Name() string {
+	return n.name
+}
+
+func (n *AlertmanagerNotifier) RefreshInterval() time.Duration {
+	return n.refresh
+}
+
+func (n *AlertmanagerNotifier) Notify(ctx context.Context, event Event) error {
+	now := time.Now()
+	var alerts []alertmanagerAlert
+	previous, ok := n.pushed[event.Device]
+	if event.Resolved {
+		if !ok {
+			previous = n.alert(event, now)
+		}
+		previous.EndsAt = now
+		alerts = append(alerts, previous)
+	} else {
+		alert := n.alert(event, now)
+		if ok && !sameLabels(previous.Labels, alert.Labels) {
+			previous.EndsAt = now
+			alerts = append(alerts, previous)
+		}
+		alerts = append(alerts, alert)
+	}
+	if err := n.post(ctx, alerts); err != nil {
+		return err
+	}
+	if event.Resolved {
+		delete(n.pushed, event.Device)
+	} else {
+		n.pushed[event.Device] = alerts[len(alerts)-1]
+	}
+	return nil
+}
+
+// Refresh pushes the active alerts again, and ends the pushed ones no longer
+// active, such as those of a disk resolved while the agent was stopped.
+func (n *AlertmanagerNotifier) Refresh(ctx context.Context, active []Event) error {
+	now := time.Now()
+	pushed := make(map[string]alertmanagerAlert, len(active))
+	var alerts []alertmanagerAlert
+	for _, event := range active {
+		alert := n.alert(event, now)
+		pushed[event.Device] = alert
+		alerts = append(alerts, alert)
+	}
+	for device, previous := range n.pushed {
+		if current, ok := pushed[device]; ok && sameLabels(previous.Labels, current.Labels) {
+			continue
+		}
+		previous.EndsAt = now
+		alerts = append(alerts, previous)
+	}
+	if len(alerts) == 0 {
+		return nil
+	}
+	if err := n.post(ctx, alerts); err != nil {
+		return err
+	}
+	n.pushed = pushed
+	return nil
+}
+
+func (n *AlertmanagerNotifier) alert(event Event, now time.Time) alertmanagerAlert {
+	labels := make(map[string]string, len(n.labels)+7)
+	for key, value := range n.labels {
+		labels[key] = value
+	}
+	labels["alertname"] = alertmanagerAlertName
+	labels["host"] = event.Host
+	labels["client"] = event.Client
+	labels["device"] = event.Device
+	labels["disk_id"] = event.DiskID
+	labels["severity"] = event.Severity()
+	labels["check"] = event.Check
+	return alertmanagerAlert{
+		Labels: labels,
+		Annotations: map[string]string{
+			"summary":     event.Device + " on " + event.Host + " is " + string(event.AlertStatus()),
+			"description": event.Condition,
+		},
+		StartsAt: event.Time,
+		EndsAt:   now.Add(alertmanagerExpiry * n.refresh),
+	}
+}
+
+func sameLabels(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if b[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *AlertmanagerNotifier) post(ctx context.Context, alerts []alertmanagerAlert) error {
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range n.headers {
+		request.Header.Set(key, value)
+	}
+	if n.username != "" {
+		request.SetBasicAuth(n.username, n.password)
+	}
+	return doRequest(n.client, request)
+}
@@ -0,0 +1,246 @@
+package alert
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"gama-client/internal/appconfig"
+	"gama-client/internal/sink"
+	"io"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const smtpTimeout = 30 * time.Second
+
+// keyAttributes are the SMART attributes shown in the reports, when the disk
+// reports them.
+var keyAttributes = map[int]bool{5: true, 187: true, 188: true, 196: true, 197: true, 198: true, 199: true}
+
+// EmailNotifier sends a plain text report of the events to a list of
+// recipients.
+type EmailNotifier struct {
+	name         string
+	config       appconfig.EmailConfig
+	sendResolved bool
+}
+
+func NewEmailNotifier(config appconfig.EmailConfig) *EmailNotifier {
+	return &EmailNotifier{name: config.Name, config: config, sendResolved: *config.SendResolved}
+}
+
+func (n *EmailNotifier) Name() string {
+	return n.name
+}
+
+func (n *EmailNotifier) Notify(ctx context.Context, event Event) error {
+	return n.NotifyDigest(ctx, []Event{event})
+}
+
+func (n *EmailNotifier) NotifyDigest(ctx context.Context, events []Event) error {
+	var selected []Event
+	for _, event := range events {
+		if !event.Resolved || n.sendResolved {
+			selected = append(selected, event)
+		}
+	}
+	if len(selected) == 0 {
+		return nil
+	}
+	return n.send(ctx, emailSubject(selected), emailBody(selected))
+}
+
+func emailSubject(events []Event) string {
+	if len(events) == 1 {
+		event := events[0]
+		if event.Renotify {
+			return fmt.Sprintf("[SMP] %s %s: still %s", event.Host, event.Device, event.NewStatus)
+		}
+		return fmt.Sprintf("[SMP] %s %s: %s -> %s", event.Host, event.Device, event.OldStatus, event.NewStatus)
+	}
+	hosts := make(map[string]bool)
+	for _, event := range events {
+		hosts[event.Host] = true
+	}
+	if len(hosts) == 1 {
+		return fmt.Sprintf("[SMP] %s: %d disk status changes", events[0].Host, len(events))
+	}
+	return fmt.Sprintf("[SMP] %d disk status changes", len(events))
+}
+
+func emailBody(events []Event) string {
+	var body strings.Builder
+	for i, event := range events {
+		if i > 0 {
+			body.WriteString("\r\n----\r\n\r\n")
+		}
+		writeEvent(&body, event)
+	}
+	return body.String()
+}
+
+func writeEvent(body *strings.Builder, event Event) {
+	line := func(format string, args ...interface{}) {
+		fmt.Fprintf(body, format+"\r\n", args...)
+	}
+	switch {
+	case event.Resolved:
+		line("RESOLVED: %s is back to %s", event.Device, event.NewStatus)
+	case event.Renotify:
+		line("%s is still %s", event.Device, event.NewStatus)
+	default:
+		line("%s changed from %s to %s", event.Device, event.OldStatus, event.NewStatus)
+	}
+	line("")
+	line("Host:      %s", event.Host)
+	line("Client:    %s", event.Client)
+	line("Time:      %s", event.Time.Format(time.RFC1123Z))
+	line("Condition: %s", event.Condition)
+
+	disk := event.Disk
+	health := disk.Health
+	if disk.TemperatureSource != "" {
+		line("Temperature: %d°C (%s)", disk.Temperature, disk.TemperatureSource)
+	}
+	if health.SmartPassed != nil {
+		result := "PASSED"
+		if !*health.SmartPassed {
+			result = "FAILED"
+		}
+		line("SMART overall health: %s", result)
+	}
+	if health.HealthStatus != "" {
+		line("Health status: %s (%s)", health.HealthStatus, strings.Join(health.OperationalStatus, ", "))
+	}
+	if health.NVMeLog != nil {
+		log := health.NVMeLog
+		line("NVMe critical warning: %d", log.CriticalWarning)
+		line("NVMe available spare: %d%% (threshold %d%%)", log.AvailableSpare, log.AvailableSpareThreshold)
+		line("NVMe percentage used: %d%%", log.PercentageUsed)
+		line("NVMe media errors: %d", log.MediaErrors)
+	}
+	if health.Wear != nil {
+		line("Wear: %d%%", *health.Wear)
+	}
+	if health.TemperatureMax != nil {
+		line("Maximum temperature: %d°C", *health.TemperatureMax)
+	}
+	if health.PowerOnHours != nil {
+		line("Power-on hours: %d", *health.PowerOnHours)
+	}
+	if health.ReadErrorsTotal != nil || health.ReadErrorsUncorrected != nil {
+		line("Read errors: %s total, %s uncorrected", counter(health.ReadErrorsTotal), counter(health.ReadErrorsUncorrected))
+	}
+	if health.WriteErrorsTotal != nil || health.WriteErrorsUncorrected != nil {
+		line("Write errors: %s total, %s uncorrected", counter(health.WriteErrorsTotal), counter(health.WriteErrorsUncorrected))
+	}
+	for _, attribute := range health.Attributes {
+		if keyAttributes[attribute.ID] {
+			line("%s (%d): raw %d, value %d, threshold %d", attribute.Name, attribute.ID, attribute.Raw.Value, attribute.Value, attribute.Thresh)
+		}
+	}
+}
+
+// counter formats a reliability counter the driver may not report.
+func counter(value *int64) string {
+	if value == nil {
+		return "n/a"
+	}
+	return strconv.FormatInt(*value, 10)
+}
+
+func (n *EmailNotifier) send(ctx context.Context, subject, body string) error {
+	config := n.config
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+	address := net.JoinHostPort(config.SMTPHost, strconv.Itoa(config.SMTPPort))
+	tlsConfig := &tls.Config{ServerName: config.SMTPHost, InsecureSkipVerify: config.SMTPInsecureSkipVerify}
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{}
+	if config.SMTPSecurity == appconfig.SMTPTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return &sink.RetryableError{Err: err}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, config.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return classifySMTPError(err)
+	}
+	defer client.Close()
+
+	if config.SMTPSecurity == appconfig.SMTPStartTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return classifySMTPError(err)
+		}
+	}
+	if config.SMTPUsername != "" {
+		if err := client.Auth(smtp.PlainAuth("", config.SMTPUsername, config.SMTPPassword, config.SMTPHost)); err != nil {
+			return classifySMTPError(err)
+		}
+	}
+	if err := client.Mail(config.From); err != nil {
+		return classifySMTPError(err)
+	}
+	for _, recipient := range config.To {
+		if err := client.Rcpt(recipient); err != nil {
+			return classifySMTPError(err)
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return classifySMTPError(err)
+	}
+	if _, err := writer.Write(n.message(subject, body)); err != nil {
+		return classifySMTPError(err)
+	}
+	if err := writer.Close(); err != nil {
+		return classifySMTPError(err)
+	}
+	return client.Quit()
+}
+
+func (n *EmailNotifier) message(subject, body string) []byte {
+	var message strings.Builder
+	fmt.Fprintf(&message, "From: %s\r\n", n.config.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(n.config.To, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	message.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	message.WriteString("\r\n")
+	message.WriteString(body)
+	return []byte(message.String())
+}
+
+// classifySMTPError retries the transient 4xx replies and network failures.
+// 5xx replies, such as a rejected recipient, and local errors, such as plain
+// authentication over an unencrypted connection, fail at once.
+func classifySMTPError(err error) error {
+	var protocolError *textproto.Error
+	if errors.As(err, &protocolError) {
+		if protocolError.Code >= 500 {
+			return err
+		}
+		return &sink.RetryableError{Err: err}
+	}
+	var netError net.Error
+	if errors.As(err, &netError) || errors.Is(err, io.EOF) {
+		return &sink.RetryableError{Err: err}
+	}
+	return err
+}
@@ -0,0 +1,338 @@
+package alert
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"gama-client/internal/appconfig"
+	"gama-client/internal/diskinfo"
+	"gama-client/internal/sink"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpSession is what the test SMTP server received from a client.
+type smtpSession struct {
+	tls  bool
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+// smtpServer is a minimal SMTP server offering STARTTLS and AUTH PLAIN. The
+// recipients of rejects are refused with their reply code.
+type smtpServer struct {
+	listener net.Listener
+	tls      *tls.Config
+	rejects  map[string]int
+	sessions chan smtpSession
+}
+
+func testTLSConfig(t *testing.T) *tls.Config {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+// startSMTPServer listens on a local port, with implicit TLS when
+// implicitTLS is set, and returns the server and its port.
+func startSMTPServer(t *testing.T, implicitTLS bool, rejects map[string]int) (*smtpServer, int) {
+	t.Helper()
+	tlsConfig := testTLSConfig(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if implicitTLS {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	server := &smtpServer{listener: listener, tls: tlsConfig, rejects: rejects, sessions: make(chan smtpSession, 4)}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn, implicitTLS)
+		}
+	}()
+	return server, listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpServer) serve(conn net.Conn, implicitTLS bool) {
+	defer conn.Close()
+	session := smtpSession{tls: implicitTLS}
+	text := textproto.NewConn(conn)
+	reply := func(line string) { text.PrintfLine("%s", line) }
+	reply("220 localhost ESMTP test")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command, argument, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(command) {
+		case "EHLO", "HELO":
+			if !session.tls {
+				reply("250-STARTTLS")
+			}
+			reply("250-AUTH PLAIN")
+			reply("250 8BITMIME")
+		case "STARTTLS":
+			reply("220 Ready to start TLS")
+			tlsConn := tls.Server(conn, s.tls)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, text, session.tls = tlsConn, textproto.NewConn(tlsConn), true
+		case "AUTH":
+			_, credentials, _ := strings.Cut(argument, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(credentials)
+			session.auth = string(decoded)
+			reply("235 Authentication successful")
+		case "MAIL":
+			address, _, _ := strings.Cut(strings.TrimPrefix(argument, "FROM:"), " ")
+			session.from = strings.Trim(address, "<>")
+			reply("250 OK")
+		case "RCPT":
+			recipient := strings.Trim(strings.TrimPrefix(argument, "TO:"), "<>")
+			if code := s.rejects[recipient]; code != 0 {
+				reply(strconv.Itoa(code) + " Recipient refused")
+				continue
+			}
+			session.to = append(session.to, recipient)
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			// ReadDotBytes turns the CRLF line endings into LF.
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			session.data = string(data)
+			reply("250 OK queued")
+		case "QUIT":
+			reply("221 Bye")
+			s.sessions <- session
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func (s *smtpServer) session(t *testing.T) smtpSession {
+	t.Helper()
+	select {
+	case session := <-s.sessions:
+		return session
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail received")
+		return smtpSession{}
+	}
+}
+
+func emailConfig(port int, security string) appconfig.EmailConfig {
+	sendResolved := true
+	return appconfig.EmailConfig{
+		Name:                   "email-0",
+		SMTPHost:               "127.0.0.1",
+		SMTPPort:               port,
+		SMTPSecurity:           security,
+		SMTPUsername:           "agent",
+		SMTPPassword:           "secret",
+		SMTPInsecureSkipVerify: true,
+		From:                   "smp@example.com",
+		To:                     []string{"ops@example.com", "storage@example.com"},
+		SendResolved:           &sendResolved,
+	}
+}
+
+// header returns the value of a header of the message.
+func header(data, name string) string {
+	reader := textproto.NewReader(bufio.NewReader(strings.NewReader(data)))
+	headers, _ := reader.ReadMIMEHeader()
+	return headers.Get(name)
+}
+
+func TestEmailNotifierStartTLS(t *testing.T) {
+	server, port := startSMTPServer(t, false, nil)
+	notifier := NewEmailNotifier(emailConfig(port, appconfig.SMTPStartTLS))
+	if err := notifier.Notify(context.Background(), firingEvent()); err != nil {
+		t.Fatal(err)
+	}
+	session := server.session(t)
+	if !session.tls || session.auth != "\x00agent\x00secret" || session.from != "smp@example.com" ||
+		strings.Join(session.to, ",") != "ops@example.com,storage@example.com" {
+		t.Errorf("got session %+v", session)
+	}
+	if subject := header(session.data, "Subject"); subject != "[SMP] web1 /dev/sdb: Safe -> Error" {
+		t.Errorf("got subject %q", subject)
+	}
+	if to := header(session.data, "To"); to != "ops@example.com, storage@example.com" {
+		t.Errorf("got To %q", to)
+	}
+	if contentType := header(session.data, "Content-Type"); contentType != "text/plain; charset=utf-8" {
+		t.Errorf("got Content-Type %q", contentType)
+	}
+	if !strings.Contains(session.data, "\n\n/dev/sdb changed from Safe to Error\n") || !strings.Contains(session.data, "Condition: SMART status check failed\n") {
+		t.Errorf("got message %q", session.data)
+	}
+}
+
+func TestEmailNotifierImplicitTLS(t *testing.T) {
+	server, port := startSMTPServer(t, true, nil)
+	config := emailConfig(port, appconfig.SMTPTLS)
+	config.SMTPUsername = ""
+	if err := NewEmailNotifier(config).Notify(context.Background(), resolvedEvent()); err != nil {
+		t.Fatal(err)
+	}
+	session := server.session(t)
+	if !session.tls || session.auth != "" {
+		t.Errorf("got session %+v", session)
+	}
+	if subject := header(session.data, "Subject"); subject != "[SMP] web1 /dev/sdb: Error -> Safe" {
+		t.Errorf("got subject %q", subject)
+	}
+}
+
+func TestEmailNotifierRejectedRecipient(t *testing.T) {
+	tests := []struct {
+		code      int
+		retryable bool
+	}{
+		{code: 451, retryable: true},
+		{code: 550},
+	}
+	for _, test := range tests {
+		_, port := startSMTPServer(t, false, map[string]int{"storage@example.com": test.code})
+		err := NewEmailNotifier(emailConfig(port, appconfig.SMTPStartTLS)).Notify(context.Background(), firingEvent())
+		var retryable *sink.RetryableError
+		if err == nil || errors.As(err, &retryable) != test.retryable {
+			t.Errorf("%d: got %v, want retryable %v", test.code, err, test.retryable)
+		}
+	}
+}
+
+func TestEmailNotifierDigest(t *testing.T) {
+	server, port := startSMTPServer(t, false, nil)
+	config := emailConfig(port, appconfig.SMTPStartTLS)
+	sendResolved := false
+	config.SendResolved = &sendResolved
+	notifier := NewEmailNotifier(config)
+
+	other := firingEvent()
+	other.Host, other.Device = "db1", "/dev/nvme0n1"
+	events := []Event{firingEvent(), resolvedEvent(), other}
+	if err := notifier.NotifyDigest(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+	session := server.session(t)
+	if subject := header(session.data, "Subject"); subject != "[SMP] 2 disk status changes" {
+		t.Errorf("got subject %q", subject)
+	}
+	if strings.Contains(session.data, "RESOLVED") || strings.Count(session.data, "\n----\n") != 1 {
+		t.Errorf("got message %q, want the two firing events", session.data)
+	}
+
+	// Nothing is sent for resolved events only.
+	if err := notifier.NotifyDigest(context.Background(), []Event{resolvedEvent()}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case session := <-server.sessions:
+		t.Errorf("unexpected mail %q", session.data)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestEmailSubject(t *testing.T) {
+	renotify := firingEvent()
+	renotify.Renotify, renotify.OldStatus = true, diskinfo.StatusError
+	other := firingEvent()
+	other.Host = "db1"
+	tests := []struct {
+		events []Event
+		want   string
+	}{
+		{events: []Event{firingEvent()}, want: "[SMP] web1 /dev/sdb: Safe -> Error"},
+		{events: []Event{renotify}, want: "[SMP] web1 /dev/sdb: still Error"},
+		{events: []Event{firingEvent(), resolvedEvent()}, want: "[SMP] web1: 2 disk status changes"},
+		{events: []Event{firingEvent(), resolvedEvent(), other}, want: "[SMP] 3 disk status changes"},
+	}
+	for _, test := range tests {
+		if got := emailSubject(test.events); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestEmailBody(t *testing.T) {
+	passed := false
+	wear, powerOn := 87, 26280
+	readErrors := int64(14)
+	event := firingEvent()
+	event.Disk.Temperature, event.Disk.TemperatureSource = 52, diskinfo.TemperatureSourceSMART
+	event.Disk.Health = diskinfo.HealthSnapshot{
+		SmartPassed:     &passed,
+		Wear:            &wear,
+		PowerOnHours:    &powerOn,
+		ReadErrorsTotal: &readErrors,
+		Attributes: []diskinfo.SMARTAttribute{
+			{ID: 5, Name: "Reallocated_Sector_Ct", Value: 90, Thresh: 36, Raw: diskinfo.SMARTRaw{Value: 128}},
+			{ID: 9, Name: "Power_On_Hours", Value: 70, Raw: diskinfo.SMARTRaw{Value: 26280}},
+		},
+	}
+	want := "/dev/sdb changed from Safe to Error\r\n" +
+		"\r\n" +
+		"Host:      web1\r\n" +
+		"Client:    acme\r\n" +
+		"Time:      Fri, 01 Mar 2024 12:00:00 +0000\r\n" +
+		"Condition: SMART status check failed\r\n" +
+		"Temperature: 52°C (smart)\r\n" +
+		"SMART overall health: FAILED\r\n" +
+		"Wear: 87%\r\n" +
+		"Power-on hours: 26280\r\n" +
+		"Read errors: 14 total, n/a uncorrected\r\n" +
+		"Reallocated_Sector_Ct (5): raw 128, value 90, threshold 36\r\n" +
+		"\r\n----\r\n\r\n" +
+		"RESOLVED: /dev/sdb is back to Safe\r\n" +
+		"\r\n" +
+		"Host:      web1\r\n" +
+		"Client:    acme\r\n" +
+		"Time:      Fri, 01 Mar 2024 13:00:00 +0000\r\n" +
+		"Condition: All checks passed\r\n"
+	resolved := resolvedEvent()
+	resolved.Disk = diskinfo.DiskInfo{DeviceName: "/dev/sdb"}
+	if got := emailBody([]Event{event, resolved}); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
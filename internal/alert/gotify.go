@@ -0,0 +1,57 @@
+package alert
+
+import (
+	"context"
+	"gama-client/internal/appconfig"
+	"gama-client/internal/diskinfo"
+	"net/http"
+	"strings"
+)
+
+// gotifyPriorities are the priorities of the messages of each status.
+var gotifyPriorities = map[diskinfo.StatusType]int{
+	diskinfo.StatusSafe:    2,
+	diskinfo.StatusWarning: 5,
+	diskinfo.StatusError:   8,
+}
+
+type gotifyMessage struct {
+	Title    string `json:"title"`
+	Message  string `json:"message"`
+	Priority int    `json:"priority"`
+}
+
+// GotifyNotifier sends the events as messages of a Gotify application.
+type GotifyNotifier struct {
+	name   string
+	url    string
+	token  string
+	filter filter
+	client *http.Client
+}
+
+func NewGotifyNotifier(config appconfig.GotifyConfig) *GotifyNotifier {
+	return &GotifyNotifier{
+		name:   config.Name,
+		url:    strings.TrimSuffix(config.URL, "/") + "/message",
+		token:  config.Token,
+		filter: newFilter(config.NotifyFilter),
+		client: &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+func (n *GotifyNotifier) Name() string {
+	return n.name
+}
+
+func (n *GotifyNotifier) Notify(ctx context.Context, event Event) error {
+	if !n.filter.allows(event) {
+		return nil
+	}
+	message := gotifyMessage{
+		Title:    headline(event),
+		Message:  details(event),
+		Priority: gotifyPriorities[event.NewStatus],
+	}
+	return postJSON(ctx, n.client, n.url, map[string]string{"X-Gotify-Key": n.token}, message)
+}
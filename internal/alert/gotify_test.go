@@ -0,0 +1,44 @@
+package alert
+
+import (
+	"context"
+	"gama-client/internal/appconfig"
+	"gama-client/internal/diskinfo"
+	"testing"
+)
+
+func TestGotifyNotifier(t *testing.T) {
+	url, requests := startReceiver(t)
+	notifier := NewGotifyNotifier(appconfig.GotifyConfig{Name: "gotify-0", URL: url + "/", Token: "AppT0ken", NotifyFilter: notifyFilter(appconfig.SeverityCritical, true)})
+	ctx := context.Background()
+
+	warning := firingEvent()
+	warning.NewStatus, warning.PeakStatus = diskinfo.StatusWarning, diskinfo.StatusWarning
+	if err := notifier.Notify(ctx, warning); err != nil {
+		t.Fatal(err)
+	}
+	noRequest(t, requests)
+
+	tests := []struct {
+		event    Event
+		title    string
+		priority int
+	}{
+		{event: firingEvent(), title: "/dev/sdb on web1 changed from Safe to Error", priority: 8},
+		{event: resolvedEvent(), title: "/dev/sdb on web1 is back to Safe", priority: 2},
+	}
+	for _, test := range tests {
+		if err := notifier.Notify(ctx, test.event); err != nil {
+			t.Fatal(err)
+		}
+		received := nextRequest(t, requests)
+		if received.path != "/message" || received.header.Get("X-Gotify-Key") != "AppT0ken" {
+			t.Errorf("got %s with key %q", received.path, received.header.Get("X-Gotify-Key"))
+		}
+		var message gotifyMessage
+		decode(t, received, &message)
+		if message.Title != test.title || message.Priority != test.priority || message.Message != test.event.Condition+"\nHost: web1\nClient: acme\nCheck: smart_failed" {
+			t.Errorf("got %+v", message)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"gama-client/internal/appconfig"
+	"gama-client/internal/route"
+	"gama-client/internal/sink"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+const (
+	// queueSize is the number of collections whose events wait to be
+	// delivered before new ones are dropped.
+	queueSize    = 64
+	closeTimeout = 10 * time.Second
+	// scheduleInterval is how often the digests and refreshes that are due
+	// are sent.
+	scheduleInterval = 10 * time.Second
+)
+
+// delivery is a notifier and, in digest mode, the events waiting for its next
+// digest.
+type delivery struct {
+	notifier    Notifier
+	digest      time.Duration
+	pending     []Event
+	due         time.Time
+	nextRefresh time.Time
+}
+
+// Manager detects the status transitions of every collection and delivers
+// them to the notifiers in the background. It is a sink, so it receives the
+// collections like the other outputs.
+type Manager struct {
+	tracker    *Tracker
+	deliveries []*delivery
+	router     *route.Router
+	policy     sink.RetryPolicy
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	queue  chan []Event
+	done   chan struct{}
+
+	// host and client of the latest collection, for the refreshed alerts.
+	mu     sync.Mutex
+	host   string
+	client string
+	seen   bool
+}
+
+// NewManager builds the configured notifiers, which receive the events the
+// router selects for them. It returns nil when there are none.
+func NewManager(config appconfig.AlertingConfig, router *route.Router) (*Manager, error) {
+	var deliveries []*delivery
+	for _, webhook := range config.Webhooks {
+		notifier, err := NewWebhookNotifier(webhook)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %q: %w", webhook.Name, err)
+		}
+		deliveries = append(deliveries, &delivery{notifier: notifier})
+	}
+	for _, email := range config.Emails {
+		digest := time.Duration(email.DigestMinutes) * time.Minute
+		deliveries = append(deliveries, &delivery{notifier: NewEmailNotifier(email), digest: digest})
+	}
+	for _, alertmanager := range config.Alertmanagers {
+		deliveries = append(deliveries, &delivery{notifier: NewAlertmanagerNotifier(alertmanager)})
+	}
+	for _, slack := range config.Slack {
+		deliveries = append(deliveries, &delivery{notifier: NewSlackNotifier(slack)})
+	}
+	for _, teams := range config.Teams {
+		deliveries = append(deliveries, &delivery{notifier: NewTeamsNotifier(teams)})
+	}
+	for _, pagerDuty := range config.PagerDuty {
+		deliveries = append(deliveries, &delivery{notifier: NewPagerDutyNotifier(pagerDuty)})
+	}
+	for _, ntfy := range config.Ntfy {
+		deliveries = append(deliveries, &delivery{notifier: NewNtfyNotifier(ntfy)})
+	}
+	for _, gotify := range config.Gotify {
+		deliveries = append(deliveries, &delivery{notifier: NewGotifyNotifier(gotify)})
+	}
+	if len(deliveries) == 0 {
+		return nil, nil
+	}
+	tracker, err := NewTracker(NewPolicy(config), config.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	manager := &Manager{
+		tracker:    tracker,
+		deliveries: deliveries,
+		router:     router,
+		policy:     sink.DefaultRetryPolicy,
+		ctx:        ctx,
+		cancel:     cancel,
+		queue:      make(chan []Event, queueSize),
+		done:       make(chan struct{}),
+	}
+	go manager.run()
+	return manager, nil
+}
+
+func (m *Manager) Name() string {
+	return appconfig.AlertingSinkName
+}
+
+func (m *Manager) Write(_ context.Context, batch sink.Batch) error {
+	m.mu.Lock()
+	m.host, m.client, m.seen = batch.Host, batch.Client, true
+	m.mu.Unlock()
+	events, err := m.tracker.Update(batch.Host, batch.Client, batch.Disks, batch.Time)
+	if err != nil {
+		logrus.Errorf("Error saving alert state: %v", err)
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	for _, event := range events {
+		if event.Renotify {
+			logrus.Infof("Disk %s is still %s: %s", event.Device, event.NewStatus, event.Condition)
+		} else {
+			logrus.Infof("Disk %s changed from %s to %s: %s", event.Device, event.OldStatus, event.NewStatus, event.Condition)
+		}
+	}
+	select {
+	case m.queue <- events:
+		return nil
+	default:
+		return fmt.Errorf("alert queue is full, dropped %d events", len(events))
+	}
+}
+
+func (m *Manager) run() {
+	defer close(m.done)
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case events, ok := <-m.queue:
+			if !ok {
+				m.sendDigests(true)
+				return
+			}
+			for _, d := range m.deliveries {
+				routed := m.route(d.notifier, events)
+				if len(routed) == 0 {
+					continue
+				}
+				if d.digest > 0 {
+					if len(d.pending) == 0 {
+						d.due = time.Now().Add(d.digest)
+					}
+					d.pending = append(d.pending, routed...)
+					continue
+				}
+				for _, event := range routed {
+					m.notify(d.notifier, event)
+				}
+			}
+		case <-ticker.C:
+			m.sendDigests(false)
+			m.refresh()
+		}
+	}
+}
+
+// route returns the events routed to the notifier.
+func (m *Manager) route(notifier Notifier, events []Event) []Event {
+	var routed []Event
+	for _, event := range events {
+		if notifies(m.router, notifier.Name(), event) {
+			routed = append(routed, event)
+		}
+	}
+	return routed
+}
+
+func (m *Manager) notify(notifier Notifier, event Event) {
+	attempts, err := m.policy.Do(m.ctx, func() error {
+		return notifier.Notify(m.ctx, event)
+	})
+	if err != nil {
+		logrus.Errorf("Error notifying %s of %s %s after %d attempts: %v", notifier.Name(), event.Device, event.State(), attempts, err)
+		return
+	}
+	logrus.Debugf("Notified %s of %s %s", notifier.Name(), event.Device, event.State())
+}
+
+// sendDigests sends the digests that are due, or all of them when stopping.
+// Notifiers without digest support receive the events one by one.
+func (m *Manager) sendDigests(all bool) {
+	now := time.Now()
+	for _, d := range m.deliveries {
+		if len(d.pending) == 0 || (!all && now.Before(d.due)) {
+			continue
+		}
+		events := d.pending
+		d.pending = nil
+		digester, ok := d.notifier.(DigestNotifier)
+		if !ok {
+			for _, event := range events {
+				m.notify(d.notifier, event)
+			}
+			continue
+		}
+		attempts, err := m.policy.Do(m.ctx, func() error {
+			return digester.NotifyDigest(m.ctx, events)
+		})
+		if err != nil {
+			logrus.Errorf("Error sending digest of %d events to %s after %d attempts: %v", len(events), d.notifier.Name(), attempts, err)
+			continue
+		}
+		logrus.Debugf("Sent digest of %d events to %s", len(events), d.notifier.Name())
+	}
+}
+
+// refresh pushes the active alerts to the refreshers that are due. Nothing is
+// pushed before the first collection.
+func (m *Manager) refresh() {
+	m.mu.Lock()
+	host, client, seen := m.host, m.client, m.seen
+	m.mu.Unlock()
+	if !seen {
+		return
+	}
+	now := time.Now()
+	var active []Event
+	for _, d := range m.deliveries {
+		refresher, ok := d.notifier.(Refresher)
+		if !ok || now.Before(d.nextRefresh) {
+			continue
+		}
+		d.nextRefresh = now.Add(refresher.RefreshInterval())
+		if active == nil {
+			active = m.tracker.Active(host, client)
+		}
+		routed := m.route(refresher, active)
+		if err := refresher.Refresh(m.ctx, routed); err != nil {
+			logrus.Errorf("Error refreshing %d alerts on %s: %v", len(routed), refresher.Name(), err)
+		}
+	}
+}
+
+// Close delivers the queued events and the pending digests, then gives up on
+// the remaining ones.
+func (m *Manager) Close() error {
+	close(m.queue)
+	select {
+	case <-m.done:
+	case <-time.After(closeTimeout):
+		m.cancel()
+		<-m.done
+	}
+	m.cancel()
+	return nil
+}
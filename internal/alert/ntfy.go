@@ -0,0 +1,71 @@
+package alert
+
+import (
+	"context"
+	"gama-client/internal/appconfig"
+	"gama-client/internal/diskinfo"
+	"net/http"
+	"strings"
+)
+
+// ntfyPriorities and ntfyTags are the priority and the emoji tag of the
+// notifications of each status.
+var (
+	ntfyPriorities = map[diskinfo.StatusType]string{
+		diskinfo.StatusSafe:    "default",
+		diskinfo.StatusWarning: "high",
+		diskinfo.StatusError:   "urgent",
+	}
+	ntfyTags = map[diskinfo.StatusType]string{
+		diskinfo.StatusSafe:    "white_check_mark",
+		diskinfo.StatusWarning: "warning",
+		diskinfo.StatusError:   "rotating_light",
+	}
+)
+
+// NtfyNotifier publishes the events to an ntfy topic.
+type NtfyNotifier struct {
+	name     string
+	url      string
+	token    string
+	username string
+	password string
+	filter   filter
+	client   *http.Client
+}
+
+func NewNtfyNotifier(config appconfig.NtfyConfig) *NtfyNotifier {
+	return &NtfyNotifier{
+		name:     config.Name,
+		url:      config.URL,
+		token:    config.Token,
+		username: config.Username,
+		password: config.Password,
+		filter:   newFilter(config.NotifyFilter),
+		client:   &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+func (n *NtfyNotifier) Name() string {
+	return n.name
+}
+
+func (n *NtfyNotifier) Notify(ctx context.Context, event Event) error {
+	if !n.filter.allows(event) {
+		return nil
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, strings.NewReader(details(event)))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Title", headline(event))
+	request.Header.Set("Priority", ntfyPriorities[event.NewStatus])
+	request.Header.Set("Tags", ntfyTags[event.NewStatus])
+	switch {
+	case n.token != "":
+		request.Header.Set("Authorization", "Bearer "+n.token)
+	case n.username != "":
+		request.SetBasicAuth(n.username, n.password)
+	}
+	return doRequest(n.client, request)
+}
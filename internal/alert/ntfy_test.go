@@ -0,0 +1,53 @@
+package alert
+
+import (
+	"context"
+	"gama-client/internal/appconfig"
+	"testing"
+)
+
+func TestNtfyNotifier(t *testing.T) {
+	url, requests := startReceiver(t)
+	notifier := NewNtfyNotifier(appconfig.NtfyConfig{Name: "ntfy-0", URL: url + "/disks", Token: "tk_secret", NotifyFilter: notifyFilter("", true)})
+	tests := []struct {
+		event    Event
+		title    string
+		priority string
+		tags     string
+	}{
+		{event: firingEvent(), title: "/dev/sdb on web1 changed from Safe to Error", priority: "urgent", tags: "rotating_light"},
+		{event: resolvedEvent(), title: "/dev/sdb on web1 is back to Safe", priority: "default", tags: "white_check_mark"},
+	}
+	for _, test := range tests {
+		if err := notifier.Notify(context.Background(), test.event); err != nil {
+			t.Fatal(err)
+		}
+		received := nextRequest(t, requests)
+		if received.method != "POST" || received.path != "/disks" {
+			t.Errorf("got %s %s", received.method, received.path)
+		}
+		header := received.header
+		if header.Get("Title") != test.title || header.Get("Priority") != test.priority || header.Get("Tags") != test.tags {
+			t.Errorf("got title %q, priority %q and tags %q, want %q, %q and %q",
+				header.Get("Title"), header.Get("Priority"), header.Get("Tags"), test.title, test.priority, test.tags)
+		}
+		if header.Get("Authorization") != "Bearer tk_secret" {
+			t.Errorf("got Authorization %q", header.Get("Authorization"))
+		}
+		want := test.event.Condition + "\nHost: web1\nClient: acme\nCheck: smart_failed"
+		if string(received.body) != want {
+			t.Errorf("got body %q, want %q", received.body, want)
+		}
+	}
+}
+
+func TestNtfyNotifierBasicAuth(t *testing.T) {
+	url, requests := startReceiver(t)
+	notifier := NewNtfyNotifier(appconfig.NtfyConfig{Name: "ntfy-0", URL: url, Username: "agent", Password: "secret", NotifyFilter: notifyFilter("", true)})
+	if err := notifier.Notify(context.Background(), firingEvent()); err != nil {
+		t.Fatal(err)
+	}
+	if header := nextRequest(t, requests).header.Get("Authorization"); header != "Basic YWdlbnQ6c2VjcmV0" {
+		t.Errorf("got Authorization %q", header)
+	}
+}
@@ -0,0 +1,117 @@
+package alert
+
+import (
+	"context"
+	"gama-client/internal/appconfig"
+	"gama-client/internal/diskinfo"
+	"net/http"
+	"time"
+)
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     time.Time         `json:"timestamp"`
+	Component     string            `json:"component"`
+	Group         string            `json:"group"`
+	Class         string            `json:"class"`
+	CustomDetails map[string]string `json:"custom_details"`
+}
+
+// PagerDutyNotifier triggers a PagerDuty incident per disk finding through
+// the Events API v2, deduplicated by host, disk and check, and resolves it
+// once the disk is healthy again or the finding changed.
+type PagerDutyNotifier struct {
+	name       string
+	url        string
+	routingKey string
+	critical   bool
+	client     *http.Client
+
+	// triggered is the dedup key of the incident open for each device.
+	// Notify is only called from the manager goroutine.
+	triggered map[string]string
+}
+
+func NewPagerDutyNotifier(config appconfig.PagerDutyConfig) *PagerDutyNotifier {
+	return &PagerDutyNotifier{
+		name:       config.Name,
+		url:        config.URL,
+		routingKey: config.RoutingKey,
+		critical:   config.MinSeverity == appconfig.SeverityCritical,
+		client:     &http.Client{Timeout: webhookTimeout},
+		triggered:  make(map[string]string),
+	}
+}
+
+func (n *PagerDutyNotifier) Name() string {
+	return n.name
+}
+
+func (n *PagerDutyNotifier) Notify(ctx context.Context, event Event) error {
+	key := pagerDutyDedupKey(event)
+	allowed := !n.critical || event.Severity() == appconfig.SeverityCritical
+	firing := allowed && !event.Resolved
+	var events []pagerDutyEvent
+	previous, ok := n.triggered[event.Device]
+	switch {
+	case ok && (!firing || previous != key):
+		events = append(events, n.resolve(previous))
+	case !ok && event.Resolved && (!n.critical || event.peak() == diskinfo.StatusError):
+		// The incident was triggered before a restart of the agent.
+		events = append(events, n.resolve(key))
+	}
+	if firing {
+		events = append(events, n.trigger(event, key))
+	}
+	for _, pagerDutyEvent := range events {
+		if err := postJSON(ctx, n.client, n.url, nil, pagerDutyEvent); err != nil {
+			return err
+		}
+	}
+	if firing {
+		n.triggered[event.Device] = key
+	} else {
+		delete(n.triggered, event.Device)
+	}
+	return nil
+}
+
+func pagerDutyDedupKey(event Event) string {
+	return "smp/" + event.Host + "/" + event.DiskID + "/" + event.Check
+}
+
+func (n *PagerDutyNotifier) resolve(key string) pagerDutyEvent {
+	return pagerDutyEvent{RoutingKey: n.routingKey, EventAction: "resolve", DedupKey: key}
+}
+
+func (n *PagerDutyNotifier) trigger(event Event, key string) pagerDutyEvent {
+	return pagerDutyEvent{
+		RoutingKey:  n.routingKey,
+		EventAction: "trigger",
+		DedupKey:    key,
+		Payload: &pagerDutyPayload{
+			Summary:   headline(event) + ": " + event.Condition,
+			Source:    event.Host,
+			Severity:  event.Severity(),
+			Timestamp: event.Time,
+			Component: event.Device,
+			Group:     event.Client,
+			Class:     event.Check,
+			CustomDetails: map[string]string{
+				"condition":  event.Condition,
+				"disk_id":    event.DiskID,
+				"old_status": string(event.OldStatus),
+				"new_status": string(event.NewStatus),
+			},
+		},
+	}
+}
@@ -0,0 +1,83 @@
+package alert
+
+import (
+	"context"
+	"gama-client/internal/appconfig"
+	"gama-client/internal/diskinfo"
+	"testing"
+)
+
+func TestPagerDutyNotifier(t *testing.T) {
+	url, requests := startReceiver(t, 202)
+	notifier := NewPagerDutyNotifier(appconfig.PagerDutyConfig{Name: "pagerduty-0", URL: url, RoutingKey: "R0UT1NG", MinSeverity: appconfig.SeverityCritical})
+	ctx := context.Background()
+
+	if err := notifier.Notify(ctx, firingEvent()); err != nil {
+		t.Fatal(err)
+	}
+	var trigger pagerDutyEvent
+	decode(t, nextRequest(t, requests), &trigger)
+	if trigger.RoutingKey != "R0UT1NG" || trigger.EventAction != "trigger" || trigger.DedupKey != "smp/web1/sdb/smart_failed" {
+		t.Errorf("got %+v", trigger)
+	}
+	payload := trigger.Payload
+	if payload == nil || payload.Severity != "critical" || payload.Source != "web1" || payload.Component != "/dev/sdb" ||
+		payload.Group != "acme" || payload.Class != diskinfo.CheckSMARTFailed || !payload.Timestamp.Equal(testTime) ||
+		payload.Summary != "/dev/sdb on web1 changed from Safe to Error: SMART status check failed" ||
+		payload.CustomDetails["new_status"] != "Error" || payload.CustomDetails["disk_id"] != "sdb" {
+		t.Errorf("got payload %+v", payload)
+	}
+
+	// A new finding resolves the incident of the previous one.
+	changed := firingEvent()
+	changed.OldStatus, changed.Check, changed.Condition = diskinfo.StatusError, diskinfo.CheckPendingSectors, "12 pending sectors"
+	if err := notifier.Notify(ctx, changed); err != nil {
+		t.Fatal(err)
+	}
+	var resolve, retrigger pagerDutyEvent
+	decode(t, nextRequest(t, requests), &resolve)
+	decode(t, nextRequest(t, requests), &retrigger)
+	if resolve.EventAction != "resolve" || resolve.DedupKey != "smp/web1/sdb/smart_failed" || resolve.Payload != nil {
+		t.Errorf("got %+v, want the smart_failed incident resolved", resolve)
+	}
+	if retrigger.EventAction != "trigger" || retrigger.DedupKey != "smp/web1/sdb/pending_sectors" {
+		t.Errorf("got %+v, want a pending_sectors incident", retrigger)
+	}
+
+	resolved := resolvedEvent()
+	resolved.Check = diskinfo.CheckPendingSectors
+	if err := notifier.Notify(ctx, resolved); err != nil {
+		t.Fatal(err)
+	}
+	decode(t, nextRequest(t, requests), &resolve)
+	if resolve.EventAction != "resolve" || resolve.DedupKey != "smp/web1/sdb/pending_sectors" {
+		t.Errorf("got %+v, want the pending_sectors incident resolved", resolve)
+	}
+	noRequest(t, requests)
+}
+
+func TestPagerDutyNotifierCriticalOnly(t *testing.T) {
+	url, requests := startReceiver(t, 202)
+	config := appconfig.PagerDutyConfig{Name: "pagerduty-0", URL: url, RoutingKey: "R0UT1NG", MinSeverity: appconfig.SeverityCritical}
+	notifier := NewPagerDutyNotifier(config)
+	ctx := context.Background()
+
+	warning := firingEvent()
+	warning.NewStatus, warning.PeakStatus, warning.Check = diskinfo.StatusWarning, diskinfo.StatusWarning, diskinfo.CheckWear
+	if err := notifier.Notify(ctx, warning); err != nil {
+		t.Fatal(err)
+	}
+	noRequest(t, requests)
+
+	// After a restart, the resolution of an incident triggered earlier is
+	// still sent.
+	restarted := NewPagerDutyNotifier(config)
+	if err := restarted.Notify(ctx, resolvedEvent()); err != nil {
+		t.Fatal(err)
+	}
+	var resolve pagerDutyEvent
+	decode(t, nextRequest(t, requests), &resolve)
+	if resolve.EventAction != "resolve" || resolve.DedupKey != "smp/web1/sdb/smart_failed" {
+		t.Errorf("got %+v", resolve)
+	}
+}
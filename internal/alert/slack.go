@@ -0,0 +1,88 @@
+package alert
+
+import (
+	"context"
+	"gama-client/internal/appconfig"
+	"gama-client/internal/diskinfo"
+	"net/http"
+	"time"
+)
+
+// slackColors are the attachment colors of the statuses, as hex values since
+// Mattermost does not know the Slack color names.
+var slackColors = map[diskinfo.StatusType]string{
+	diskinfo.StatusSafe:    "#2eb886",
+	diskinfo.StatusWarning: "#daa038",
+	diskinfo.StatusError:   "#a30200",
+}
+
+type slackMessage struct {
+	Channel     string            `json:"channel,omitempty"`
+	Username    string            `json:"username,omitempty"`
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+type slackAttachment struct {
+	Fallback string       `json:"fallback"`
+	Color    string       `json:"color"`
+	Text     string       `json:"text"`
+	Fields   []slackField `json:"fields"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// SlackNotifier posts the events to a Slack or Mattermost incoming webhook,
+// which share the message format.
+type SlackNotifier struct {
+	name     string
+	url      string
+	channel  string
+	username string
+	filter   filter
+	client   *http.Client
+}
+
+func NewSlackNotifier(config appconfig.SlackConfig) *SlackNotifier {
+	return &SlackNotifier{
+		name:     config.Name,
+		url:      config.URL,
+		channel:  config.Channel,
+		username: config.Username,
+		filter:   newFilter(config.NotifyFilter),
+		client:   &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+func (n *SlackNotifier) Name() string {
+	return n.name
+}
+
+func (n *SlackNotifier) Notify(ctx context.Context, event Event) error {
+	if !n.filter.allows(event) {
+		return nil
+	}
+	title := headline(event)
+	message := slackMessage{
+		Channel:  n.channel,
+		Username: n.username,
+		Text:     title,
+		Attachments: []slackAttachment{{
+			Fallback: title,
+			Color:    slackColors[event.NewStatus],
+			Text:     event.Condition,
+			Fields: []slackField{
+				{Title: "Host", Value: event.Host, Short: true},
+				{Title: "Client", Value: event.Client, Short: true},
+				{Title: "Device", Value: event.Device, Short: true},
+				{Title: "Check", Value: event.Check, Short: true},
+				{Title: "Time", Value: event.Time.Format(time.RFC1123Z)},
+			},
+		}},
+	}
+	return postJSON(ctx, n.client, n.url, nil, message)
+}
@@ -0,0 +1,52 @@
+package alert
+
+import (
+	"context"
+	"gama-client/internal/appconfig"
+	"testing"
+	"time"
+)
+
+func TestSlackNotifier(t *testing.T) {
+	url, requests := startReceiver(t)
+	notifier := NewSlackNotifier(appconfig.SlackConfig{Name: "slack-0", URL: url, Channel: "#storage", Username: "smp", NotifyFilter: notifyFilter("", true)})
+	tests := []struct {
+		event Event
+		text  string
+		color string
+	}{
+		{event: firingEvent(), text: "/dev/sdb on web1 changed from Safe to Error", color: "#a30200"},
+		{event: resolvedEvent(), text: "/dev/sdb on web1 is back to Safe", color: "#2eb886"},
+	}
+	for _, test := range tests {
+		if err := notifier.Notify(context.Background(), test.event); err != nil {
+			t.Fatal(err)
+		}
+		var message slackMessage
+		decode(t, nextRequest(t, requests), &message)
+		if message.Channel != "#storage" || message.Username != "smp" || message.Text != test.text || len(message.Attachments) != 1 {
+			t.Fatalf("got %+v", message)
+		}
+		attachment := message.Attachments[0]
+		if attachment.Fallback != test.text || attachment.Color != test.color || attachment.Text != test.event.Condition {
+			t.Errorf("got attachment %+v", attachment)
+		}
+		fields := make(map[string]string)
+		for _, field := range attachment.Fields {
+			fields[field.Title] = field.Value
+		}
+		if fields["Host"] != "web1" || fields["Client"] != "acme" || fields["Device"] != "/dev/sdb" || fields["Check"] != "smart_failed" ||
+			fields["Time"] != test.event.Time.Format(time.RFC1123Z) {
+			t.Errorf("got fields %v", fields)
+		}
+	}
+}
+
+func TestSlackNotifierWithoutResolved(t *testing.T) {
+	url, requests := startReceiver(t)
+	notifier := NewSlackNotifier(appconfig.SlackConfig{Name: "slack-0", URL: url, NotifyFilter: notifyFilter("", false)})
+	if err := notifier.Notify(context.Background(), resolvedEvent()); err != nil {
+		t.Fatal(err)
+	}
+	noRequest(t, requests)
+}
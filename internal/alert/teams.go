@@ -0,0 +1,87 @@
+package alert
+
+import (
+	"context"
+	"gama-client/internal/appconfig"
+	"gama-client/internal/diskinfo"
+	"net/http"
+	"time"
+)
+
+// teamsColors are the adaptive card colors of the statuses.
+var teamsColors = map[diskinfo.StatusType]string{
+	diskinfo.StatusSafe:    "good",
+	diskinfo.StatusWarning: "warning",
+	diskinfo.StatusError:   "attention",
+}
+
+// TeamsNotifier posts the events as adaptive cards to a Microsoft Teams
+// workflow webhook.
+type TeamsNotifier struct {
+	name   string
+	url    string
+	filter filter
+	client *http.Client
+}
+
+func NewTeamsNotifier(config appconfig.TeamsConfig) *TeamsNotifier {
+	return &TeamsNotifier{
+		name:   config.Name,
+		url:    config.URL,
+		filter: newFilter(config.NotifyFilter),
+		client: &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+func (n *TeamsNotifier) Name() string {
+	return n.name
+}
+
+func (n *TeamsNotifier) Notify(ctx context.Context, event Event) error {
+	if !n.filter.allows(event) {
+		return nil
+	}
+	fact := func(title, value string) map[string]string {
+		return map[string]string{"title": title, "value": value}
+	}
+	card := map[string]interface{}{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body": []interface{}{
+			map[string]interface{}{
+				"type":   "TextBlock",
+				"text":   headline(event),
+				"size":   "medium",
+				"weight": "bolder",
+				"color":  teamsColors[event.NewStatus],
+				"wrap":   true,
+			},
+			map[string]interface{}{
+				"type": "TextBlock",
+				"text": event.Condition,
+				"wrap": true,
+			},
+			map[string]interface{}{
+				"type": "FactSet",
+				"facts": []map[string]string{
+					fact("Host", event.Host),
+					fact("Client", event.Client),
+					fact("Device", event.Device),
+					fact("Check", event.Check),
+					fact("Time", event.Time.Format(time.RFC1123Z)),
+				},
+			},
+		},
+	}
+	message := map[string]interface{}{
+		"type": "message",
+		"attachments": []interface{}{
+			map[string]interface{}{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content":     card,
+			},
+		},
+	}
+	return postJSON(ctx, n.client, n.url, nil, message)
+}
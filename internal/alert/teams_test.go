@@ -0,0 +1,65 @@
+package alert
+
+import (
+	"context"
+	"gama-client/internal/appconfig"
+	"testing"
+)
+
+// teamsMessage is the part of the Teams message the tests check.
+type teamsMessage struct {
+	Type        string `json:"type"`
+	Attachments []struct {
+		ContentType string `json:"contentType"`
+		Content     struct {
+			Type string `json:"type"`
+			Body []struct {
+				Type  string `json:"type"`
+				Text  string `json:"text"`
+				Color string `json:"color"`
+				Facts []struct {
+					Title string `json:"title"`
+					Value string `json:"value"`
+				} `json:"facts"`
+			} `json:"body"`
+		} `json:"content"`
+	} `json:"attachments"`
+}
+
+func TestTeamsNotifier(t *testing.T) {
+	url, requests := startReceiver(t, 202)
+	notifier := NewTeamsNotifier(appconfig.TeamsConfig{Name: "teams-0", URL: url, NotifyFilter: notifyFilter("", true)})
+	tests := []struct {
+		event Event
+		text  string
+		color string
+	}{
+		{event: firingEvent(), text: "/dev/sdb on web1 changed from Safe to Error", color: "attention"},
+		{event: resolvedEvent(), text: "/dev/sdb on web1 is back to Safe", color: "good"},
+	}
+	for _, test := range tests {
+		if err := notifier.Notify(context.Background(), test.event); err != nil {
+			t.Fatal(err)
+		}
+		var message teamsMessage
+		decode(t, nextRequest(t, requests), &message)
+		if message.Type != "message" || len(message.Attachments) != 1 {
+			t.Fatalf("got %+v", message)
+		}
+		attachment := message.Attachments[0]
+		card := attachment.Content
+		if attachment.ContentType != "application/vnd.microsoft.card.adaptive" || card.Type != "AdaptiveCard" || len(card.Body) != 3 {
+			t.Fatalf("got attachment %+v", attachment)
+		}
+		if card.Body[0].Text != test.text || card.Body[0].Color != test.color || card.Body[1].Text != test.event.Condition {
+			t.Errorf("got card %+v", card.Body)
+		}
+		facts := make(map[string]string)
+		for _, fact := range card.Body[2].Facts {
+			facts[fact.Title] = fact.Value
+		}
+		if facts["Host"] != "web1" || facts["Client"] != "acme" || facts["Device"] != "/dev/sdb" || facts["Check"] != "smart_failed" {
+			t.Errorf("got facts %v", facts)
+		}
+	}
+}
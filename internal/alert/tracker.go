@@ -0,0 +1,302 @@
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"gama-client/internal/appconfig"
+	"gama-client/internal/diskinfo"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Policy decides when an observed status becomes an event.
+type Policy struct {
+	ConfirmCount            int
+	ResolveCount            int
+	MissingCount            int
+	TemperatureResolveBelow int
+	Renotify                time.Duration
+}
+
+func NewPolicy(config appconfig.AlertingConfig) Policy {
+	return Policy{
+		ConfirmCount:            config.ConfirmCount,
+		ResolveCount:            config.ResolveCount,
+		MissingCount:            config.MissingCount,
+		TemperatureResolveBelow: config.TemperatureResolveBelow,
+		Renotify:                time.Duration(config.RenotifyMinutes) * time.Minute,
+	}
+}
+
+// diskState is the confirmed alert of a disk and the observation waiting to
+// be confirmed. Peak is the most severe status notified since the disk left
+// StatusSafe.
+type diskState struct {
+	Status       diskinfo.StatusType `json:"status"`
+	Check        string              `json:"check"`
+	Condition    string              `json:"condition"`
+	Peak         diskinfo.StatusType `json:"peak,omitempty"`
+	Since        time.Time           `json:"since"`
+	LastNotified time.Time           `json:"last_notified"`
+
+	pendingStatus diskinfo.StatusType
+	pendingCheck  string
+	pendingCount  int
+	missingCount  int
+}
+
+// Tracker remembers the confirmed status of every disk. Disks seen for the
+// first time start as StatusSafe, so a disk already failing when the agent
+// starts raises an event, unless the state file says it was notified.
+//
+// An event is raised when the status or the check of a disk changes, and the
+// change was observed ConfirmCount times in a row (ResolveCount when going
+// back to StatusSafe). Changes of the condition text alone, such as a growing
+// error count, are not notified again. A disk missing from MissingCount
+// collections in a row is forgotten, and its alert resolved.
+type Tracker struct {
+	policy    Policy
+	stateFile string
+
+	mu    sync.Mutex
+	disks map[string]*diskState
+}
+
+func NewTracker(policy Policy, stateFile string) (*Tracker, error) {
+	tracker := &Tracker{policy: policy, stateFile: stateFile, disks: make(map[string]*diskState)}
+	if stateFile == "" {
+		return tracker, nil
+	}
+	content, err := os.ReadFile(stateFile)
+	if os.IsNotExist(err) {
+		return tracker, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alert state: %w", err)
+	}
+	if err := json.Unmarshal(content, &tracker.disks); err != nil {
+		return nil, fmt.Errorf("failed to parse alert state %s: %w", stateFile, err)
+	}
+	return tracker, nil
+}
+
+// Update records the statuses of a collection and returns the events to
+// notify.
+func (t *Tracker) Update(host, client string, disks []diskinfo.DiskInfo, now time.Time) ([]Event, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var events []Event
+	changed := false
+	for _, disk := range disks {
+		state, ok := t.disks[disk.DeviceName]
+		if ok {
+			state.missingCount = 0
+		} else {
+			state = &diskState{Status: diskinfo.StatusSafe, Check: diskinfo.CheckOK, Since: now}
+			t.disks[disk.DeviceName] = state
+			changed = true
+		}
+		event := Event{
+			Host:      host,
+			Client:    client,
+			Device:    disk.DeviceName,
+			DiskID:    diskinfo.DiskID(disk.DeviceName),
+			OldStatus: state.Status,
+			NewStatus: disk.Status,
+			Condition: disk.Condition,
+			Check:     disk.Check,
+			Time:      now,
+			Disk:      disk,
+		}
+		if disk.Status == diskinfo.StatusSafe {
+			event.Check = diskinfo.CheckOK
+		}
+
+		if t.holdsTemperature(state, disk) || (event.NewStatus == state.Status && event.Check == state.Check) {
+			state.pendingCount = 0
+			if state.Status == diskinfo.StatusSafe || t.policy.Renotify == 0 || now.Sub(state.LastNotified) < t.policy.Renotify {
+				continue
+			}
+			event.NewStatus, event.Check, event.Condition = state.Status, state.Check, state.Condition
+			event.PeakStatus = state.peak()
+			event.Renotify = true
+			state.LastNotified = now
+			events = append(events, event)
+			changed = true
+			continue
+		}
+
+		if event.NewStatus == state.pendingStatus && event.Check == state.pendingCheck {
+			state.pendingCount++
+		} else {
+			state.pendingStatus, state.pendingCheck, state.pendingCount = event.NewStatus, event.Check, 1
+		}
+		required := t.policy.ConfirmCount
+		if event.NewStatus == diskinfo.StatusSafe {
+			required = t.policy.ResolveCount
+		}
+		if state.pendingCount < required {
+			continue
+		}
+
+		event.Resolved = event.NewStatus == diskinfo.StatusSafe
+		event.PeakStatus = moreSevere(state.peak(), event.NewStatus)
+		if event.Resolved {
+			// The resolved event names the check that was firing.
+			event.Check = state.Check
+		}
+		*state = diskState{Status: disk.Status, Check: diskinfo.CheckOK, Condition: disk.Condition, Since: now, LastNotified: now}
+		if !event.Resolved {
+			state.Check = event.Check
+			state.Peak = event.PeakStatus
+		}
+		events = append(events, event)
+		changed = true
+	}
+	if resolved, expired := t.expireMissing(host, client, disks, now); expired {
+		events = append(events, resolved...)
+		changed = true
+	}
+	if !changed {
+		return events, nil
+	}
+	return events, t.save()
+}
+
+// expireMissing forgets the disks missing from the last MissingCount
+// collections and returns the resolved events of those firing, and whether
+// any disk was forgotten. A collection without any disk is a failed one and
+// is not counted.
+func (t *Tracker) expireMissing(host, client string, disks []diskinfo.DiskInfo, now time.Time) ([]Event, bool) {
+	if len(disks) == 0 {
+		return nil, false
+	}
+	seen := make(map[string]bool, len(disks))
+	for _, disk := range disks {
+		seen[disk.DeviceName] = true
+	}
+	var devices []string
+	for device, state := range t.disks {
+		if seen[device] {
+			continue
+		}
+		state.missingCount++
+		if state.missingCount >= t.policy.MissingCount {
+			devices = append(devices, device)
+		}
+	}
+	sort.Strings(devices)
+	var events []Event
+	for _, device := range devices {
+		state := t.disks[device]
+		delete(t.disks, device)
+		if state.Status == diskinfo.StatusSafe {
+			continue
+		}
+		events = append(events, Event{
+			Host:       host,
+			Client:     client,
+			Device:     device,
+			DiskID:     diskinfo.DiskID(device),
+			OldStatus:  state.Status,
+			NewStatus:  diskinfo.StatusSafe,
+			PeakStatus: state.peak(),
+			Condition:  "Disk is no longer reported",
+			Check:      state.Check,
+			Resolved:   true,
+			Time:       now,
+			Disk:       diskinfo.DiskInfo{DeviceName: device},
+		})
+	}
+	return events, len(devices) > 0
+}
+
+// Active returns the alerts firing, as of the time they started.
+func (t *Tracker) Active(host, client string) []Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var events []Event
+	for device, state := range t.disks {
+		if state.Status == diskinfo.StatusSafe {
+			continue
+		}
+		events = append(events, Event{
+			Host:       host,
+			Client:     client,
+			Device:     device,
+			DiskID:     diskinfo.DiskID(device),
+			OldStatus:  state.Status,
+			NewStatus:  state.Status,
+			PeakStatus: state.peak(),
+			Condition:  state.Condition,
+			Check:      state.Check,
+			Time:       state.Since,
+		})
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Device < events[j].Device })
+	return events
+}
+
+// peak is the most severe status notified for the alert of the disk. States
+// saved without it fall back to the current status.
+func (s *diskState) peak() diskinfo.StatusType {
+	return moreSevere(s.Peak, s.Status)
+}
+
+// moreSevere returns the most severe of the two statuses.
+func moreSevere(a, b diskinfo.StatusType) diskinfo.StatusType {
+	if (diskinfo.DiskInfo{Status: b}).StatusToInt() > (diskinfo.DiskInfo{Status: a}).StatusToInt() {
+		return b
+	}
+	return a
+}
+
+// holdsTemperature keeps a temperature alert firing while the disk has not
+// cooled below the resolve threshold, so a disk hovering around the alert
+// threshold does not flap.
+func (t *Tracker) holdsTemperature(state *diskState, disk diskinfo.DiskInfo) bool {
+	if state.Check != diskinfo.CheckTemperature || disk.TemperatureSource == "" {
+		return false
+	}
+	if disk.StatusToInt() > (diskinfo.DiskInfo{Status: state.Status}).StatusToInt() {
+		return false
+	}
+	if disk.Status != diskinfo.StatusSafe && disk.Check != diskinfo.CheckTemperature {
+		return false
+	}
+	return disk.Temperature >= t.policy.TemperatureResolveBelow
+}
+
+// save writes the confirmed states to the state file, through a temporary
+// file so a crash never leaves it truncated.
+func (t *Tracker) save() error {
+	if t.stateFile == "" {
+		return nil
+	}
+	content, err := json.MarshalIndent(t.disks, "", "  ")
+	if err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(t.stateFile), filepath.Base(t.stateFile)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save alert state: %w", err)
+	}
+	_, err = temp.Write(content)
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), t.stateFile)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return fmt.Errorf("failed to save alert state: %w", err)
+	}
+	return nil
+}
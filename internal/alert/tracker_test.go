@@ -0,0 +1,233 @@
+package alert
+
+import (
+	"gama-client/internal/diskinfo"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testPolicy() Policy {
+	return Policy{ConfirmCount: 1, ResolveCount: 1, MissingCount: 2, TemperatureResolveBelow: 65}
+}
+
+func failingDisk(device string) diskinfo.DiskInfo {
+	return diskinfo.DiskInfo{Status: diskinfo.StatusError, Check: diskinfo.CheckSMARTFailed, Condition: "SMART status check failed", DeviceName: device}
+}
+
+func safeDisk(device string) diskinfo.DiskInfo {
+	return diskinfo.DiskInfo{Status: diskinfo.StatusSafe, Check: diskinfo.CheckOK, Condition: "All checks passed", DeviceName: device}
+}
+
+func TestTrackerResolvesMissingDisks(t *testing.T) {
+	tracker, err := NewTracker(testPolicy(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	events, _ := tracker.Update("web1", "acme", []diskinfo.DiskInfo{failingDisk("/dev/sdb"), safeDisk("/dev/sda")}, now)
+	if len(events) != 1 || events[0].Resolved {
+		t.Fatalf("want one firing event, got %+v", events)
+	}
+
+	// A failed collection reports no disk and does not count.
+	if events, _ := tracker.Update("web1", "acme", nil, now.Add(time.Minute)); len(events) != 0 {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	if events, _ := tracker.Update("web1", "acme", []diskinfo.DiskInfo{safeDisk("/dev/sda")}, now.Add(2*time.Minute)); len(events) != 0 {
+		t.Fatalf("disk resolved before missing_count collections: %+v", events)
+	}
+	if active := tracker.Active("web1", "acme"); len(active) != 1 || active[0].Device != "/dev/sdb" {
+		t.Fatalf("want /dev/sdb firing, got %+v", active)
+	}
+
+	events, _ = tracker.Update("web1", "acme", []diskinfo.DiskInfo{safeDisk("/dev/sda")}, now.Add(3*time.Minute))
+	if len(events) != 1 {
+		t.Fatalf("want one resolved event, got %+v", events)
+	}
+	event := events[0]
+	if !event.Resolved || event.Device != "/dev/sdb" || event.Check != diskinfo.CheckSMARTFailed || event.OldStatus != diskinfo.StatusError {
+		t.Errorf("unexpected event %+v", event)
+	}
+	if active := tracker.Active("web1", "acme"); len(active) != 0 {
+		t.Errorf("missing disk still firing: %+v", active)
+	}
+}
+
+func TestTrackerKeepsDiskSeenAgain(t *testing.T) {
+	tracker, err := NewTracker(testPolicy(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	tracker.Update("web1", "acme", []diskinfo.DiskInfo{failingDisk("/dev/sdb"), safeDisk("/dev/sda")}, now)
+	tracker.Update("web1", "acme", []diskinfo.DiskInfo{safeDisk("/dev/sda")}, now.Add(time.Minute))
+	tracker.Update("web1", "acme", []diskinfo.DiskInfo{failingDisk("/dev/sdb"), safeDisk("/dev/sda")}, now.Add(2*time.Minute))
+	if events, _ := tracker.Update("web1", "acme", []diskinfo.DiskInfo{safeDisk("/dev/sda")}, now.Add(3*time.Minute)); len(events) != 0 {
+		t.Errorf("missing count not reset when the disk came back: %+v", events)
+	}
+}
+
+func hotDisk(device string, temperature int) diskinfo.DiskInfo {
+	return diskinfo.DiskInfo{Status: diskinfo.StatusWarning, Check: diskinfo.CheckTemperature, Condition: "Temperature is high",
+		DeviceName: device, Temperature: temperature, TemperatureSource: diskinfo.TemperatureSourceSMART}
+}
+
+func cooledDisk(device string, temperature int) diskinfo.DiskInfo {
+	disk := safeDisk(device)
+	disk.Temperature, disk.TemperatureSource = temperature, diskinfo.TemperatureSourceSMART
+	return disk
+}
+
+// states runs the collections of a disk through a tracker and returns the
+// state of each event raised, "" for none.
+func states(t *testing.T, policy Policy, collections ...diskinfo.DiskInfo) []string {
+	t.Helper()
+	tracker, err := NewTracker(policy, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	var got []string
+	for i, disk := range collections {
+		events, err := tracker.Update("web1", "acme", []diskinfo.DiskInfo{disk}, now.Add(time.Duration(i)*time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch len(events) {
+		case 0:
+			got = append(got, "")
+		case 1:
+			got = append(got, events[0].State()+" "+string(events[0].NewStatus))
+		default:
+			t.Fatalf("collection %d: got %+v", i, events)
+		}
+	}
+	return got
+}
+
+func TestTrackerConfirmsAndResolves(t *testing.T) {
+	policy := testPolicy()
+	policy.ConfirmCount, policy.ResolveCount = 2, 3
+	failed, safe, worn := failingDisk("/dev/sdb"), safeDisk("/dev/sdb"), failingDisk("/dev/sdb")
+	worn.Status, worn.Check = diskinfo.StatusWarning, diskinfo.CheckWear
+	tests := []struct {
+		name        string
+		collections []diskinfo.DiskInfo
+		want        []string
+	}{
+		{name: "confirm", collections: []diskinfo.DiskInfo{failed, failed, failed}, want: []string{"", "firing Error", ""}},
+		{name: "flap", collections: []diskinfo.DiskInfo{failed, safe, failed, safe, failed, worn, failed}, want: []string{"", "", "", "", "", "", ""}},
+		{name: "resolve", collections: []diskinfo.DiskInfo{failed, failed, safe, safe, safe, safe}, want: []string{"", "firing Error", "", "", "resolved Safe", ""}},
+		{name: "resolve interrupted", collections: []diskinfo.DiskInfo{failed, failed, safe, safe, failed, safe, safe}, want: []string{"", "firing Error", "", "", "", "", ""}},
+		{name: "change of check", collections: []diskinfo.DiskInfo{failed, failed, worn, worn}, want: []string{"", "firing Error", "", "firing Warning"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := states(t, policy, test.collections...); strings.Join(got, ",") != strings.Join(test.want, ",") {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTrackerTemperatureHysteresis(t *testing.T) {
+	failed := failingDisk("/dev/sdb")
+	failed.Temperature, failed.TemperatureSource = 70, diskinfo.TemperatureSourceSMART
+	unknown := safeDisk("/dev/sdb")
+	worn := hotDisk("/dev/sdb", 66)
+	worn.Check, worn.Condition = diskinfo.CheckWear, "Wear at 90%"
+	tests := []struct {
+		name        string
+		collections []diskinfo.DiskInfo
+		want        []string
+	}{
+		{name: "held above the resolve threshold", collections: []diskinfo.DiskInfo{hotDisk("/dev/sdb", 70), cooledDisk("/dev/sdb", 66), cooledDisk("/dev/sdb", 65), cooledDisk("/dev/sdb", 64)},
+			want: []string{"firing Warning", "", "", "resolved Safe"}},
+		{name: "escalation", collections: []diskinfo.DiskInfo{hotDisk("/dev/sdb", 70), failed}, want: []string{"firing Warning", "firing Error"}},
+		{name: "other finding", collections: []diskinfo.DiskInfo{hotDisk("/dev/sdb", 70), hotDisk("/dev/sdb", 66), worn}, want: []string{"firing Warning", "", "firing Warning"}},
+		{name: "temperature unknown", collections: []diskinfo.DiskInfo{hotDisk("/dev/sdb", 70), unknown}, want: []string{"firing Warning", "resolved Safe"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := states(t, testPolicy(), test.collections...); strings.Join(got, ",") != strings.Join(test.want, ",") {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTrackerRenotifies(t *testing.T) {
+	policy := testPolicy()
+	policy.Renotify = time.Hour
+	tracker, err := NewTracker(policy, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	tracker.Update("web1", "acme", []diskinfo.DiskInfo{failingDisk("/dev/sdb"), safeDisk("/dev/sda")}, now)
+	updated := failingDisk("/dev/sdb")
+	updated.Condition = "SMART status check failed again"
+	for _, test := range []struct {
+		after time.Duration
+		want  bool
+	}{
+		{after: 30 * time.Minute, want: false},
+		{after: 61 * time.Minute, want: true},
+		{after: 90 * time.Minute, want: false},
+		{after: 122 * time.Minute, want: true},
+	} {
+		events, _ := tracker.Update("web1", "acme", []diskinfo.DiskInfo{updated, safeDisk("/dev/sda")}, now.Add(test.after))
+		if !test.want {
+			if len(events) != 0 {
+				t.Errorf("after %s: unexpected events %+v", test.after, events)
+			}
+			continue
+		}
+		if len(events) != 1 || !events[0].Renotify || events[0].Device != "/dev/sdb" || events[0].NewStatus != diskinfo.StatusError {
+			t.Fatalf("after %s: want a renotification of /dev/sdb, got %+v", test.after, events)
+		}
+		// The renotification repeats the confirmed condition.
+		if events[0].Condition != "SMART status check failed" {
+			t.Errorf("after %s: got condition %q", test.after, events[0].Condition)
+		}
+	}
+}
+
+func TestTrackerState(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "alerts.json")
+	now := time.Unix(1700000000, 0)
+
+	// A missing state file starts empty.
+	tracker, err := NewTracker(testPolicy(), stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events, err := tracker.Update("web1", "acme", []diskinfo.DiskInfo{failingDisk("/dev/sdb"), safeDisk("/dev/sda")}, now); err != nil || len(events) != 1 {
+		t.Fatalf("got %+v, %v", events, err)
+	}
+
+	// The alert notified before the restart is not notified again.
+	restarted, err := NewTracker(testPolicy(), stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active := restarted.Active("web1", "acme"); len(active) != 1 || active[0].Device != "/dev/sdb" || !active[0].Time.Equal(now) {
+		t.Errorf("got active %+v", active)
+	}
+	if events, _ := restarted.Update("web1", "acme", []diskinfo.DiskInfo{failingDisk("/dev/sdb"), safeDisk("/dev/sda")}, now.Add(time.Minute)); len(events) != 0 {
+		t.Errorf("notified again after a restart: %+v", events)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(stateFile)); len(entries) != 1 {
+		t.Errorf("got %d files, want the state file only", len(entries))
+	}
+
+	if err := os.WriteFile(stateFile, []byte(`{"/dev/sdb": {"status": `), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewTracker(testPolicy(), stateFile); err == nil || !strings.Contains(err.Error(), "failed to parse alert state") {
+		t.Errorf("got %v for a corrupt state file", err)
+	}
+}
@@ -0,0 +1,123 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"gama-client/internal/appconfig"
+	"gama-client/internal/sink"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+const webhookTimeout = 20 * time.Second
+
+// templateFuncs are available to the payload templates. json quotes a value,
+// so that {{ json .Condition }} is always valid JSON.
+var templateFuncs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	},
+}
+
+// WebhookNotifier POSTs a JSON payload for every event.
+type WebhookNotifier struct {
+	name         string
+	url          string
+	headers      map[string]string
+	template     *template.Template
+	sendResolved bool
+	client       *http.Client
+}
+
+func NewWebhookNotifier(config appconfig.WebhookConfig) (*WebhookNotifier, error) {
+	notifier := &WebhookNotifier{
+		name:         config.Name,
+		url:          config.URL,
+		headers:      config.Headers,
+		sendResolved: *config.SendResolved,
+		client:       &http.Client{Timeout: webhookTimeout},
+	}
+	if config.Template != "" {
+		tmpl, err := template.New(config.Name).Funcs(templateFuncs).Parse(config.Template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template: %w", err)
+		}
+		notifier.template = tmpl
+	}
+	return notifier, nil
+}
+
+func (n *WebhookNotifier) Name() string {
+	return n.name
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, event Event) error {
+	if event.Resolved && !n.sendResolved {
+		return nil
+	}
+	body, err := n.payload(event)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range n.headers {
+		request.Header.Set(key, value)
+	}
+	return doRequest(n.client, request)
+}
+
+// doRequest sends a notification request. Network failures, 429 and 5xx
+// responses are retryable.
+func doRequest(client *http.Client, request *http.Request) error {
+	response, err := client.Do(request)
+	if err != nil {
+		return &sink.RetryableError{Err: err}
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return sink.ResponseError(response)
+	}
+	return nil
+}
+
+// postJSON sends payload as JSON with the given headers.
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	return doRequest(client, request)
+}
+
+func (n *WebhookNotifier) payload(event Event) ([]byte, error) {
+	if n.template == nil {
+		return json.Marshal(struct {
+			Event
+			State string `json:"state"`
+		}{event, event.State()})
+	}
+	var buffer bytes.Buffer
+	if err := n.template.Execute(&buffer, event); err != nil {
+		return nil, fmt.Errorf("failed to render template: %w", err)
+	}
+	if !json.Valid(buffer.Bytes()) {
+		return nil, fmt.Errorf("template did not render valid JSON")
+	}
+	return buffer.Bytes(), nil
+}
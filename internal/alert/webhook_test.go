@@ -0,0 +1,153 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"gama-client/internal/appconfig"
+	"gama-client/internal/sink"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func webhookConfig(url, template string, sendResolved bool) appconfig.WebhookConfig {
+	return appconfig.WebhookConfig{
+		Name:         "webhook-0",
+		URL:          url,
+		Headers:      map[string]string{"Authorization": "Bearer secret", "X-Source": "smp"},
+		Template:     template,
+		SendResolved: &sendResolved,
+	}
+}
+
+func TestWebhookNotifierDefaultPayload(t *testing.T) {
+	url, requests := startReceiver(t)
+	notifier, err := NewWebhookNotifier(webhookConfig(url, "", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		event    Event
+		state    string
+		resolved bool
+	}{
+		{event: firingEvent(), state: "firing"},
+		{event: resolvedEvent(), state: "resolved", resolved: true},
+	}
+	for _, test := range tests {
+		if err := notifier.Notify(context.Background(), test.event); err != nil {
+			t.Fatal(err)
+		}
+		received := nextRequest(t, requests)
+		if received.method != http.MethodPost || received.header.Get("Authorization") != "Bearer secret" || received.header.Get("X-Source") != "smp" {
+			t.Errorf("got %s with %v", received.method, received.header)
+		}
+		var payload struct {
+			Event
+			State string `json:"state"`
+		}
+		decode(t, received, &payload)
+		if payload.State != test.state || payload.Resolved != test.resolved || payload.Host != "web1" || payload.Device != "/dev/sdb" ||
+			payload.NewStatus != test.event.NewStatus || payload.PeakStatus != "Error" || !payload.Time.Equal(test.event.Time) {
+			t.Errorf("got %+v", payload)
+		}
+	}
+}
+
+func TestWebhookNotifierTemplate(t *testing.T) {
+	url, requests := startReceiver(t)
+	template := `{"text": {{ json .Condition }}, "device": {{ json .Device }}, "resolved": {{ .Resolved }}}`
+	notifier, err := NewWebhookNotifier(webhookConfig(url, template, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := firingEvent()
+	event.Condition = `Attribute "Reallocated_Sector_Ct" failing`
+	tests := []struct {
+		event    Event
+		resolved bool
+	}{
+		{event: event},
+		{event: resolvedEvent(), resolved: true},
+	}
+	for _, test := range tests {
+		if err := notifier.Notify(context.Background(), test.event); err != nil {
+			t.Fatal(err)
+		}
+		var payload struct {
+			Text     string `json:"text"`
+			Device   string `json:"device"`
+			Resolved bool   `json:"resolved"`
+		}
+		decode(t, nextRequest(t, requests), &payload)
+		if payload.Text != test.event.Condition || payload.Device != "/dev/sdb" || payload.Resolved != test.resolved {
+			t.Errorf("got %+v", payload)
+		}
+	}
+}
+
+func TestWebhookNotifierInvalidTemplate(t *testing.T) {
+	url, requests := startReceiver(t)
+	if _, err := NewWebhookNotifier(webhookConfig(url, `{"text": {{ .Condition }`, true)); err == nil {
+		t.Error("got no error for a template that does not parse")
+	}
+	notifier, err := NewWebhookNotifier(webhookConfig(url, `{"text": {{ .Condition }}}`, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := notifier.Notify(context.Background(), firingEvent()); err == nil {
+		t.Error("got no error for a template that renders invalid JSON")
+	}
+	noRequest(t, requests)
+}
+
+func TestWebhookNotifierWithoutResolved(t *testing.T) {
+	url, requests := startReceiver(t)
+	notifier, err := NewWebhookNotifier(webhookConfig(url, "", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := notifier.Notify(context.Background(), resolvedEvent()); err != nil {
+		t.Fatal(err)
+	}
+	noRequest(t, requests)
+}
+
+func TestWebhookNotifierRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		statuses  []int
+		attempts  int
+		retryable bool
+	}{
+		{name: "server error", statuses: []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK}, attempts: 3},
+		{name: "too many requests", statuses: []int{http.StatusTooManyRequests, http.StatusOK}, attempts: 2},
+		{name: "persistent server error", statuses: []int{http.StatusInternalServerError}, attempts: 3, retryable: true},
+		{name: "client error", statuses: []int{http.StatusBadRequest}, attempts: 1},
+		{name: "not found", statuses: []int{http.StatusNotFound}, attempts: 1},
+	}
+	policy := sink.RetryPolicy{MaxAttempts: 3, InitialInterval: time.Millisecond, MaxInterval: time.Millisecond}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			url, requests := startReceiver(t, test.statuses...)
+			notifier, err := NewWebhookNotifier(webhookConfig(url, "", true))
+			if err != nil {
+				t.Fatal(err)
+			}
+			attempts, err := policy.Do(context.Background(), func() error {
+				return notifier.Notify(context.Background(), firingEvent())
+			})
+			if attempts != test.attempts || len(requests) != test.attempts {
+				t.Errorf("got %d attempts and %d requests, want %d", attempts, len(requests), test.attempts)
+			}
+			success := test.statuses[len(test.statuses)-1] == http.StatusOK
+			if success != (err == nil) {
+				t.Fatalf("got %v", err)
+			}
+			var retryable *sink.RetryableError
+			if err != nil && errors.As(err, &retryable) != test.retryable {
+				t.Errorf("got %v, want retryable %v", err, test.retryable)
+			}
+		})
+	}
+}
@@ -3,29 +3,834 @@ package appconfig
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
+	"path"
+	"strings"
 )
 
+// Sink types.
+const (
+	SinkInfluxDB     = "influxdb"
+	SinkInfluxDBV1   = "influxdb_v1"
+	SinkLineProtocol = "line_protocol"
+	SinkOTLP         = "otlp"
+	SinkMQTT         = "mqtt"
+	SinkPrometheus   = "prometheus"
+	SinkHistory      = "history"
+)
+
+// AlertingSinkName is the name under which the alert manager receives the
+// routed results; no configured sink may use it.
+const AlertingSinkName = "alerting"
+
 type InfluxTagsConfig struct {
 	Host   string `json:"host"`
 	Client string `json:"client"`
 }
 
-type AppConfig struct {
-	InfluxURL    string           `json:"influx_url"`
-	InfluxOrg    string           `json:"influx_org"`
-	InfluxBucket string           `json:"influx_bucket"`
-	InfluxToken  string           `json:"influx_token"`
-	InfluxTags   InfluxTagsConfig `json:"influx_tags"`
+type InfluxConfig struct {
+	InfluxURL     string        `json:"influx_url"`
+	InfluxOrg     string        `json:"influx_org"`
+	InfluxBucket  string        `json:"influx_bucket"`
+	InfluxToken   string        `json:"influx_token"`
+	InfluxOptions InfluxOptions `json:"influx_options"`
+	SpoolConfig
 }
 
-func (c *AppConfig) validateConfig() error {
+func (c *InfluxConfig) validateConfig() error {
 	if c.InfluxURL == "" {
 		return fmt.Errorf("InfluxURL is empty")
 	}
 	if c.InfluxToken == "" {
 		return fmt.Errorf("InfluxToken is empty")
 	}
+	if err := c.InfluxOptions.validateConfig(); err != nil {
+		return fmt.Errorf("influx_options: %v", err)
+	}
+	return c.SpoolConfig.validateConfig()
+}
+
+// Influx timestamp precisions.
+const (
+	PrecisionNanoseconds  = "ns"
+	PrecisionMicroseconds = "us"
+	PrecisionMilliseconds = "ms"
+	PrecisionSeconds      = "s"
+)
+
+// InfluxOptions tunes the HTTP connection to InfluxDB: a CA bundle added to
+// the system roots, a client certificate, an HTTP proxy (the environment
+// proxy settings otherwise), gzip compressed writes, the timestamp precision
+// (ns by default) and the timeout of a request (20 seconds by default).
+type InfluxOptions struct {
+	CAFile             string `json:"ca_file"`
+	CertFile           string `json:"cert_file"`
+	KeyFile            string `json:"key_file"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+	ProxyURL           string `json:"proxy_url"`
+	Gzip               bool   `json:"gzip"`
+	Precision          string `json:"precision"`
+	TimeoutSeconds     int    `json:"timeout_seconds"`
+}
+
+func (c *InfluxOptions) validateConfig() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("cert_file and key_file must be set together")
+	}
+	if c.ProxyURL != "" {
+		if _, err := url.Parse(c.ProxyURL); err != nil {
+			return fmt.Errorf("invalid proxy_url: %v", err)
+		}
+	}
+	switch c.Precision {
+	case "":
+		c.Precision = PrecisionNanoseconds
+	case PrecisionNanoseconds, PrecisionMicroseconds, PrecisionMilliseconds, PrecisionSeconds:
+	default:
+		return fmt.Errorf("unknown precision %q", c.Precision)
+	}
+	if c.TimeoutSeconds < 0 {
+		return fmt.Errorf("timeout_seconds must not be negative")
+	}
+	if c.TimeoutSeconds == 0 {
+		c.TimeoutSeconds = 20
+	}
+	return nil
+}
+
+// SpoolConfig enables the disk buffer of the line protocol batches that could
+// not be written. It holds at most SpoolMaxMB (100 by default) and drops
+// batches older than SpoolMaxAgeHours (72 by default).
+type SpoolConfig struct {
+	SpoolDir         string `json:"influx_spool_dir"`
+	SpoolMaxMB       int    `json:"influx_spool_max_mb"`
+	SpoolMaxAgeHours int    `json:"influx_spool_max_age_hours"`
+}
+
+func (c *SpoolConfig) validateConfig() error {
+	if c.SpoolMaxMB < 0 || c.SpoolMaxAgeHours < 0 {
+		return fmt.Errorf("spool limits must not be negative")
+	}
+	if c.SpoolMaxMB == 0 {
+		c.SpoolMaxMB = 100
+	}
+	if c.SpoolMaxAgeHours == 0 {
+		c.SpoolMaxAgeHours = 72
+	}
+	return nil
+}
+
+// InfluxV1Config selects the database of an InfluxDB 1.x server, whose URL is
+// influx_url. The retention policy and credentials are optional.
+type InfluxV1Config struct {
+	InfluxDatabase        string `json:"influx_database"`
+	InfluxRetentionPolicy string `json:"influx_retention_policy"`
+	InfluxUsername        string `json:"influx_username"`
+	InfluxPassword        string `json:"influx_password"`
+}
+
+// LineProtocolConfig is the address raw line protocol is sent to, as
+// udp://host:port, tcp://host:port or unix:///path/to/socket.
+type LineProtocolConfig struct {
+	Address string `json:"address"`
+}
+
+func (c LineProtocolConfig) validateConfig() error {
+	network, address, ok := strings.Cut(c.Address, "://")
+	if !ok || address == "" {
+		return fmt.Errorf("address must be udp://, tcp:// or unix://")
+	}
+	switch network {
+	case "udp", "tcp", "unix":
+		return nil
+	default:
+		return fmt.Errorf("unsupported address scheme %q", network)
+	}
+}
+
+// OTLP transport protocols.
+const (
+	OTLPProtocolGRPC = "grpc"
+	OTLPProtocolHTTP = "http/protobuf"
+)
+
+// OTLPConfig is an OpenTelemetry collector receiving the metrics over gRPC
+// (host:4317) or HTTP/protobuf (http://host:4318). gRPC uses TLS unless
+// OTLPInsecure is set.
+type OTLPConfig struct {
+	OTLPEndpoint string            `json:"otlp_endpoint"`
+	OTLPProtocol string            `json:"otlp_protocol"`
+	OTLPInsecure bool              `json:"otlp_insecure"`
+	OTLPHeaders  map[string]string `json:"otlp_headers"`
+}
+
+func (c *OTLPConfig) validateConfig() error {
+	if c.OTLPEndpoint == "" {
+		return fmt.Errorf("otlp_endpoint is empty")
+	}
+	switch c.OTLPProtocol {
+	case "":
+		c.OTLPProtocol = OTLPProtocolGRPC
+	case OTLPProtocolGRPC:
+	case OTLPProtocolHTTP:
+		if !strings.HasPrefix(c.OTLPEndpoint, "http://") && !strings.HasPrefix(c.OTLPEndpoint, "https://") {
+			return fmt.Errorf("otlp_endpoint must be an http:// or https:// URL")
+		}
+	default:
+		return fmt.Errorf("unknown otlp_protocol %q", c.OTLPProtocol)
+	}
+	return nil
+}
+
+// MQTTConfig is the broker receiving the per-disk state, as tcp://host:1883 or
+// ssl://host:8883. Messages are retained and published with QoS 1 unless
+// configured otherwise.
+type MQTTConfig struct {
+	MQTTBroker             string `json:"mqtt_broker"`
+	MQTTClientID           string `json:"mqtt_client_id"`
+	MQTTUsername           string `json:"mqtt_username"`
+	MQTTPassword           string `json:"mqtt_password"`
+	MQTTTopicPrefix        string `json:"mqtt_topic_prefix"`
+	MQTTQoS                *byte  `json:"mqtt_qos"`
+	MQTTRetain             *bool  `json:"mqtt_retain"`
+	MQTTCAFile             string `json:"mqtt_ca_file"`
+	MQTTCertFile           string `json:"mqtt_cert_file"`
+	MQTTKeyFile            string `json:"mqtt_key_file"`
+	MQTTInsecureSkipVerify bool   `json:"mqtt_insecure_skip_verify"`
+}
+
+func (c *MQTTConfig) validateConfig() error {
+	if c.MQTTBroker == "" {
+		return fmt.Errorf("mqtt_broker is empty")
+	}
+	if c.MQTTTopicPrefix == "" {
+		c.MQTTTopicPrefix = "smp"
+	}
+	if strings.ContainsAny(c.MQTTTopicPrefix, "+#") {
+		return fmt.Errorf("mqtt_topic_prefix must not contain wildcards")
+	}
+	if c.MQTTQoS == nil {
+		qos := byte(1)
+		c.MQTTQoS = &qos
+	} else if *c.MQTTQoS > 2 {
+		return fmt.Errorf("mqtt_qos must be 0, 1 or 2")
+	}
+	if c.MQTTRetain == nil {
+		retain := true
+		c.MQTTRetain = &retain
+	}
+	if (c.MQTTCertFile == "") != (c.MQTTKeyFile == "") {
+		return fmt.Errorf("mqtt_cert_file and mqtt_key_file must be set together")
+	}
+	return nil
+}
+
+type PrometheusConfig struct {
+	// ListenAddress defaults to :9712 and MetricsPath to /metrics.
+	ListenAddress string `json:"listen_address"`
+	MetricsPath   string `json:"metrics_path"`
+}
+
+func (c *PrometheusConfig) validateConfig() error {
+	if c.ListenAddress == "" {
+		c.ListenAddress = ":9712"
+	}
+	if c.MetricsPath == "" {
+		c.MetricsPath = "/metrics"
+	}
+	if c.MetricsPath[0] != '/' {
+		return fmt.Errorf("metrics_path must start with /")
+	}
+	return nil
+}
+
+// HistoryConfig keeps the disk classifications and SMART attributes in a
+// SQLite database at HistoryPath, at most once every HistoryIntervalSeconds
+// (60 by default), and serves them on HistoryListenAddress (127.0.0.1:9713 by
+// default). Rows older than HistoryRetentionDays (7 by default) are merged
+// into buckets of HistoryDownsampleMinutes (60 by default), kept for
+// HistoryDownsampleRetentionDays (365 by default).
+type HistoryConfig struct {
+	HistoryPath                    string `json:"history_path"`
+	HistoryListenAddress           string `json:"history_listen_address"`
+	HistoryIntervalSeconds         int    `json:"history_interval_seconds"`
+	HistoryRetentionDays           int    `json:"history_retention_days"`
+	HistoryDownsampleMinutes       int    `json:"history_downsample_minutes"`
+	HistoryDownsampleRetentionDays int    `json:"history_downsample_retention_days"`
+}
+
+func (c *HistoryConfig) validateConfig() error {
+	if c.HistoryPath == "" {
+		return fmt.Errorf("history_path is empty")
+	}
+	if c.HistoryIntervalSeconds < 0 || c.HistoryRetentionDays < 0 || c.HistoryDownsampleMinutes < 0 || c.HistoryDownsampleRetentionDays < 0 {
+		return fmt.Errorf("history limits must not be negative")
+	}
+	if c.HistoryListenAddress == "" {
+		c.HistoryListenAddress = "127.0.0.1:9713"
+	}
+	if c.HistoryIntervalSeconds == 0 {
+		c.HistoryIntervalSeconds = 60
+	}
+	if c.HistoryRetentionDays == 0 {
+		c.HistoryRetentionDays = 7
+	}
+	if c.HistoryDownsampleMinutes == 0 {
+		c.HistoryDownsampleMinutes = 60
+	}
+	if c.HistoryDownsampleRetentionDays == 0 {
+		c.HistoryDownsampleRetentionDays = 365
+	}
+	if c.HistoryDownsampleRetentionDays < c.HistoryRetentionDays {
+		return fmt.Errorf("history_downsample_retention_days must not be shorter than history_retention_days")
+	}
+	return nil
+}
+
+// SinkConfig is an output receiving every collection. Only the settings of
+// its type are used.
+type SinkConfig struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	InfluxConfig
+	InfluxV1Config
+	LineProtocolConfig
+	OTLPConfig
+	MQTTConfig
+	PrometheusConfig
+	HistoryConfig
+}
+
+func (c *SinkConfig) validateConfig() error {
+	switch c.Type {
+	case SinkInfluxDB:
+		return c.InfluxConfig.validateConfig()
+	case SinkInfluxDBV1:
+		if c.InfluxURL == "" {
+			return fmt.Errorf("InfluxURL is empty")
+		}
+		if c.InfluxDatabase == "" {
+			return fmt.Errorf("InfluxDatabase is empty")
+		}
+		if err := c.InfluxOptions.validateConfig(); err != nil {
+			return fmt.Errorf("influx_options: %v", err)
+		}
+		return c.SpoolConfig.validateConfig()
+	case SinkLineProtocol:
+		if err := c.LineProtocolConfig.validateConfig(); err != nil {
+			return err
+		}
+		return c.SpoolConfig.validateConfig()
+	case SinkOTLP:
+		return c.OTLPConfig.validateConfig()
+	case SinkMQTT:
+		return c.MQTTConfig.validateConfig()
+	case SinkPrometheus:
+		return c.PrometheusConfig.validateConfig()
+	case SinkHistory:
+		return c.HistoryConfig.validateConfig()
+	case "":
+		return fmt.Errorf("type is empty")
+	default:
+		return fmt.Errorf("unknown type %q", c.Type)
+	}
+}
+
+// WebhookConfig is an endpoint receiving a POST for every status transition.
+// Template is a Go text/template rendering the JSON body from the alert
+// event; the event itself is sent as JSON without one. Resolved notifications
+// are sent unless SendResolved is false.
+type WebhookConfig struct {
+	Name         string            `json:"name"`
+	URL          string            `json:"url"`
+	Headers      map[string]string `json:"headers"`
+	Template     string            `json:"template"`
+	SendResolved *bool             `json:"send_resolved"`
+}
+
+func (c *WebhookConfig) validateConfig() error {
+	if c.URL == "" {
+		return fmt.Errorf("url is empty")
+	}
+	if c.SendResolved == nil {
+		sendResolved := true
+		c.SendResolved = &sendResolved
+	}
+	return nil
+}
+
+// SMTP security modes.
+const (
+	SMTPStartTLS = "starttls"
+	SMTPTLS      = "tls"
+	SMTPNone     = "none"
+)
+
+// EmailConfig sends a report of the status transitions through an SMTP
+// server, using STARTTLS on port 587 unless configured otherwise. With
+// DigestMinutes, the transitions are collected and sent together at most once
+// per interval.
+type EmailConfig struct {
+	Name                   string   `json:"name"`
+	SMTPHost               string   `json:"smtp_host"`
+	SMTPPort               int      `json:"smtp_port"`
+	SMTPSecurity           string   `json:"smtp_security"`
+	SMTPUsername           string   `json:"smtp_username"`
+	SMTPPassword           string   `json:"smtp_password"`
+	SMTPInsecureSkipVerify bool     `json:"smtp_insecure_skip_verify"`
+	From                   string   `json:"from"`
+	To                     []string `json:"to"`
+	DigestMinutes          int      `json:"digest_minutes"`
+	SendResolved           *bool    `json:"send_resolved"`
+}
+
+func (c *EmailConfig) validateConfig() error {
+	if c.SMTPHost == "" {
+		return fmt.Errorf("smtp_host is empty")
+	}
+	if c.From == "" {
+		return fmt.Errorf("from is empty")
+	}
+	if len(c.To) == 0 {
+		return fmt.Errorf("to is empty")
+	}
+	switch c.SMTPSecurity {
+	case "":
+		c.SMTPSecurity = SMTPStartTLS
+	case SMTPStartTLS, SMTPTLS, SMTPNone:
+	default:
+		return fmt.Errorf("unknown smtp_security %q", c.SMTPSecurity)
+	}
+	if c.SMTPPort == 0 {
+		c.SMTPPort = 587
+		if c.SMTPSecurity == SMTPTLS {
+			c.SMTPPort = 465
+		}
+	}
+	if c.DigestMinutes < 0 {
+		return fmt.Errorf("digest_minutes must not be negative")
+	}
+	if c.SendResolved == nil {
+		sendResolved := true
+		c.SendResolved = &sendResolved
+	}
+	return nil
+}
+
+// AlertmanagerConfig is a Prometheus Alertmanager receiving the active disk
+// alerts on /api/v2/alerts. They are pushed again every RefreshSeconds (60 by
+// default) while active. Labels are added to every alert.
+type AlertmanagerConfig struct {
+	Name           string            `json:"name"`
+	URL            string            `json:"url"`
+	Username       string            `json:"username"`
+	Password       string            `json:"password"`
+	Headers        map[string]string `json:"headers"`
+	Labels         map[string]string `json:"labels"`
+	RefreshSeconds int               `json:"refresh_seconds"`
+}
+
+func (c *AlertmanagerConfig) validateConfig() error {
+	if c.URL == "" {
+		return fmt.Errorf("url is empty")
+	}
+	if c.RefreshSeconds < 0 {
+		return fmt.Errorf("refresh_seconds must not be negative")
+	}
+	if c.RefreshSeconds == 0 {
+		c.RefreshSeconds = 60
+	}
+	return nil
+}
+
+// Alert severities, warning for disks in Warning and critical for disks in
+// Error.
+const (
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+func validateSeverity(severity *string) error {
+	switch *severity {
+	case "":
+		*severity = SeverityWarning
+	case SeverityWarning, SeverityCritical:
+	default:
+		return fmt.Errorf("unknown min_severity %q", *severity)
+	}
+	return nil
+}
+
+// NotifyFilter selects the events of a notifier: MinSeverity critical only
+// delivers the alerts of disks in Error, and their downgrades and resolution.
+// Resolved notifications are sent unless SendResolved is false.
+type NotifyFilter struct {
+	MinSeverity  string `json:"min_severity"`
+	SendResolved *bool  `json:"send_resolved"`
+}
+
+func (c *NotifyFilter) validateFilter() error {
+	if c.SendResolved == nil {
+		sendResolved := true
+		c.SendResolved = &sendResolved
+	}
+	return validateSeverity(&c.MinSeverity)
+}
+
+// SlackConfig is a Slack or Mattermost incoming webhook. Channel and Username
+// override the defaults of the webhook.
+type SlackConfig struct {
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Channel  string `json:"channel"`
+	Username string `json:"username"`
+	NotifyFilter
+}
+
+func (c *SlackConfig) validateConfig() error {
+	if c.URL == "" {
+		return fmt.Errorf("url is empty")
+	}
+	return c.validateFilter()
+}
+
+// TeamsConfig is a Microsoft Teams workflow webhook receiving adaptive cards.
+type TeamsConfig struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	NotifyFilter
+}
+
+func (c *TeamsConfig) validateConfig() error {
+	if c.URL == "" {
+		return fmt.Errorf("url is empty")
+	}
+	return c.validateFilter()
+}
+
+// PagerDutyConfig is a PagerDuty Events API v2 integration. Incidents are
+// always resolved once the disk is healthy again.
+type PagerDutyConfig struct {
+	Name        string `json:"name"`
+	RoutingKey  string `json:"routing_key"`
+	URL         string `json:"url"`
+	MinSeverity string `json:"min_severity"`
+}
+
+func (c *PagerDutyConfig) validateConfig() error {
+	if c.RoutingKey == "" {
+		return fmt.Errorf("routing_key is empty")
+	}
+	if c.URL == "" {
+		c.URL = "https://events.pagerduty.com/v2/enqueue"
+	}
+	return validateSeverity(&c.MinSeverity)
+}
+
+// NtfyConfig is an ntfy topic URL, such as https://ntfy.sh/disks, with either
+// an access token or a username and password.
+type NtfyConfig struct {
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Token    string `json:"token"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	NotifyFilter
+}
+
+func (c *NtfyConfig) validateConfig() error {
+	if c.URL == "" {
+		return fmt.Errorf("url is empty")
+	}
+	return c.validateFilter()
+}
+
+// GotifyConfig is a Gotify server and the token of its application.
+type GotifyConfig struct {
+	Name  string `json:"name"`
+	URL   string `json:"url"`
+	Token string `json:"token"`
+	NotifyFilter
+}
+
+func (c *GotifyConfig) validateConfig() error {
+	if c.URL == "" {
+		return fmt.Errorf("url is empty")
+	}
+	if c.Token == "" {
+		return fmt.Errorf("token is empty")
+	}
+	return c.validateFilter()
+}
+
+// AlertingConfig lists the notifiers of disk status transitions and the
+// policy deciding when a transition is notified. A status must be observed
+// ConfirmCount times in a row (3 by default) to fire and ResolveCount times
+// (3 by default) to resolve. The alerts of a disk missing from MissingCount
+// collections in a row (3 by default) are resolved. Temperature alerts only
+// resolve below TemperatureResolveBelow (65°C by default). Alerts still firing
+// are notified again every RenotifyMinutes, never when 0. StateFile keeps the
+// alert state across restarts.
+type AlertingConfig struct {
+	Webhooks                []WebhookConfig      `json:"webhooks"`
+	Emails                  []EmailConfig        `json:"emails"`
+	Alertmanagers           []AlertmanagerConfig `json:"alertmanagers"`
+	Slack                   []SlackConfig        `json:"slack"`
+	Teams                   []TeamsConfig        `json:"teams"`
+	PagerDuty               []PagerDutyConfig    `json:"pagerduty"`
+	Ntfy                    []NtfyConfig         `json:"ntfy"`
+	Gotify                  []GotifyConfig       `json:"gotify"`
+	ConfirmCount            int                  `json:"confirm_count"`
+	ResolveCount            int                  `json:"resolve_count"`
+	MissingCount            int                  `json:"missing_count"`
+	TemperatureResolveBelow int                  `json:"temperature_resolve_below"`
+	RenotifyMinutes         int                  `json:"renotify_minutes"`
+	StateFile               string               `json:"state_file"`
+}
+
+func (c *AlertingConfig) validateConfig() error {
+	if c.ConfirmCount < 0 || c.ResolveCount < 0 || c.MissingCount < 0 || c.RenotifyMinutes < 0 || c.TemperatureResolveBelow < 0 {
+		return fmt.Errorf("alerting policy values must not be negative")
+	}
+	if c.ConfirmCount == 0 {
+		c.ConfirmCount = 3
+	}
+	if c.ResolveCount == 0 {
+		c.ResolveCount = 3
+	}
+	if c.MissingCount == 0 {
+		c.MissingCount = 3
+	}
+	if c.TemperatureResolveBelow == 0 {
+		c.TemperatureResolveBelow = 65
+	}
+	for i := range c.Webhooks {
+		webhook := &c.Webhooks[i]
+		if webhook.Name == "" {
+			webhook.Name = fmt.Sprintf("webhook-%d", i)
+		}
+		if err := webhook.validateConfig(); err != nil {
+			return fmt.Errorf("webhook %q: %v", webhook.Name, err)
+		}
+	}
+	for i := range c.Emails {
+		email := &c.Emails[i]
+		if email.Name == "" {
+			email.Name = fmt.Sprintf("email-%d", i)
+		}
+		if err := email.validateConfig(); err != nil {
+			return fmt.Errorf("email %q: %v", email.Name, err)
+		}
+	}
+	for i := range c.Alertmanagers {
+		alertmanager := &c.Alertmanagers[i]
+		if alertmanager.Name == "" {
+			alertmanager.Name = fmt.Sprintf("alertmanager-%d", i)
+		}
+		if err := alertmanager.validateConfig(); err != nil {
+			return fmt.Errorf("alertmanager %q: %v", alertmanager.Name, err)
+		}
+	}
+	for i := range c.Slack {
+		slack := &c.Slack[i]
+		if slack.Name == "" {
+			slack.Name = fmt.Sprintf("slack-%d", i)
+		}
+		if err := slack.validateConfig(); err != nil {
+			return fmt.Errorf("slack %q: %v", slack.Name, err)
+		}
+	}
+	for i := range c.Teams {
+		teams := &c.Teams[i]
+		if teams.Name == "" {
+			teams.Name = fmt.Sprintf("teams-%d", i)
+		}
+		if err := teams.validateConfig(); err != nil {
+			return fmt.Errorf("teams %q: %v", teams.Name, err)
+		}
+	}
+	for i := range c.PagerDuty {
+		pagerDuty := &c.PagerDuty[i]
+		if pagerDuty.Name == "" {
+			pagerDuty.Name = fmt.Sprintf("pagerduty-%d", i)
+		}
+		if err := pagerDuty.validateConfig(); err != nil {
+			return fmt.Errorf("pagerduty %q: %v", pagerDuty.Name, err)
+		}
+	}
+	for i := range c.Ntfy {
+		ntfy := &c.Ntfy[i]
+		if ntfy.Name == "" {
+			ntfy.Name = fmt.Sprintf("ntfy-%d", i)
+		}
+		if err := ntfy.validateConfig(); err != nil {
+			return fmt.Errorf("ntfy %q: %v", ntfy.Name, err)
+		}
+	}
+	for i := range c.Gotify {
+		gotify := &c.Gotify[i]
+		if gotify.Name == "" {
+			gotify.Name = fmt.Sprintf("gotify-%d", i)
+		}
+		if err := gotify.validateConfig(); err != nil {
+			return fmt.Errorf("gotify %q: %v", gotify.Name, err)
+		}
+	}
+	names := make(map[string]bool)
+	for _, name := range c.NotifierNames() {
+		if names[name] {
+			return fmt.Errorf("notifier name %q is duplicated", name)
+		}
+		names[name] = true
+	}
+	return nil
+}
+
+// NotifierNames returns the names of the configured notifiers.
+func (c *AlertingConfig) NotifierNames() []string {
+	var names []string
+	for _, webhook := range c.Webhooks {
+		names = append(names, webhook.Name)
+	}
+	for _, email := range c.Emails {
+		names = append(names, email.Name)
+	}
+	for _, alertmanager := range c.Alertmanagers {
+		names = append(names, alertmanager.Name)
+	}
+	for _, slack := range c.Slack {
+		names = append(names, slack.Name)
+	}
+	for _, teams := range c.Teams {
+		names = append(names, teams.Name)
+	}
+	for _, pagerDuty := range c.PagerDuty {
+		names = append(names, pagerDuty.Name)
+	}
+	for _, ntfy := range c.Ntfy {
+		names = append(names, ntfy.Name)
+	}
+	for _, gotify := range c.Gotify {
+		names = append(names, gotify.Name)
+	}
+	return names
+}
+
+// RouteMatch selects the results of a route. Every condition lists the
+// accepted values and an empty list accepts any value. Devices are path.Match
+// patterns of the device name or the disk id, such as "/dev/sd*" or "nvme*".
+type RouteMatch struct {
+	Statuses []string `json:"statuses"`
+	Checks   []string `json:"checks"`
+	Devices  []string `json:"devices"`
+	Hosts    []string `json:"hosts"`
+	Clients  []string `json:"clients"`
+}
+
+func (c *RouteMatch) validateConfig() error {
+	for _, status := range c.Statuses {
+		switch status {
+		case "Safe", "Warning", "Error":
+		default:
+			return fmt.Errorf("unknown status %q", status)
+		}
+	}
+	for _, device := range c.Devices {
+		if _, err := path.Match(device, ""); err != nil {
+			return fmt.Errorf("invalid device pattern %q: %v", device, err)
+		}
+	}
+	return nil
+}
+
+// RouteConfig sends the results it matches to Sinks and Notifiers, named as
+// configured. Routes are evaluated in order and the first matching one wins,
+// unless it sets Continue. Sinks and notifiers named by no route receive
+// every result.
+type RouteConfig struct {
+	Match     RouteMatch `json:"match"`
+	Sinks     []string   `json:"sinks"`
+	Notifiers []string   `json:"notifiers"`
+	Continue  bool       `json:"continue"`
+}
+
+type AppConfig struct {
+	InfluxConfig
+	InfluxTags InfluxTagsConfig `json:"influx_tags"`
+	Sinks      []SinkConfig     `json:"sinks"`
+	Alerting   AlertingConfig   `json:"alerting"`
+	Routes     []RouteConfig    `json:"routes"`
+}
+
+// SinkConfigs returns the configured sinks. Without a sinks list, the top-level
+// influx settings define a single InfluxDB sink.
+func (c *AppConfig) SinkConfigs() []SinkConfig {
+	if len(c.Sinks) > 0 {
+		return c.Sinks
+	}
+	return []SinkConfig{{Name: SinkInfluxDB, Type: SinkInfluxDB, InfluxConfig: c.InfluxConfig}}
+}
+
+func (c *AppConfig) validateConfig() error {
+	if err := c.Alerting.validateConfig(); err != nil {
+		return fmt.Errorf("alerting: %v", err)
+	}
+	if err := c.validateSinks(); err != nil {
+		return err
+	}
+	return c.validateRoutes()
+}
+
+func (c *AppConfig) validateSinks() error {
+	if len(c.Sinks) == 0 {
+		return c.InfluxConfig.validateConfig()
+	}
+	names := make(map[string]bool)
+	for i := range c.Sinks {
+		sink := &c.Sinks[i]
+		if sink.Name == "" {
+			sink.Name = fmt.Sprintf("%s-%d", sink.Type, i)
+		}
+		if sink.Name == AlertingSinkName {
+			return fmt.Errorf("sink name %q is reserved for alerting", sink.Name)
+		}
+		if names[sink.Name] {
+			return fmt.Errorf("sink name %q is duplicated", sink.Name)
+		}
+		names[sink.Name] = true
+		if err := sink.validateConfig(); err != nil {
+			return fmt.Errorf("sink %q: %v", sink.Name, err)
+		}
+	}
+	return nil
+}
+
+func (c *AppConfig) validateRoutes() error {
+	sinks := make(map[string]bool)
+	for _, sink := range c.SinkConfigs() {
+		sinks[sink.Name] = true
+	}
+	notifiers := make(map[string]bool)
+	for _, name := range c.Alerting.NotifierNames() {
+		notifiers[name] = true
+	}
+	for i := range c.Routes {
+		route := &c.Routes[i]
+		if err := route.Match.validateConfig(); err != nil {
+			return fmt.Errorf("route %d: %v", i, err)
+		}
+		for _, name := range route.Sinks {
+			if !sinks[name] {
+				return fmt.Errorf("route %d: unknown sink %q", i, name)
+			}
+		}
+		for _, name := range route.Notifiers {
+			if !notifiers[name] {
+				return fmt.Errorf("route %d: unknown notifier %q", i, name)
+			}
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,54 @@
+package appconfig
+
+import (
+	"strings"
+	"testing"
+)
+
+func lineProtocolSink(name string) SinkConfig {
+	return SinkConfig{
+		Name:               name,
+		Type:               SinkLineProtocol,
+		LineProtocolConfig: LineProtocolConfig{Address: "udp://127.0.0.1:8089"},
+	}
+}
+
+func TestValidateSinks(t *testing.T) {
+	tests := []struct {
+		name  string
+		sinks []SinkConfig
+		err   string
+	}{
+		{name: "named", sinks: []SinkConfig{lineProtocolSink("telegraf")}},
+		{name: "default names", sinks: []SinkConfig{lineProtocolSink(""), lineProtocolSink("")}},
+		{name: "duplicated", sinks: []SinkConfig{lineProtocolSink("telegraf"), lineProtocolSink("telegraf")}, err: "duplicated"},
+		{name: "reserved", sinks: []SinkConfig{lineProtocolSink(AlertingSinkName)}, err: "reserved"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := AppConfig{Sinks: test.sinks}
+			err := config.validateSinks()
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("validateSinks: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("got error %v, want one containing %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestValidateSinksDefaultsNames(t *testing.T) {
+	config := AppConfig{Sinks: []SinkConfig{lineProtocolSink(""), lineProtocolSink("")}}
+	if err := config.validateSinks(); err != nil {
+		t.Fatalf("validateSinks: %v", err)
+	}
+	for i, want := range []string{"line_protocol-0", "line_protocol-1"} {
+		if got := config.Sinks[i].Name; got != want {
+			t.Errorf("sink %d name: got %q, want %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package btrfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"gama-client/internal/cmdrunner"
+	"gama-client/internal/diskinfo"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type DeviceStats struct {
+	Mountpoint string
+	DeviceName string
+	// DiskName is the whole disk holding the device, e.g. /dev/sda for
+	// /dev/sda1.
+	DiskName         string
+	WriteErrors      uint64
+	ReadErrors       uint64
+	FlushErrors      uint64
+	CorruptionErrors uint64
+	GenerationErrors uint64
+	// Missing is set when btrfs reports the device by devid only.
+	Missing bool
+}
+
+func (d DeviceStats) Status() (diskinfo.StatusType, string) {
+	if d.Missing {
+		return diskinfo.StatusError, fmt.Sprintf("Btrfs device %s is missing from %s", d.DeviceName, d.Mountpoint)
+	}
+	if d.CorruptionErrors > 0 || d.GenerationErrors > 0 {
+		return diskinfo.StatusError, fmt.Sprintf("Btrfs device %s has corruption errors (corruption %d, generation %d)",
+			d.DeviceName, d.CorruptionErrors, d.GenerationErrors)
+	}
+	if d.WriteErrors+d.ReadErrors+d.FlushErrors > 0 {
+		return diskinfo.StatusWarning, fmt.Sprintf("Btrfs device %s has I/O errors (write %d, read %d, flush %d)",
+			d.DeviceName, d.WriteErrors, d.ReadErrors, d.FlushErrors)
+	}
+	return diskinfo.StatusSafe, "All checks passed"
+}
+
+func (d DeviceStats) StatusToInt() int {
+	status, _ := d.Status()
+	return diskinfo.DiskInfo{Status: status}.StatusToInt()
+}
+
+// Collector runs findmnt and btrfs through a cmdrunner.Runner so the parsing
+// can be fed with captured output.
+type Collector struct {
+	ctx     context.Context
+	runner  cmdrunner.Runner
+	sysRoot string
+}
+
+func NewCollector(ctx context.Context, runner cmdrunner.Runner) *Collector {
+	return &Collector{ctx: ctx, runner: runner, sysRoot: diskinfo.DefaultSysRoot}
+}
+
+// Collect returns the stats of every device of the mounted btrfs filesystems.
+// A filesystem mounted several times (e.g. subvolumes) is reported once.
+func (c *Collector) Collect() ([]DeviceStats, error) {
+	mounts, err := c.runner.Run(c.ctx, "findmnt", "-rn", "-t", "btrfs", "-o", "TARGET")
+	if err != nil {
+		if cmdrunner.IsNotFound(err) {
+			return nil, nil
+		}
+		// findmnt exits with 1 when nothing matches.
+		var exitErr *cmdrunner.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode == 1 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list btrfs mounts: %w", err)
+	}
+
+	var stats []DeviceStats
+	seen := make(map[string]bool)
+	for _, escaped := range strings.Fields(string(mounts)) {
+		mountpoint := unescapeMountpoint(escaped)
+		output, err := c.runner.Run(c.ctx, "btrfs", "device", "stats", mountpoint)
+		if err != nil && len(output) == 0 {
+			if cmdrunner.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("failed to run btrfs device stats on %s: %w", mountpoint, err)
+		}
+		devices, err := ParseDeviceStats(output)
+		if err != nil {
+			return nil, err
+		}
+		for _, device := range devices {
+			if seen[device.DeviceName] {
+				continue
+			}
+			seen[device.DeviceName] = true
+			device.Mountpoint = mountpoint
+			if !device.Missing {
+				device.DiskName = diskinfo.ParentDevice(c.sysRoot, device.DeviceName)
+			}
+			stats = append(stats, device)
+		}
+	}
+	return stats, nil
+}
+
+var statLine = regexp.MustCompile(`^\[([^\]]+)\]\.(\w+)\s+(\d+)$`)
+
+// ParseDeviceStats parses the output of `btrfs device stats <path>`.
+func ParseDeviceStats(output []byte) ([]DeviceStats, error) {
+	var devices []DeviceStats
+	index := make(map[string]int)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		match := statLine.FindStringSubmatch(line)
+		if match == nil {
+			return nil, fmt.Errorf("unexpected btrfs device stats line: %q", line)
+		}
+		name := match[1]
+		i, ok := index[name]
+		if !ok {
+			devices = append(devices, DeviceStats{DeviceName: name, Missing: strings.HasPrefix(name, "devid:")})
+			i = len(devices) - 1
+			index[name] = i
+		}
+		value, _ := strconv.ParseUint(match[3], 10, 64)
+		switch match[2] {
+		case "write_io_errs":
+			devices[i].WriteErrors = value
+		case "read_io_errs":
+			devices[i].ReadErrors = value
+		case "flush_io_errs":
+			devices[i].FlushErrors = value
+		case "corruption_errs":
+			devices[i].CorruptionErrors = value
+		case "generation_errs":
+			devices[i].GenerationErrors = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read btrfs device stats output: %w", err)
+	}
+	return devices, nil
+}
+
+// ApplyToDisks escalates the disks holding a btrfs device with errors.
+func ApplyToDisks(disks []diskinfo.DiskInfo, stats []DeviceStats) {
+	for _, device := range stats {
+		if device.Missing {
+			continue
+		}
+		status, condition := device.Status()
+		for i := range disks {
+			if disks[i].DeviceName == device.DeviceName || disks[i].DeviceName == device.DiskName {
+				disks[i].Escalate(status, diskinfo.CheckBtrfs, condition)
+			}
+		}
+	}
+}
+
+// unescapeMountpoint decodes the \x20 style escapes findmnt -r uses for spaces.
+func unescapeMountpoint(mountpoint string) string {
+	unquoted, err := strconv.Unquote(`"` + strings.ReplaceAll(mountpoint, `"`, `\"`) + `"`)
+	if err != nil {
+		return mountpoint
+	}
+	return unquoted
+}
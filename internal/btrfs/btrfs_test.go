@@ -0,0 +1,197 @@
+package btrfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gama-client/internal/cmdrunner"
+	"gama-client/internal/diskinfo"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+// fakeRunner answers the commands of the collector with captured outputs,
+// keyed by the command line.
+func fakeRunner(t *testing.T, outputs map[string]string) cmdrunner.Runner {
+	return cmdrunner.RunnerFunc(func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		command := name + " " + strings.Join(args, " ")
+		fixture, ok := outputs[command]
+		if !ok {
+			return nil, fmt.Errorf("unexpected command %s", command)
+		}
+		return readFixture(t, fixture), nil
+	})
+}
+
+func fixtureRunner(t *testing.T) cmdrunner.Runner {
+	return fakeRunner(t, map[string]string{
+		"findmnt -rn -t btrfs -o TARGET":        "findmnt.txt",
+		"btrfs device stats /":                  "device_stats_root.txt",
+		"btrfs device stats /home":              "device_stats_root.txt",
+		"btrfs device stats /srv/media library": "device_stats_media.txt",
+	})
+}
+
+func TestParseDeviceStats(t *testing.T) {
+	devices, err := ParseDeviceStats(readFixture(t, "device_stats_media.txt"))
+	if err != nil {
+		t.Fatalf("ParseDeviceStats: %v", err)
+	}
+	if len(devices) != 4 {
+		t.Fatalf("got %d devices, want 4", len(devices))
+	}
+	if got := devices[1]; got.DeviceName != "/dev/sdr1" || got.WriteErrors != 14 || got.ReadErrors != 231 || got.FlushErrors != 2 {
+		t.Errorf("got %+v", got)
+	}
+	if got := devices[2]; got.CorruptionErrors != 7 || got.GenerationErrors != 1 {
+		t.Errorf("got %+v", got)
+	}
+	if got := devices[3]; got.DeviceName != "devid:4" || !got.Missing {
+		t.Errorf("got %+v", got)
+	}
+
+	if _, err := ParseDeviceStats([]byte("ERROR: not a btrfs filesystem: /mnt\n")); err == nil {
+		t.Error("expected an error for an unexpected line")
+	}
+}
+
+func TestCollect(t *testing.T) {
+	stats, err := NewCollector(context.Background(), fixtureRunner(t)).Collect()
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	// /home is a subvolume of the root filesystem and is reported once.
+	if len(stats) != 5 {
+		t.Fatalf("got %d devices, want 5: %+v", len(stats), stats)
+	}
+	if stats[0].DeviceName != "/dev/nvme0n1p2" || stats[0].Mountpoint != "/" {
+		t.Errorf("got %+v", stats[0])
+	}
+	if stats[1].Mountpoint != "/srv/media library" {
+		t.Errorf("mountpoint not unescaped: %q", stats[1].Mountpoint)
+	}
+
+	tests := []struct {
+		status    diskinfo.StatusType
+		condition string
+	}{
+		{diskinfo.StatusSafe, "All checks passed"},
+		{diskinfo.StatusSafe, "All checks passed"},
+		{diskinfo.StatusWarning, "Btrfs device /dev/sdr1 has I/O errors (write 14, read 231, flush 2)"},
+		{diskinfo.StatusError, "Btrfs device /dev/sds has corruption errors (corruption 7, generation 1)"},
+		{diskinfo.StatusError, "Btrfs device devid:4 is missing from /srv/media library"},
+	}
+	for i, test := range tests {
+		if status, condition := stats[i].Status(); status != test.status || condition != test.condition {
+			t.Errorf("%s: got %s %q, want %s %q", stats[i].DeviceName, status, condition, test.status, test.condition)
+		}
+	}
+}
+
+func TestCollectWithoutBtrfs(t *testing.T) {
+	tests := map[string]error{
+		"findmnt missing":  &exec.Error{Name: "findmnt", Err: exec.ErrNotFound},
+		"no btrfs mounted": &cmdrunner.ExitError{ExitCode: 1},
+	}
+	for name, runErr := range tests {
+		runner := cmdrunner.RunnerFunc(func(ctx context.Context, name string, args ...string) ([]byte, error) {
+			return nil, runErr
+		})
+		stats, err := NewCollector(context.Background(), runner).Collect()
+		if stats != nil || err != nil {
+			t.Errorf("%s: got %v, %v", name, stats, err)
+		}
+	}
+
+	runner := cmdrunner.RunnerFunc(func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		if name == "findmnt" {
+			return []byte("/\n"), nil
+		}
+		return nil, errors.New("permission denied")
+	})
+	if _, err := NewCollector(context.Background(), runner).Collect(); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestApplyToDisks(t *testing.T) {
+	stats, err := NewCollector(context.Background(), fixtureRunner(t)).Collect()
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	disks := []diskinfo.DiskInfo{
+		{Status: diskinfo.StatusSafe, Check: diskinfo.CheckOK, Condition: "All checks passed", DeviceName: "/dev/sdq"},
+		{Status: diskinfo.StatusSafe, Check: diskinfo.CheckOK, Condition: "All checks passed", DeviceName: "/dev/sdr"},
+		{Status: diskinfo.StatusWarning, Check: diskinfo.CheckTemperature, Condition: "Temperature exceeds 70°C", DeviceName: "/dev/sds"},
+	}
+	ApplyToDisks(disks, stats)
+
+	tests := []struct {
+		status diskinfo.StatusType
+		check  string
+	}{
+		{diskinfo.StatusSafe, diskinfo.CheckOK},
+		{diskinfo.StatusWarning, diskinfo.CheckBtrfs},
+		{diskinfo.StatusError, diskinfo.CheckBtrfs},
+	}
+	for i, test := range tests {
+		if disks[i].Status != test.status || disks[i].Check != test.check {
+			t.Errorf("%s: got %s %s %q, want %s %s", disks[i].DeviceName, disks[i].Status, disks[i].Check, disks[i].Condition, test.status, test.check)
+		}
+	}
+}
+
+// partitionSysfs builds a sysfs root holding the partition of the disk.
+func partitionSysfs(t *testing.T, disk, partition string) string {
+	t.Helper()
+	root := t.TempDir()
+	dir := filepath.Join(root, "devices", "virtual", "block", disk, partition)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "partition"), []byte("1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "class", "block"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(dir, filepath.Join(root, "class", "block", partition)); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestApplyToDisksResolvesThroughSysfs(t *testing.T) {
+	runner := cmdrunner.RunnerFunc(func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		if name == "findmnt" {
+			return []byte("/\n"), nil
+		}
+		return []byte("[/dev/dasda1].corruption_errs 3\n"), nil
+	})
+	collector := NewCollector(context.Background(), runner)
+	collector.sysRoot = partitionSysfs(t, "dasda", "dasda1")
+	stats, err := collector.Collect()
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	if len(stats) != 1 || stats[0].DiskName != "/dev/dasda" {
+		t.Fatalf("got %+v, want /dev/dasda1 on /dev/dasda", stats)
+	}
+	disks := []diskinfo.DiskInfo{{Status: diskinfo.StatusSafe, Check: diskinfo.CheckOK, Condition: "All checks passed", DeviceName: "/dev/dasda"}}
+	ApplyToDisks(disks, stats)
+	if disks[0].Status != diskinfo.StatusError || disks[0].Check != diskinfo.CheckBtrfs {
+		t.Errorf("got %s %s %q, want a btrfs error", disks[0].Status, disks[0].Check, disks[0].Condition)
+	}
+}
@@ -0,0 +1,68 @@
+package cmdrunner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// Runner executes an external command and returns its standard output.
+// Collectors depend on it instead of os/exec so their parsing can be fed
+// with captured command output.
+type Runner interface {
+	Run(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+// RunnerFunc adapts a function to the Runner interface.
+type RunnerFunc func(ctx context.Context, name string, args ...string) ([]byte, error)
+
+func (f RunnerFunc) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return f(ctx, name, args...)
+}
+
+type ExecRunner struct{}
+
+func NewExecRunner() Runner {
+	return ExecRunner{}
+}
+
+// Run returns the output even when the command exits with a non-zero status,
+// since several storage tools report findings through their exit code.
+func (ExecRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return output, &ExitError{ExitCode: exitErr.ExitCode(), Stderr: stderr.String(), err: err}
+		}
+		return output, err
+	}
+	return output, nil
+}
+
+type ExitError struct {
+	ExitCode int
+	Stderr   string
+	err      error
+}
+
+func (e *ExitError) Error() string {
+	if e.Stderr != "" {
+		return fmt.Sprintf("%v: %s", e.err, bytes.TrimSpace([]byte(e.Stderr)))
+	}
+	return e.err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.err
+}
+
+// IsNotFound reports whether the command is not installed on the host.
+func IsNotFound(err error) bool {
+	return errors.Is(err, exec.ErrNotFound)
+}
@@ -0,0 +1,28 @@
+package diskinfo
+
+// Check identifiers name the finding behind a condition, independently of the
+// counts or names it includes, so alerts can be deduplicated and routed by
+// check. The classifiers set them along with the condition.
+const (
+	CheckOK                  = "ok"
+	CheckSMARTUnavailable    = "smart_unavailable"
+	CheckSMARTFailed         = "smart_failed"
+	CheckHealthStatus        = "health_status"
+	CheckOperationalStatus   = "operational_status"
+	CheckNVMeCriticalWarning = "nvme_critical_warning"
+	CheckNVMeMediaErrors     = "nvme_media_errors"
+	CheckNVMeSpare           = "nvme_available_spare"
+	CheckNVMePercentageUsed  = "nvme_percentage_used"
+	CheckNVMeErrorLog        = "nvme_error_log"
+	CheckUncorrectedErrors   = "uncorrected_errors"
+	CheckReallocatedSectors  = "reallocated_sectors"
+	CheckReallocatedEvents   = "reallocated_events"
+	CheckPendingSectors      = "pending_sectors"
+	CheckWear                = "wear"
+	CheckTemperature         = "temperature"
+	CheckKernelErrors        = "kernel_errors"
+	CheckMDRaid              = "mdraid"
+	CheckZFS                 = "zfs"
+	CheckBtrfs               = "btrfs"
+	CheckLVM                 = "lvm"
+)
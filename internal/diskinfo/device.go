@@ -0,0 +1,58 @@
+package diskinfo
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+const DefaultSysRoot = "/sys"
+
+// partitionSuffix matches the partitions of the kernel naming scheme: disks
+// whose name ends with a digit number their partitions with a p, e.g.
+// mmcblk0p1 and nvme0n1p2, the others append the number, e.g. sda1.
+var partitionSuffix = regexp.MustCompile(`^([a-z][a-z0-9]*\d)p\d+$|^((?:sd|hd|vd|xvd)[a-z]+)\d+$`)
+
+// ParentDevice returns the whole disk holding a partition, e.g. /dev/sda for
+// /dev/sda1. It is resolved through sysfs, falling back to the kernel naming
+// scheme when the sysfs entry is not available or sysRoot is empty. Whole
+// disks are returned as is.
+func ParentDevice(sysRoot, device string) string {
+	name := filepath.Base(device)
+	if sysRoot == "" {
+		return "/dev/" + stripPartition(name)
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(sysRoot, "class", "block", name))
+	if err == nil {
+		if _, err := os.Stat(filepath.Join(resolved, "partition")); err == nil {
+			return "/dev/" + filepath.Base(filepath.Dir(resolved))
+		}
+		return "/dev/" + name
+	}
+	return "/dev/" + stripPartition(name)
+}
+
+func stripPartition(name string) string {
+	match := partitionSuffix.FindStringSubmatch(name)
+	if match == nil {
+		return name
+	}
+	if match[1] != "" {
+		return match[1]
+	}
+	return match[2]
+}
+
+var unsafeIDCharacters = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// DiskID returns a short identifier of a device usable in topics and URLs,
+// e.g. sda for /dev/sda and PHYSICALDRIVE0 for \\.\PHYSICALDRIVE0.
+func DiskID(device string) string {
+	for _, prefix := range []string{"/dev/", `\\.\`} {
+		if len(device) > len(prefix) && device[:len(prefix)] == prefix {
+			device = device[len(prefix):]
+			break
+		}
+	}
+	return unsafeIDCharacters.ReplaceAllString(device, "_")
+}
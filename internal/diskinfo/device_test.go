@@ -0,0 +1,31 @@
+package diskinfo
+
+import "testing"
+
+func TestParentDeviceWithoutSysfs(t *testing.T) {
+	tests := []struct {
+		device string
+		want   string
+	}{
+		{device: "/dev/sda", want: "/dev/sda"},
+		{device: "/dev/sda1", want: "/dev/sda"},
+		{device: "/dev/sdab12", want: "/dev/sdab"},
+		{device: "/dev/vdb3", want: "/dev/vdb"},
+		{device: "/dev/xvda1", want: "/dev/xvda"},
+		{device: "/dev/nvme0n1", want: "/dev/nvme0n1"},
+		{device: "/dev/nvme0n1p2", want: "/dev/nvme0n1"},
+		{device: "/dev/nvme10n2p15", want: "/dev/nvme10n2"},
+		{device: "/dev/mmcblk0", want: "/dev/mmcblk0"},
+		{device: "/dev/mmcblk0p1", want: "/dev/mmcblk0"},
+		{device: "/dev/md0", want: "/dev/md0"},
+		{device: "/dev/md127p1", want: "/dev/md127"},
+		{device: "/dev/loop0", want: "/dev/loop0"},
+		{device: "/dev/dm-0", want: "/dev/dm-0"},
+		{device: "sdb2", want: "/dev/sdb"},
+	}
+	for _, test := range tests {
+		if got := ParentDevice("", test.device); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.device, got, test.want)
+		}
+	}
+}
@@ -8,11 +8,23 @@ const (
 	StatusError   StatusType = "Error"
 )
 
+// Sources of DiskInfo.Temperature.
+const (
+	TemperatureSourceSMART = "smart"
+	TemperatureSourceHwmon = "hwmon"
+)
+
 type DiskInfo struct {
-	Status      StatusType
+	Status StatusType
+	// Check identifies the finding behind Condition, CheckOK when healthy.
+	Check       string
 	Condition   string
 	DeviceName  string
 	Temperature int
+	// TemperatureSource is empty when no source could provide the temperature.
+	TemperatureSource string
+	// Health is the data the status was classified from.
+	Health HealthSnapshot
 }
 
 func (i DiskInfo) StatusToInt() int {
@@ -28,6 +40,17 @@ func (i DiskInfo) StatusToInt() int {
 	}
 }
 
+// Escalate raises the disk status when status is more severe than the current
+// one, replacing the check and condition with the ones that caused it.
+func (i *DiskInfo) Escalate(status StatusType, check, condition string) {
+	candidate := DiskInfo{Status: status}
+	if candidate.StatusToInt() > i.StatusToInt() {
+		i.Status = status
+		i.Check = check
+		i.Condition = condition
+	}
+}
+
 type DiskInfoProvider interface {
 	GetDisksInfo() ([]DiskInfo, error)
 }
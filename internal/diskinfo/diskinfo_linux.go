@@ -7,11 +7,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"gama-client/internal/cmdrunner"
 	"github.com/shirou/gopsutil/v3/disk"
 	"github.com/sirupsen/logrus"
 	"log"
-	"os/exec"
 	"strings"
+	"time"
 )
 
 type SmartctlOutput struct {
@@ -36,7 +37,7 @@ type SmartctlOutput struct {
 	ReadLookahead                 *FeatureStatus      `json:"read_lookahead,omitempty"`
 	WriteCache                    *FeatureStatus      `json:"write_cache,omitempty"`
 	ATASecurity                   *ATASecurity        `json:"ata_security,omitempty"`
-	SmartStatus                   SmartStatus         `json:"smart_status"`
+	SmartStatus                   *SmartStatus        `json:"smart_status,omitempty"`
 	ATASMARTData                  *ATASMARTData       `json:"ata_smart_data,omitempty"`
 	ATASMARTAttributes            *ATASMARTAttributes `json:"ata_smart_attributes,omitempty"`
 	Temperature                   *Temperature        `json:"temperature,omitempty"`
@@ -44,23 +45,20 @@ type SmartctlOutput struct {
 	PowerOnTime                   *PowerOnTime        `json:"power_on_time,omitempty"`
 }
 
-type NVMELog struct {
-	CriticalWarning         int `json:"critical_warning"`
-	AvailableSpare          int `json:"available_spare"`
-	AvailableSpareThreshold int `json:"available_spare_threshold"`
-	PercentageUsed          int `json:"percentage_used"`
-	MediaErrors             int `json:"media_errors"`
-	NumErrLogEntries        int `json:"num_err_log_entries"`
-}
-
 // Structs for nested fields
 type SmartctlInfo struct {
-	Version      []int    `json:"version"`
-	SVNRevision  string   `json:"svn_revision"`
-	PlatformInfo string   `json:"platform_info"`
-	BuildInfo    string   `json:"build_info"`
-	Argv         []string `json:"argv"`
-	ExitStatus   int      `json:"exit_status"`
+	Version      []int             `json:"version"`
+	SVNRevision  string            `json:"svn_revision"`
+	PlatformInfo string            `json:"platform_info"`
+	BuildInfo    string            `json:"build_info"`
+	Argv         []string          `json:"argv"`
+	Messages     []SmartctlMessage `json:"messages,omitempty"`
+	ExitStatus   int               `json:"exit_status"`
+}
+
+type SmartctlMessage struct {
+	String   string `json:"string"`
+	Severity string `json:"severity"`
 }
 
 type DeviceInfo struct {
@@ -222,33 +220,6 @@ type ATASMARTAttributes struct {
 	Table    []SMARTAttribute `json:"table"`
 }
 
-type SMARTAttribute struct {
-	ID         int        `json:"id"`
-	Name       string     `json:"name"`
-	Value      int        `json:"value"`
-	Worst      int        `json:"worst"`
-	Thresh     int        `json:"thresh"`
-	WhenFailed string     `json:"when_failed"`
-	Flags      SMARTFlags `json:"flags"`
-	Raw        SMARTRaw   `json:"raw"`
-}
-
-type SMARTFlags struct {
-	Value         int    `json:"value"`
-	String        string `json:"string"`
-	Prefailure    bool   `json:"prefailure"`
-	UpdatedOnline bool   `json:"updated_online"`
-	Performance   bool   `json:"performance"`
-	ErrorRate     bool   `json:"error_rate"`
-	EventCount    bool   `json:"event_count"`
-	AutoKeep      bool   `json:"auto_keep"`
-}
-
-type SMARTRaw struct {
-	Value  int    `json:"value"`
-	String string `json:"string"`
-}
-
 func NewSmartData(raw []byte) (*SmartctlOutput, error) {
 	var data SmartctlOutput
 	if err := json.Unmarshal(raw, &data); err != nil {
@@ -257,91 +228,55 @@ func NewSmartData(raw []byte) (*SmartctlOutput, error) {
 	return &data, nil
 }
 
-func (sctl *SmartctlOutput) ClassifyDisk() (StatusType, string) {
-	// 1. Verificar si el estado SMART global no es aceptable
-	if sctl == nil {
-		logrus.Fatalf("Error on SmartctlOutput::ClassifyDisk nil pointer")
-	}
-
-	if !sctl.SmartStatus.Passed {
-		return StatusError, "SMART status check failed"
-	}
-
-	// 2. Verificar errores específicos para discos NVMe
-	if sctl.NVMESMARTHealthInformationLog != nil {
-		healthLog := sctl.NVMESMARTHealthInformationLog
-
-		if healthLog.CriticalWarning != 0 {
-			return StatusError, "Critical warning detected in NVMe log"
-		}
-
-		if healthLog.MediaErrors > 0 {
-			return StatusError, "Media errors found in NVMe log"
-		}
-
-		if healthLog.AvailableSpare < healthLog.AvailableSpareThreshold {
-			return StatusWarning, "Available spare below threshold in NVMe log"
-		}
-
-		if healthLog.PercentageUsed >= 80 {
-			return StatusWarning, "Percentage used exceeds 80% in NVMe log"
-		}
-
-		if healthLog.NumErrLogEntries > 100 {
-			return StatusWarning, "Excessive error log entries in NVMe log"
-		}
+// HealthSnapshot extracts the platform-independent health data of the disk.
+func (sctl *SmartctlOutput) HealthSnapshot() HealthSnapshot {
+	health := HealthSnapshot{NVMeLog: sctl.NVMESMARTHealthInformationLog}
+	if sctl.SmartStatus != nil {
+		passed := sctl.SmartStatus.Passed
+		health.SmartPassed = &passed
 	}
-
-	// 3. Verificar errores específicos para discos ATA/SATA
 	if sctl.ATASMARTAttributes != nil {
-		attributes := sctl.ATASMARTAttributes.Table
-
-		// Verificar atributos relevantes de sectores reasignados o pendientes
-		for _, attr := range attributes {
-			if attr.ID == 5 && attr.Raw.Value > 0 {
-				return StatusWarning, "Reallocated sectors count is greater than 0"
-			}
-			if attr.ID == 196 && attr.Raw.Value > 0 {
-				return StatusWarning, "Reallocated event count is greater than 0"
-			}
-			if attr.ID == 197 && attr.Raw.Value > 0 {
-				return StatusWarning, "Current pending sector count is greater than 0"
-			}
-		}
+		health.Attributes = sctl.ATASMARTAttributes.Table
 	}
-
-	// 4. Verificar temperatura
-	if sctl.Temperature != nil && sctl.Temperature.Current > 70 {
-		return StatusWarning, "Temperature exceeds 70°C"
+	if sctl.Temperature != nil {
+		temperature := sctl.Temperature.Current
+		health.Temperature = &temperature
 	}
-
-	// Si todas las verificaciones pasan, el estado es "Safe"
-	return StatusSafe, "All checks passed"
+	return health
 }
 
 type LinuxDiskInfo struct {
-	ctx context.Context
+	ctx         context.Context
+	runner      cmdrunner.Runner
+	deviceTypes *deviceTypeCache
 }
 
-func getSmartData(disk string) (*SmartctlOutput, error) {
-	cmdR := fmt.Sprintf("%s %s \n", "sudo smartctl -a -x -j", disk)
+// runSmartctl returns the parsed output along with the error, so callers can
+// inspect the smartctl messages of a device that could not be opened.
+func (l LinuxDiskInfo) runSmartctl(disk, deviceType string) (*SmartctlOutput, error) {
+	args := []string{"-a", "-x", "-j"}
+	if deviceType != "" {
+		args = append(args, "-d", deviceType)
+	}
+	args = append(args, disk)
+	cmdR := fmt.Sprintf("smartctl %s", strings.Join(args, " "))
 
 	logrus.Debugf("Running: %s", cmdR)
-	cmd := exec.Command("smartctl", "-a", "-x", "-j", disk)
-	output, err := cmd.CombinedOutput()
+	output, err := l.runner.Run(l.ctx, "smartctl", args...)
 
 	if err != nil {
-		var exitErr *exec.ExitError
-		if errors.As(err, &exitErr) {
-			exitCode := exitErr.ExitCode()
-			if exitCode == 1 || exitCode == 2 {
-				logrus.Errorf("Failed to run smartctl command. [%s]", cmdR)
-				return nil, err
-			}
-		} else {
-			logrus.Fatalf("Unexpected error. [%v]", err)
+		var exitErr *cmdrunner.ExitError
+		if !errors.As(err, &exitErr) {
+			logrus.Errorf("Unexpected error. [%v]", err)
 			return nil, err
 		}
+		// Bits 0 and 1 of the exit status mean the command line could not be
+		// parsed or the device could not be opened; higher bits report the
+		// disk health and come with valid output.
+		if exitErr.ExitCode&0x3 != 0 {
+			data, _ := NewSmartData(output)
+			return data, fmt.Errorf("failed to run smartctl command [%s]: exit status %d", cmdR, exitErr.ExitCode)
+		}
 	}
 	data, err := NewSmartData(output)
 	if err != nil {
@@ -351,6 +286,49 @@ func getSmartData(disk string) (*SmartctlOutput, error) {
 	return data, nil
 }
 
+// getSmartData reads the SMART data of a disk. Disks behind USB bridges that
+// smartctl cannot identify are retried with the candidate bridge device types,
+// and the type that works is remembered for the next collections. When none
+// works, the disk is read with the plain type until bridgeProbeBackoff ends.
+func (l LinuxDiskInfo) getSmartData(disk string) (*SmartctlOutput, error) {
+	if deviceType, ok := l.deviceTypes.get(disk); ok {
+		data, err := l.runSmartctl(disk, deviceType)
+		if err == nil && !l.needsDeviceType(disk, data) {
+			return data, nil
+		}
+		logrus.Warnf("Cached smartctl device type %q no longer works for %s, detecting again", deviceType, disk)
+		l.deviceTypes.forget(disk)
+	}
+
+	data, err := l.runSmartctl(disk, "")
+	if !isUSBBridgeError(data) && (err != nil || !l.needsDeviceType(disk, data)) {
+		if err == nil {
+			l.deviceTypes.set(disk, "")
+		}
+		return data, err
+	}
+
+	if !l.deviceTypes.backingOff(disk, time.Now()) {
+		logrus.Infof("USB bridge detected on %s, trying device types %v", disk, BridgeDeviceTypes)
+		for _, deviceType := range BridgeDeviceTypes {
+			candidate, candidateErr := l.runSmartctl(disk, deviceType)
+			if candidateErr != nil || l.needsDeviceType(disk, candidate) {
+				continue
+			}
+			logrus.Infof("Using smartctl device type %q for %s", deviceType, disk)
+			l.deviceTypes.set(disk, deviceType)
+			return candidate, nil
+		}
+		logrus.Warnf("No smartctl device type works for %s, trying again in %s", disk, bridgeProbeBackoff)
+		l.deviceTypes.probeFailed(disk, time.Now())
+	}
+	if err == nil {
+		// The bridge answers without SMART passthrough, keep what it reports.
+		return data, nil
+	}
+	return nil, fmt.Errorf("no smartctl device type works for the USB bridge of %s: %w", disk, err)
+}
+
 func (l LinuxDiskInfo) GetDisksInfo() ([]DiskInfo, error) {
 	fmt.Println("Fetching disk info on Linux using smartctl...")
 	var disks []DiskInfo
@@ -363,22 +341,24 @@ func (l LinuxDiskInfo) GetDisksInfo() ([]DiskInfo, error) {
 		if strings.Contains(device, "snap") || strings.Contains(device, "loop") {
 			continue
 		}
-		smartData, err := getSmartData(device)
+		smartData, err := l.getSmartData(device)
 		if err != nil {
 			logrus.Errorf("Error retrieving device info: %s :: %v", device, err)
+			// Keep the device so fallback sources can still report on it.
+			disks = append(disks, DiskInfo{
+				Status:     StatusWarning,
+				Check:      CheckSMARTUnavailable,
+				Condition:  "SMART data unavailable",
+				DeviceName: device,
+			})
+			continue
 		}
-		status, condition := smartData.ClassifyDisk()
-		disks = append(disks, DiskInfo{
-			Status:      status,
-			Condition:   condition,
-			DeviceName:  smartData.Device.Name,
-			Temperature: smartData.Temperature.Current,
-		})
+		disks = append(disks, NewDiskInfo(smartData.Device.Name, smartData.HealthSnapshot(), TemperatureSourceSMART))
 	}
 
 	return disks, nil
 }
 
 func NewDiskInfoProvider(ctx context.Context) DiskInfoProvider {
-	return LinuxDiskInfo{ctx: ctx}
+	return LinuxDiskInfo{ctx: ctx, runner: cmdrunner.NewExecRunner(), deviceTypes: newDeviceTypeCache()}
 }
@@ -4,17 +4,18 @@ package diskinfo
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"gama-client/internal/cmdrunner"
 	"github.com/sirupsen/logrus"
 	"github.com/yusufpapurcu/wmi"
-	"os/exec"
+	"strings"
 )
 
+const wmiStorageNamespace = `root\WMI`
+
 type Win32_DiskDrive struct {
-	DeviceID  string
-	MediaType string
-	Status    string
+	Index       uint32
+	PNPDeviceID string
 }
 
 type MSStorageDriver_FailurePredictStatus struct {
@@ -22,184 +23,122 @@ type MSStorageDriver_FailurePredictStatus struct {
 	PredictFailure bool
 }
 
-func testWmiAccess() error {
-	var testQuery []struct{}
-	err := wmi.Query("SELECT * FROM Win32_OperatingSystem", &testQuery)
-	if err != nil {
-		return fmt.Errorf("WMI access validation failed: %v", err)
-	}
-	logrus.Info("WMI access validated successfully.")
-	return nil
-}
-
 // MSStorageDriver_FailurePredictData structure for SMART data
 type MSStorageDriver_FailurePredictData struct {
 	InstanceName   string
-	VendorSpecific []byte
+	VendorSpecific []uint8
 }
 
-func parseTemperature(vendorSpecific []byte) int {
-	if len(vendorSpecific) < 5 {
-		return -1 // Invalid data
-	}
-	// Example: Extract temperature from SMART attribute ID 0xC2 (194)
-	for i := 0; i < len(vendorSpecific)-6; i += 12 {
-		if vendorSpecific[i] == 0xC2 {
-			return int(vendorSpecific[i+5]) // Temperature value
-		}
-	}
-	return -1 // Temperature attribute not found
+type MSStorageDriver_FailurePredictThresholds struct {
+	InstanceName   string
+	VendorSpecific []uint8
 }
 
-type DiskInfo2 struct {
-	DeviceID          string `json:"DeviceID"`
-	MediaType         string `json:"MediaType"`
-	HealthStatus      string `json:"HealthStatus"`
-	OperationalStatus string `json:"OperationalStatus"`
-	Temperature       int    `json:"Temperature"`
+// wmiSMART is the SMART information WMI exposes for a disk.
+type wmiSMART struct {
+	PredictFailure bool
+	Attributes     []SMARTAttribute
 }
 
-func tttt() {
-	powerShellCmd := `
-	@(
-	    Get-PhysicalDisk | ForEach-Object {
-	        $disk = $_
-	        $reliability = Get-StorageReliabilityCounter -PhysicalDisk $disk
-	        [PSCustomObject]@{
-	            DeviceID = $disk.DeviceID
-	            MediaType = $disk.MediaType
-	            HealthStatus = $disk.HealthStatus
-	            OperationalStatus = $disk.OperationalStatus
-	            Temperature = $reliability.Temperature
-	        }
-	    }
-	) | ConvertTo-Json -Depth 2
-	`
-	fmt.Println("Running command") // Debugging raw output
-
-	// Execute the PowerShell command
-	cmd := exec.Command("powershell", "-Command", powerShellCmd)
-
-	output, err := cmd.CombinedOutput()
-	fmt.Println("Raw Output:", string(output)) // Debugging raw output
+type WindowsDiskInfo struct {
+	ctx    context.Context
+	runner cmdrunner.Runner
+}
 
+func (l WindowsDiskInfo) getPhysicalDisks() ([]PhysicalDisk, error) {
+	output, err := l.runner.Run(l.ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", PhysicalDiskScript)
 	if err != nil {
-		fmt.Printf("Error executing PowerShell command: %v\n", err)
-		fmt.Println("Raw Output:", string(output)) // Debugging raw output
-
-		return
+		return nil, fmt.Errorf("error executing PowerShell command: %w", err)
 	}
+	return ParsePhysicalDisks(output)
+}
 
-	// Parse the JSON output
-	var disks []DiskInfo2
-	err = json.Unmarshal(output, &disks)
-	if err != nil {
-		// If parsing as an array fails, try parsing as a single object
-		var singleDisk DiskInfo2
-		err = json.Unmarshal(output, &singleDisk)
-		if err != nil {
-			fmt.Printf("Error parsing JSON output: %v\n", err)
-			return
-		}
-		// Wrap the single object in a slice
-		disks = append(disks, singleDisk)
+// getWMISMART returns the SMART data of the ATA disks keyed by disk number.
+// The storage driver classes are keyed by instance name, which is the PNP
+// device id of Win32_DiskDrive followed by "_0".
+func getWMISMART() (map[string]wmiSMART, error) {
+	var drives []Win32_DiskDrive
+	if err := wmi.Query("SELECT Index, PNPDeviceID FROM Win32_DiskDrive", &drives); err != nil {
+		return nil, fmt.Errorf("error querying WMI: %v", err)
 	}
-
-	// Print the disk information
-	for _, disk := range disks {
-		fmt.Printf("DeviceID: %s\n", disk.DeviceID)
-		fmt.Printf("MediaType: %s\n", disk.MediaType)
-		fmt.Printf("HealthStatus: %s\n", disk.HealthStatus)
-		fmt.Printf("OperationalStatus: %s\n", disk.OperationalStatus)
-		fmt.Printf("Temperature: %d°C\n", disk.Temperature)
-		fmt.Println("-------------------------")
+	var statuses []MSStorageDriver_FailurePredictStatus
+	if err := wmi.QueryNamespace("SELECT InstanceName, PredictFailure FROM MSStorageDriver_FailurePredictStatus", &statuses, wmiStorageNamespace); err != nil {
+		return nil, fmt.Errorf("error querying SMART status: %v", err)
 	}
-}
-
-func getWin32_DiskDrive() ([]Win32_DiskDrive, map[string]MSStorageDriver_FailurePredictStatus, error) {
-	tttt()
-	return nil, nil, nil
-	command := `
-	Get-PhysicalDisk | ForEach-Object {
-		$disk = $_
-		$reliability = Get-StorageReliabilityCounter -PhysicalDisk $disk
-		[PSCustomObject]@{
-			DeviceID = $disk.DeviceID
-			MediaType = $disk.MediaType
-			OperationalStatus = $disk.OperationalStatus
-			Temperature = $reliability.Temperature
-		}
-	} | ConvertTo-Json -Depth 2
-	`
-	cmd := exec.Command("powershell", "-Command", command)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		fmt.Println("Error:", err)
+	var data []MSStorageDriver_FailurePredictData
+	if err := wmi.QueryNamespace("SELECT InstanceName, VendorSpecific FROM MSStorageDriver_FailurePredictData", &data, wmiStorageNamespace); err != nil {
+		return nil, fmt.Errorf("error querying SMART data: %v", err)
 	}
-	fmt.Println(string(output))
-
-	var diskDrives []Win32_DiskDrive
-	err = wmi.Query("SELECT DeviceID, SerialNumber, Model, Size, Status FROM Win32_DiskDrive", &diskDrives)
-	if err != nil {
-		logrus.Errorf("error querying WMI: %v \n", err)
-		return nil, nil, fmt.Errorf("error querying WMI: %v", err)
+	var thresholds []MSStorageDriver_FailurePredictThresholds
+	if err := wmi.QueryNamespace("SELECT InstanceName, VendorSpecific FROM MSStorageDriver_FailurePredictThresholds", &thresholds, wmiStorageNamespace); err != nil {
+		logrus.Debugf("Error querying SMART thresholds: %v", err)
 	}
 
-	var failureStatuses []MSStorageDriver_FailurePredictStatus
-	err = wmi.Query("SELECT InstanceName, PredictFailure FROM MSStorageDriver_FailurePredictStatus", &failureStatuses)
-	if err != nil {
-		logrus.Errorf("error querying SMART status: %v \n", err)
-		return nil, nil, fmt.Errorf("error querying SMART status: %v", err)
+	thresholdsByInstance := make(map[string][]byte)
+	for _, threshold := range thresholds {
+		thresholdsByInstance[strings.ToUpper(threshold.InstanceName)] = threshold.VendorSpecific
 	}
-
-	// Mapped by instanceName
-	var failureStatusesMapped map[string]MSStorageDriver_FailurePredictStatus
-	for _, status := range failureStatuses {
-		failureStatusesMapped[status.InstanceName] = status
+	smartByInstance := make(map[string]wmiSMART)
+	for _, status := range statuses {
+		instance := strings.ToUpper(status.InstanceName)
+		smart := smartByInstance[instance]
+		smart.PredictFailure = status.PredictFailure
+		smartByInstance[instance] = smart
+	}
+	for _, entry := range data {
+		instance := strings.ToUpper(entry.InstanceName)
+		attributes, err := DecodeSMARTData(entry.VendorSpecific, thresholdsByInstance[instance])
+		if err != nil {
+			logrus.Warnf("Unable to decode SMART data of %s: %v", entry.InstanceName, err)
+			continue
+		}
+		smart := smartByInstance[instance]
+		smart.Attributes = attributes
+		smartByInstance[instance] = smart
 	}
-	return diskDrives, failureStatusesMapped, nil
-}
 
-type WindowsDiskInfo struct {
-	ctx context.Context
+	smartByDisk := make(map[string]wmiSMART)
+	for _, drive := range drives {
+		if smart, ok := smartByInstance[strings.ToUpper(drive.PNPDeviceID)+"_0"]; ok {
+			smartByDisk[fmt.Sprintf("%d", drive.Index)] = smart
+		}
+	}
+	return smartByDisk, nil
 }
 
 func (l WindowsDiskInfo) GetDisksInfo() ([]DiskInfo, error) {
-	fmt.Println("Fetching disk info on Windows using WMI...")
-	err := testWmiAccess()
+	logrus.Debug("Fetching disk info on Windows using Get-PhysicalDisk...")
+	physicalDisks, err := l.getPhysicalDisks()
 	if err != nil {
-		return nil, fmt.Errorf("access WMI Test failed: %v", err)
+		return nil, fmt.Errorf("failed to retrieve disk data: %v", err)
 	}
-
-	var disksInfo []DiskInfo
-	disks, disksStatus, err := getWin32_DiskDrive()
+	// NVMe disks and some controllers do not implement the storage driver
+	// SMART classes, so their absence is not an error.
+	smartByDisk, err := getWMISMART()
 	if err != nil {
-		return nil, fmt.Errorf("failed to revtrieve disk data: %v", err)
+		logrus.Debugf("SMART data not available through WMI: %v", err)
 	}
 
-	for _, disk := range disks {
-		var status StatusType
-		fmt.Printf("%s \n", disk.DeviceID)
-
-		if diskStatus, exists := disksStatus[disk.DeviceID]; exists {
-			if diskStatus.PredictFailure {
-				fmt.Println("  SMART Status: Warning - Predicted Failure")
-				status = StatusWarning
-			} else {
-				status = StatusSafe
-				fmt.Println("  SMART Status: OK")
+	var disksInfo []DiskInfo
+	for _, physicalDisk := range physicalDisks {
+		health := physicalDisk.HealthSnapshot()
+		temperatureSource := TemperatureSourceReliability
+		if smart, ok := smartByDisk[string(physicalDisk.DeviceID)]; ok {
+			passed := !smart.PredictFailure
+			health.SmartPassed = &passed
+			health.Attributes = smart.Attributes
+			if health.Temperature == nil {
+				if temperature, ok := AttributeTemperature(smart.Attributes); ok {
+					health.Temperature = &temperature
+					temperatureSource = TemperatureSourceSMART
+				}
 			}
 		}
-		disksInfo = append(disksInfo, DiskInfo{
-			Status:      status,
-			Condition:   "",
-			DeviceName:  disk.DeviceID,
-			Temperature: 0,
-		})
+		disksInfo = append(disksInfo, NewDiskInfo(physicalDisk.DeviceName(), health, temperatureSource))
 	}
-	return nil, nil
+	return disksInfo, nil
 }
 
 func NewDiskInfoProvider(ctx context.Context) DiskInfoProvider {
-	return WindowsDiskInfo{ctx: ctx}
+	return WindowsDiskInfo{ctx: ctx, runner: cmdrunner.NewExecRunner()}
 }
@@ -0,0 +1,132 @@
+package diskinfo
+
+import "fmt"
+
+type NVMELog struct {
+	CriticalWarning         int `json:"critical_warning"`
+	AvailableSpare          int `json:"available_spare"`
+	AvailableSpareThreshold int `json:"available_spare_threshold"`
+	PercentageUsed          int `json:"percentage_used"`
+	MediaErrors             int `json:"media_errors"`
+	NumErrLogEntries        int `json:"num_err_log_entries"`
+}
+
+// HealthSnapshot is the platform-independent health data of a disk. Each
+// provider fills it from its own source (smartctl, Get-PhysicalDisk, WMI) and
+// the classification only looks at it. Nil fields are not reported by the
+// source.
+type HealthSnapshot struct {
+	SmartPassed *bool
+	NVMeLog     *NVMELog
+	Attributes  []SMARTAttribute
+	Temperature *int
+	// HealthStatus and OperationalStatus are the verdicts of the Windows
+	// storage stack.
+	HealthStatus      string
+	OperationalStatus []string
+	// Storage reliability counters of the disk.
+	Wear                   *int
+	TemperatureMax         *int
+	PowerOnHours           *int
+	ReadErrorsTotal        *int64
+	ReadErrorsUncorrected  *int64
+	WriteErrorsTotal       *int64
+	WriteErrorsUncorrected *int64
+}
+
+// ClassifyDisk returns the status of the disk, and the check and condition
+// that decided it.
+func (h HealthSnapshot) ClassifyDisk() (StatusType, string, string) {
+	// 1. Verificar si el estado SMART global no es aceptable
+	if h.SmartPassed == nil && h.HealthStatus == "" {
+		return StatusWarning, CheckSMARTUnavailable, "SMART status not available"
+	}
+
+	if h.SmartPassed != nil && !*h.SmartPassed {
+		return StatusError, CheckSMARTFailed, "SMART status check failed"
+	}
+
+	switch h.HealthStatus {
+	case "Unhealthy":
+		return StatusError, CheckHealthStatus, "Physical disk health status is Unhealthy"
+	case "Warning":
+		return StatusWarning, CheckHealthStatus, "Physical disk health status is Warning"
+	}
+
+	for _, state := range h.OperationalStatus {
+		switch state {
+		case "OK", "Online", "In Service":
+		case "Predictive Failure", "Error", "Lost Communication":
+			return StatusError, CheckOperationalStatus, fmt.Sprintf("Physical disk operational status is %s", state)
+		default:
+			return StatusWarning, CheckOperationalStatus, fmt.Sprintf("Physical disk operational status is %s", state)
+		}
+	}
+
+	// 2. Verificar errores específicos para discos NVMe
+	if h.NVMeLog != nil {
+		healthLog := h.NVMeLog
+
+		if healthLog.CriticalWarning != 0 {
+			return StatusError, CheckNVMeCriticalWarning, "Critical warning detected in NVMe log"
+		}
+
+		if healthLog.MediaErrors > 0 {
+			return StatusError, CheckNVMeMediaErrors, "Media errors found in NVMe log"
+		}
+
+		if healthLog.AvailableSpare < healthLog.AvailableSpareThreshold {
+			return StatusWarning, CheckNVMeSpare, "Available spare below threshold in NVMe log"
+		}
+
+		if healthLog.PercentageUsed >= 80 {
+			return StatusWarning, CheckNVMePercentageUsed, "Percentage used exceeds 80% in NVMe log"
+		}
+
+		if healthLog.NumErrLogEntries > 100 {
+			return StatusWarning, CheckNVMeErrorLog, "Excessive error log entries in NVMe log"
+		}
+	}
+
+	if h.ReadErrorsUncorrected != nil && *h.ReadErrorsUncorrected > 0 {
+		return StatusError, CheckUncorrectedErrors, "Uncorrected read errors found in reliability counters"
+	}
+	if h.WriteErrorsUncorrected != nil && *h.WriteErrorsUncorrected > 0 {
+		return StatusError, CheckUncorrectedErrors, "Uncorrected write errors found in reliability counters"
+	}
+
+	// 3. Verificar errores específicos para discos ATA/SATA
+	if status, check, condition, found := ClassifyAttributes(h.Attributes); found {
+		return status, check, condition
+	}
+
+	if h.Wear != nil && *h.Wear >= 80 {
+		return StatusWarning, CheckWear, "Wear exceeds 80% in reliability counters"
+	}
+
+	// 4. Verificar temperatura
+	if h.Temperature != nil && *h.Temperature > 70 {
+		return StatusWarning, CheckTemperature, "Temperature exceeds 70°C"
+	}
+
+	// Si todas las verificaciones pasan, el estado es "Safe"
+	return StatusSafe, CheckOK, "All checks passed"
+}
+
+// NewDiskInfo classifies the snapshot. temperatureSource names where
+// health.Temperature comes from.
+func NewDiskInfo(deviceName string, health HealthSnapshot, temperatureSource string) DiskInfo {
+	status, check, condition := health.ClassifyDisk()
+	info := DiskInfo{
+		Status:     status,
+		Check:      check,
+		Condition:  condition,
+		DeviceName: deviceName,
+		Health:     health,
+	}
+	if health.Temperature != nil {
+		info.Temperature = *health.Temperature
+		info.TemperatureSource = temperatureSource
+	}
+	return info
+}
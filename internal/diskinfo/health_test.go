@@ -0,0 +1,74 @@
+package diskinfo
+
+import "testing"
+
+func TestClassifyDisk(t *testing.T) {
+	passed, failed := true, false
+	intPtr := func(value int) *int { return &value }
+	int64Ptr := func(value int64) *int64 { return &value }
+	attribute := func(id int, raw int64) []SMARTAttribute {
+		return []SMARTAttribute{{ID: 9, Raw: SMARTRaw{Value: 1234}}, {ID: id, Raw: SMARTRaw{Value: raw}}}
+	}
+
+	tests := []struct {
+		name      string
+		health    HealthSnapshot
+		status    StatusType
+		check     string
+		condition string
+	}{
+		{"no verdict", HealthSnapshot{}, StatusWarning, CheckSMARTUnavailable, "SMART status not available"},
+		{"SMART failed", HealthSnapshot{SmartPassed: &failed, Temperature: intPtr(80)}, StatusError, CheckSMARTFailed, "SMART status check failed"},
+		{"unhealthy", HealthSnapshot{HealthStatus: "Unhealthy"}, StatusError, CheckHealthStatus, "Physical disk health status is Unhealthy"},
+		{"health warning", HealthSnapshot{HealthStatus: "Warning"}, StatusWarning, CheckHealthStatus, "Physical disk health status is Warning"},
+		{"healthy and online", HealthSnapshot{HealthStatus: "Healthy", OperationalStatus: []string{"Online"}}, StatusSafe, CheckOK, "All checks passed"},
+		{"healthy in service", HealthSnapshot{HealthStatus: "Healthy", OperationalStatus: []string{"OK", "In Service"}}, StatusSafe, CheckOK, "All checks passed"},
+		{"predictive failure", HealthSnapshot{HealthStatus: "Healthy", OperationalStatus: []string{"OK", "Predictive Failure"}}, StatusError, CheckOperationalStatus, "Physical disk operational status is Predictive Failure"},
+		{"lost communication", HealthSnapshot{HealthStatus: "Healthy", OperationalStatus: []string{"Lost Communication"}}, StatusError, CheckOperationalStatus, "Physical disk operational status is Lost Communication"},
+		{"degraded", HealthSnapshot{HealthStatus: "Healthy", OperationalStatus: []string{"Degraded"}}, StatusWarning, CheckOperationalStatus, "Physical disk operational status is Degraded"},
+		{"NVMe critical warning", HealthSnapshot{SmartPassed: &passed, NVMeLog: &NVMELog{CriticalWarning: 4, MediaErrors: 2}}, StatusError, CheckNVMeCriticalWarning, "Critical warning detected in NVMe log"},
+		{"NVMe media errors", HealthSnapshot{SmartPassed: &passed, NVMeLog: &NVMELog{MediaErrors: 2}}, StatusError, CheckNVMeMediaErrors, "Media errors found in NVMe log"},
+		{"NVMe spare", HealthSnapshot{SmartPassed: &passed, NVMeLog: &NVMELog{AvailableSpare: 5, AvailableSpareThreshold: 10}}, StatusWarning, CheckNVMeSpare, "Available spare below threshold in NVMe log"},
+		{"NVMe percentage used", HealthSnapshot{SmartPassed: &passed, NVMeLog: &NVMELog{AvailableSpare: 100, AvailableSpareThreshold: 10, PercentageUsed: 80}}, StatusWarning, CheckNVMePercentageUsed, "Percentage used exceeds 80% in NVMe log"},
+		{"NVMe error log", HealthSnapshot{SmartPassed: &passed, NVMeLog: &NVMELog{AvailableSpare: 100, NumErrLogEntries: 101}}, StatusWarning, CheckNVMeErrorLog, "Excessive error log entries in NVMe log"},
+		{"uncorrected reads", HealthSnapshot{HealthStatus: "Healthy", ReadErrorsTotal: int64Ptr(40), ReadErrorsUncorrected: int64Ptr(1)}, StatusError, CheckUncorrectedErrors, "Uncorrected read errors found in reliability counters"},
+		{"uncorrected writes", HealthSnapshot{HealthStatus: "Healthy", ReadErrorsUncorrected: int64Ptr(0), WriteErrorsUncorrected: int64Ptr(3)}, StatusError, CheckUncorrectedErrors, "Uncorrected write errors found in reliability counters"},
+		{"reallocated sectors", HealthSnapshot{SmartPassed: &passed, Attributes: attribute(5, 8)}, StatusWarning, CheckReallocatedSectors, "Reallocated sectors count is greater than 0"},
+		{"reallocated events", HealthSnapshot{SmartPassed: &passed, Attributes: attribute(196, 1)}, StatusWarning, CheckReallocatedEvents, "Reallocated event count is greater than 0"},
+		{"pending sectors", HealthSnapshot{SmartPassed: &passed, Attributes: attribute(197, 2)}, StatusWarning, CheckPendingSectors, "Current pending sector count is greater than 0"},
+		{"zero counters", HealthSnapshot{SmartPassed: &passed, Attributes: attribute(5, 0)}, StatusSafe, CheckOK, "All checks passed"},
+		{"wear", HealthSnapshot{HealthStatus: "Healthy", Wear: intPtr(80)}, StatusWarning, CheckWear, "Wear exceeds 80% in reliability counters"},
+		{"hot", HealthSnapshot{SmartPassed: &passed, Temperature: intPtr(71)}, StatusWarning, CheckTemperature, "Temperature exceeds 70°C"},
+		{"warm", HealthSnapshot{SmartPassed: &passed, Temperature: intPtr(70)}, StatusSafe, CheckOK, "All checks passed"},
+	}
+	for _, test := range tests {
+		status, check, condition := test.health.ClassifyDisk()
+		if status != test.status || check != test.check || condition != test.condition {
+			t.Errorf("%s: got %s %s %q, want %s %s %q", test.name, status, check, condition, test.status, test.check, test.condition)
+		}
+	}
+}
+
+func TestNewDiskInfo(t *testing.T) {
+	temperature := 38
+	info := NewDiskInfo("/dev/sda", HealthSnapshot{HealthStatus: "Healthy", Temperature: &temperature}, TemperatureSourceReliability)
+	if info.Status != StatusSafe || info.Check != CheckOK || info.Temperature != 38 || info.TemperatureSource != TemperatureSourceReliability {
+		t.Errorf("got %+v", info)
+	}
+	info = NewDiskInfo("/dev/sdb", HealthSnapshot{HealthStatus: "Healthy"}, TemperatureSourceReliability)
+	if info.TemperatureSource != "" {
+		t.Errorf("temperature source set without a temperature: %+v", info)
+	}
+}
+
+func TestEscalate(t *testing.T) {
+	disk := DiskInfo{Status: StatusWarning, Check: CheckTemperature, Condition: "Temperature exceeds 70°C"}
+	disk.Escalate(StatusWarning, CheckMDRaid, "RAID array md0 is degraded")
+	if disk.Check != CheckTemperature {
+		t.Errorf("equal severity replaced the finding: %+v", disk)
+	}
+	disk.Escalate(StatusError, CheckMDRaid, "RAID array md0 is inactive")
+	if disk.Status != StatusError || disk.Check != CheckMDRaid || disk.Condition != "RAID array md0 is inactive" {
+		t.Errorf("got %+v", disk)
+	}
+}
@@ -0,0 +1,174 @@
+package diskinfo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const TemperatureSourceReliability = "reliability"
+
+// PhysicalDiskScript lists the physical disks with their storage reliability
+// counters as JSON. ConvertTo-Json prints a single object instead of an array
+// when there is only one disk.
+const PhysicalDiskScript = `
+Get-PhysicalDisk | ForEach-Object {
+	$disk = $_
+	$reliability = Get-StorageReliabilityCounter -PhysicalDisk $disk
+	[PSCustomObject]@{
+		DeviceId = $disk.DeviceId
+		FriendlyName = $disk.FriendlyName
+		SerialNumber = $disk.SerialNumber
+		MediaType = [string]$disk.MediaType
+		BusType = [string]$disk.BusType
+		HealthStatus = [string]$disk.HealthStatus
+		OperationalStatus = ($disk.OperationalStatus -join ',')
+		Size = $disk.Size
+		Temperature = $reliability.Temperature
+		TemperatureMax = $reliability.TemperatureMax
+		Wear = $reliability.Wear
+		ReadErrorsTotal = $reliability.ReadErrorsTotal
+		ReadErrorsUncorrected = $reliability.ReadErrorsUncorrected
+		WriteErrorsTotal = $reliability.WriteErrorsTotal
+		WriteErrorsUncorrected = $reliability.WriteErrorsUncorrected
+		PowerOnHours = $reliability.PowerOnHours
+	}
+} | ConvertTo-Json -Depth 2
+`
+
+// PhysicalDisk is a disk reported by Get-PhysicalDisk merged with its
+// Get-StorageReliabilityCounter values. Counters the driver does not support
+// are null.
+type PhysicalDisk struct {
+	DeviceID               PSString `json:"DeviceId"`
+	FriendlyName           string   `json:"FriendlyName"`
+	SerialNumber           string   `json:"SerialNumber"`
+	MediaType              PSString `json:"MediaType"`
+	BusType                PSString `json:"BusType"`
+	HealthStatus           PSString `json:"HealthStatus"`
+	OperationalStatus      PSString `json:"OperationalStatus"`
+	Size                   int64    `json:"Size"`
+	Temperature            *int     `json:"Temperature"`
+	TemperatureMax         *int     `json:"TemperatureMax"`
+	Wear                   *int     `json:"Wear"`
+	ReadErrorsTotal        *int64   `json:"ReadErrorsTotal"`
+	ReadErrorsUncorrected  *int64   `json:"ReadErrorsUncorrected"`
+	WriteErrorsTotal       *int64   `json:"WriteErrorsTotal"`
+	WriteErrorsUncorrected *int64   `json:"WriteErrorsUncorrected"`
+	PowerOnHours           *int     `json:"PowerOnHours"`
+}
+
+// PSString decodes PowerShell values that come either as strings, as the
+// numeric value of an enum, or as an array of them.
+type PSString string
+
+func (s *PSString) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		*s = ""
+	case len(data) > 0 && data[0] == '"':
+		var value string
+		if err := json.Unmarshal(data, &value); err != nil {
+			return err
+		}
+		*s = PSString(value)
+	case len(data) > 0 && data[0] == '[':
+		var values []PSString
+		if err := json.Unmarshal(data, &values); err != nil {
+			return err
+		}
+		parts := make([]string, len(values))
+		for i, value := range values {
+			parts[i] = string(value)
+		}
+		*s = PSString(strings.Join(parts, ","))
+	default:
+		var number json.Number
+		if err := json.Unmarshal(data, &number); err != nil {
+			return fmt.Errorf("unexpected PowerShell value %s", data)
+		}
+		*s = PSString(number.String())
+	}
+	return nil
+}
+
+// Numeric values of the HealthStatus and OperationalStatus enums, used when
+// the script output was not converted to strings.
+var (
+	healthStatusNames = map[string]string{"0": "Healthy", "1": "Warning", "2": "Unhealthy", "5": "Unknown"}
+	operationalNames  = map[string]string{"2": "OK", "3": "Degraded", "5": "Predictive Failure", "6": "Error", "10": "Stopped", "11": "In Service", "13": "Lost Communication", "53266": "No Media"}
+)
+
+func (d PhysicalDisk) Health() string {
+	if name, ok := healthStatusNames[string(d.HealthStatus)]; ok {
+		return name
+	}
+	return string(d.HealthStatus)
+}
+
+func (d PhysicalDisk) Operational() []string {
+	var states []string
+	for _, state := range strings.Split(string(d.OperationalStatus), ",") {
+		state = strings.TrimSpace(state)
+		if name, ok := operationalNames[state]; ok {
+			state = name
+		}
+		if state != "" {
+			states = append(states, state)
+		}
+	}
+	return states
+}
+
+// DeviceName returns the Win32 path of the disk, e.g. \\.\PHYSICALDRIVE0.
+func (d PhysicalDisk) DeviceName() string {
+	if _, err := strconv.Atoi(string(d.DeviceID)); err == nil {
+		return `\\.\PHYSICALDRIVE` + string(d.DeviceID)
+	}
+	return string(d.DeviceID)
+}
+
+// ParsePhysicalDisks parses the output of PhysicalDiskScript.
+func ParsePhysicalDisks(output []byte) ([]PhysicalDisk, error) {
+	output = bytes.TrimSpace(output)
+	if len(output) == 0 {
+		return nil, nil
+	}
+	var disks []PhysicalDisk
+	if output[0] == '[' {
+		if err := json.Unmarshal(output, &disks); err != nil {
+			return nil, fmt.Errorf("failed to parse physical disks: %w", err)
+		}
+		return disks, nil
+	}
+	var disk PhysicalDisk
+	if err := json.Unmarshal(output, &disk); err != nil {
+		return nil, fmt.Errorf("failed to parse physical disk: %w", err)
+	}
+	return append(disks, disk), nil
+}
+
+// HealthSnapshot extracts the platform-independent health data of the disk.
+// Drivers without temperature support report 0 rather than null.
+func (d PhysicalDisk) HealthSnapshot() HealthSnapshot {
+	health := HealthSnapshot{
+		HealthStatus:           d.Health(),
+		OperationalStatus:      d.Operational(),
+		Wear:                   d.Wear,
+		PowerOnHours:           d.PowerOnHours,
+		ReadErrorsTotal:        d.ReadErrorsTotal,
+		ReadErrorsUncorrected:  d.ReadErrorsUncorrected,
+		WriteErrorsTotal:       d.WriteErrorsTotal,
+		WriteErrorsUncorrected: d.WriteErrorsUncorrected,
+	}
+	if d.Temperature != nil && *d.Temperature > 0 {
+		health.Temperature = d.Temperature
+	}
+	if d.TemperatureMax != nil && *d.TemperatureMax > 0 {
+		health.TemperatureMax = d.TemperatureMax
+	}
+	return health
+}
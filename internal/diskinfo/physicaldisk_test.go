@@ -0,0 +1,94 @@
+package diskinfo
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func readPhysicalDisks(t *testing.T, name string) []PhysicalDisk {
+	t.Helper()
+	output, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	disks, err := ParsePhysicalDisks(output)
+	if err != nil {
+		t.Fatalf("ParsePhysicalDisks: %v", err)
+	}
+	return disks
+}
+
+func expectCounter[T int | int64](t *testing.T, name string, got *T, want T) {
+	t.Helper()
+	if got == nil {
+		t.Errorf("%s is not reported, want %d", name, want)
+	} else if *got != want {
+		t.Errorf("%s = %d, want %d", name, *got, want)
+	}
+}
+
+func TestParsePhysicalDisksSingleObject(t *testing.T) {
+	disks := readPhysicalDisks(t, "physicaldisk_single.json")
+	if len(disks) != 1 {
+		t.Fatalf("got %d disks, want 1", len(disks))
+	}
+	disk := disks[0]
+	if disk.DeviceName() != `\\.\PHYSICALDRIVE0` {
+		t.Errorf("DeviceName() = %q", disk.DeviceName())
+	}
+	health := disk.HealthSnapshot()
+	if health.HealthStatus != "Healthy" || !reflect.DeepEqual(health.OperationalStatus, []string{"OK"}) {
+		t.Errorf("got health %q, operational %v", health.HealthStatus, health.OperationalStatus)
+	}
+	expectCounter(t, "Temperature", health.Temperature, 34)
+	expectCounter(t, "TemperatureMax", health.TemperatureMax, 52)
+	expectCounter(t, "Wear", health.Wear, 2)
+	expectCounter(t, "PowerOnHours", health.PowerOnHours, 8412)
+	expectCounter(t, "ReadErrorsTotal", health.ReadErrorsTotal, 12)
+	expectCounter(t, "ReadErrorsUncorrected", health.ReadErrorsUncorrected, 0)
+	expectCounter(t, "WriteErrorsTotal", health.WriteErrorsTotal, 3)
+	if status, check, _ := health.ClassifyDisk(); status != StatusSafe || check != CheckOK {
+		t.Errorf("ClassifyDisk() = %s, %s", status, check)
+	}
+}
+
+func TestParsePhysicalDisksNumericEnums(t *testing.T) {
+	disks := readPhysicalDisks(t, "physicaldisk_array.json")
+	if len(disks) != 2 {
+		t.Fatalf("got %d disks, want 2", len(disks))
+	}
+
+	nvme := disks[0].HealthSnapshot()
+	if nvme.HealthStatus != "Healthy" || !reflect.DeepEqual(nvme.OperationalStatus, []string{"OK"}) {
+		t.Errorf("got health %q, operational %v", nvme.HealthStatus, nvme.OperationalStatus)
+	}
+	if nvme.TemperatureMax != nil {
+		t.Errorf("TemperatureMax 0 should be unreported, got %d", *nvme.TemperatureMax)
+	}
+	if nvme.ReadErrorsTotal != nil || nvme.WriteErrorsUncorrected != nil {
+		t.Error("null counters should be unreported")
+	}
+
+	hdd := disks[1].HealthSnapshot()
+	if hdd.HealthStatus != "Warning" || !reflect.DeepEqual(hdd.OperationalStatus, []string{"Predictive Failure", "OK"}) {
+		t.Errorf("got health %q, operational %v", hdd.HealthStatus, hdd.OperationalStatus)
+	}
+	if hdd.Temperature != nil {
+		t.Errorf("Temperature 0 should be unreported, got %d", *hdd.Temperature)
+	}
+	expectCounter(t, "ReadErrorsTotal", hdd.ReadErrorsTotal, 140)
+	expectCounter(t, "ReadErrorsUncorrected", hdd.ReadErrorsUncorrected, 2)
+	expectCounter(t, "PowerOnHours", hdd.PowerOnHours, 31877)
+	if status, check, _ := hdd.ClassifyDisk(); status != StatusWarning || check != CheckHealthStatus {
+		t.Errorf("ClassifyDisk() = %s, %s", status, check)
+	}
+}
+
+func TestParsePhysicalDisksEmpty(t *testing.T) {
+	disks, err := ParsePhysicalDisks([]byte("\r\n"))
+	if err != nil || disks != nil {
+		t.Errorf("got %v, %v", disks, err)
+	}
+}
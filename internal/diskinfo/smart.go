@@ -0,0 +1,205 @@
+package diskinfo
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// SMARTAttribute is an ATA SMART attribute, shaped after the smartctl JSON
+// table so both the smartctl and WMI sources share it.
+type SMARTAttribute struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Value      int        `json:"value"`
+	Worst      int        `json:"worst"`
+	Thresh     int        `json:"thresh"`
+	WhenFailed string     `json:"when_failed"`
+	Flags      SMARTFlags `json:"flags"`
+	Raw        SMARTRaw   `json:"raw"`
+}
+
+type SMARTFlags struct {
+	Value         int    `json:"value"`
+	String        string `json:"string"`
+	Prefailure    bool   `json:"prefailure"`
+	UpdatedOnline bool   `json:"updated_online"`
+	Performance   bool   `json:"performance"`
+	ErrorRate     bool   `json:"error_rate"`
+	EventCount    bool   `json:"event_count"`
+	AutoKeep      bool   `json:"auto_keep"`
+}
+
+// SMARTRaw.Value holds the 48-bit raw counter, which needs 64 bits on 32-bit builds.
+type SMARTRaw struct {
+	Value  int64  `json:"value"`
+	String string `json:"string"`
+}
+
+const (
+	smartAttributeCount = 30
+	smartAttributeSize  = 12
+	// The attribute table starts after the 2-byte data structure revision.
+	smartAttributeOffset = 2
+	// smartAttributeEnd is the length the 512-byte block must at least have
+	// to hold the attribute table.
+	smartAttributeEnd = smartAttributeOffset + smartAttributeCount*smartAttributeSize
+)
+
+// smartAttributeNames are the default smartctl names of the common attributes.
+var smartAttributeNames = map[int]string{
+	1:   "Raw_Read_Error_Rate",
+	3:   "Spin_Up_Time",
+	4:   "Start_Stop_Count",
+	5:   "Reallocated_Sector_Ct",
+	7:   "Seek_Error_Rate",
+	9:   "Power_On_Hours",
+	10:  "Spin_Retry_Count",
+	12:  "Power_Cycle_Count",
+	177: "Wear_Leveling_Count",
+	183: "Runtime_Bad_Block",
+	184: "End-to-End_Error",
+	187: "Reported_Uncorrect",
+	188: "Command_Timeout",
+	190: "Airflow_Temperature_Cel",
+	192: "Power-Off_Retract_Count",
+	193: "Load_Cycle_Count",
+	194: "Temperature_Celsius",
+	196: "Reallocated_Event_Count",
+	197: "Current_Pending_Sector",
+	198: "Offline_Uncorrectable",
+	199: "UDMA_CRC_Error_Count",
+	231: "SSD_Life_Left",
+	233: "Media_Wearout_Indicator",
+	241: "Total_LBAs_Written",
+	242: "Total_LBAs_Read",
+}
+
+// DecodeSMARTData decodes the 512-byte ATA SMART READ DATA block, as returned
+// in MSStorageDriver_FailurePredictData.VendorSpecific, into the attribute
+// table. thresholds is the matching READ THRESHOLDS block from
+// MSStorageDriver_FailurePredictThresholds and may be nil.
+func DecodeSMARTData(data []byte, thresholds []byte) ([]SMARTAttribute, error) {
+	if len(data) < smartAttributeEnd {
+		return nil, fmt.Errorf("SMART data block too short: %d bytes, expected at least %d", len(data), smartAttributeEnd)
+	}
+	thresholdByID := decodeSMARTThresholds(thresholds)
+
+	var attributes []SMARTAttribute
+	for offset := smartAttributeOffset; offset < smartAttributeEnd; offset += smartAttributeSize {
+		entry := data[offset : offset+smartAttributeSize]
+		id := int(entry[0])
+		if id == 0 {
+			continue
+		}
+		flags := int(binary.LittleEndian.Uint16(entry[1:3]))
+		var raw int64
+		for i := 5; i >= 0; i-- {
+			raw = raw<<8 | int64(entry[5+i])
+		}
+		attribute := SMARTAttribute{
+			ID:     id,
+			Name:   smartAttributeName(id),
+			Value:  int(entry[3]),
+			Worst:  int(entry[4]),
+			Thresh: thresholdByID[id],
+			Flags:  decodeSMARTFlags(flags),
+			Raw:    SMARTRaw{Value: raw, String: fmt.Sprintf("%d", raw)},
+		}
+		if id == 190 || id == 194 {
+			attribute.Raw.String = fmt.Sprintf("%d", raw&0xFF)
+		}
+		attribute.WhenFailed = whenFailed(attribute)
+		attributes = append(attributes, attribute)
+	}
+	return attributes, nil
+}
+
+// decodeSMARTThresholds reads the thresholds block, which shares the layout of
+// the data block with the threshold in the second byte of each entry.
+func decodeSMARTThresholds(thresholds []byte) map[int]int {
+	byID := make(map[int]int)
+	if len(thresholds) < smartAttributeEnd {
+		return byID
+	}
+	for offset := smartAttributeOffset; offset < smartAttributeEnd; offset += smartAttributeSize {
+		if id := int(thresholds[offset]); id != 0 {
+			byID[id] = int(thresholds[offset+1])
+		}
+	}
+	return byID
+}
+
+func decodeSMARTFlags(value int) SMARTFlags {
+	flags := SMARTFlags{
+		Value:         value,
+		Prefailure:    value&0x01 != 0,
+		UpdatedOnline: value&0x02 != 0,
+		Performance:   value&0x04 != 0,
+		ErrorRate:     value&0x08 != 0,
+		EventCount:    value&0x10 != 0,
+		AutoKeep:      value&0x20 != 0,
+	}
+	// Same notation as smartctl: POSRCK.
+	var builder strings.Builder
+	for i, letter := range "POSRCK" {
+		if value&(1<<i) != 0 {
+			builder.WriteRune(letter)
+		} else {
+			builder.WriteByte('-')
+		}
+	}
+	flags.String = builder.String()
+	return flags
+}
+
+func smartAttributeName(id int) string {
+	if name, ok := smartAttributeNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("Unknown_Attribute_%d", id)
+}
+
+func whenFailed(attribute SMARTAttribute) string {
+	if attribute.Thresh == 0 {
+		return ""
+	}
+	if attribute.Value <= attribute.Thresh {
+		return "now"
+	}
+	if attribute.Worst <= attribute.Thresh {
+		return "past"
+	}
+	return ""
+}
+
+// AttributeTemperature returns the temperature of attribute 194, or 190 as a
+// fallback. Only the lowest raw byte holds the current value.
+func AttributeTemperature(attributes []SMARTAttribute) (int, bool) {
+	for _, id := range []int{194, 190} {
+		for _, attribute := range attributes {
+			if attribute.ID == id {
+				return int(attribute.Raw.Value & 0xFF), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// ClassifyAttributes applies the ATA attribute checks. found is false when no
+// attribute raised a finding.
+func ClassifyAttributes(attributes []SMARTAttribute) (status StatusType, check, condition string, found bool) {
+	// Verificar atributos relevantes de sectores reasignados o pendientes
+	for _, attr := range attributes {
+		if attr.ID == 5 && attr.Raw.Value > 0 {
+			return StatusWarning, CheckReallocatedSectors, "Reallocated sectors count is greater than 0", true
+		}
+		if attr.ID == 196 && attr.Raw.Value > 0 {
+			return StatusWarning, CheckReallocatedEvents, "Reallocated event count is greater than 0", true
+		}
+		if attr.ID == 197 && attr.Raw.Value > 0 {
+			return StatusWarning, CheckPendingSectors, "Current pending sector count is greater than 0", true
+		}
+	}
+	return StatusSafe, CheckOK, "", false
+}
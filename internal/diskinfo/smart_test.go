@@ -0,0 +1,97 @@
+package diskinfo
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readHexFixture reads a block dumped as hex bytes, 16 per line.
+func readHexFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := hex.DecodeString(strings.Join(strings.Fields(string(content)), ""))
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return data
+}
+
+func TestDecodeSMARTData(t *testing.T) {
+	data := readHexFixture(t, "smart_data.hex")
+	thresholds := readHexFixture(t, "smart_thresholds.hex")
+	if len(data) != 512 || len(thresholds) != 512 {
+		t.Fatalf("fixture sizes %d and %d, want 512", len(data), len(thresholds))
+	}
+	attributes, err := DecodeSMARTData(data, thresholds)
+	if err != nil {
+		t.Fatalf("DecodeSMARTData: %v", err)
+	}
+
+	tests := []struct {
+		id         int
+		name       string
+		value      int
+		worst      int
+		thresh     int
+		flags      string
+		raw        int64
+		rawString  string
+		whenFailed string
+	}{
+		{1, "Raw_Read_Error_Rate", 200, 40, 51, "POSR-K", 0, "0", "past"},
+		{5, "Reallocated_Sector_Ct", 100, 100, 140, "PO--CK", 8, "8", "now"},
+		{9, "Power_On_Hours", 99, 99, 0, "-O--CK", 1234, "1234", ""},
+		// Only the lowest byte of the temperature raw value is the current one.
+		{194, "Temperature_Celsius", 114, 98, 0, "-O---K", 45<<32 | 18<<16 | 36, "36", ""},
+		{197, "Current_Pending_Sector", 200, 200, 0, "-O--CK", 0, "0", ""},
+		{199, "UDMA_CRC_Error_Count", 200, 200, 0, "-OSRCK", 3, "3", ""},
+		// The raw value spans all six bytes.
+		{241, "Total_LBAs_Written", 99, 99, 0, "-O--CK", 0x017654321000, "1607730335744", ""},
+	}
+	if len(attributes) != len(tests) {
+		t.Fatalf("got %d attributes, want %d: %+v", len(attributes), len(tests), attributes)
+	}
+	for i, test := range tests {
+		got := attributes[i]
+		if got.ID != test.id || got.Name != test.name || got.Value != test.value || got.Worst != test.worst || got.Thresh != test.thresh {
+			t.Errorf("attribute %d: got %d %s value %d worst %d thresh %d", test.id, got.ID, got.Name, got.Value, got.Worst, got.Thresh)
+		}
+		if got.Flags.String != test.flags || got.Raw.Value != test.raw || got.Raw.String != test.rawString || got.WhenFailed != test.whenFailed {
+			t.Errorf("attribute %d: got flags %s raw %d (%s) when failed %q", test.id, got.Flags.String, got.Raw.Value, got.Raw.String, got.WhenFailed)
+		}
+	}
+
+	if temperature, ok := AttributeTemperature(attributes); !ok || temperature != 36 {
+		t.Errorf("AttributeTemperature() = %d, %v", temperature, ok)
+	}
+}
+
+func TestDecodeSMARTDataWithoutThresholds(t *testing.T) {
+	attributes, err := DecodeSMARTData(readHexFixture(t, "smart_data.hex"), nil)
+	if err != nil {
+		t.Fatalf("DecodeSMARTData: %v", err)
+	}
+	for _, attribute := range attributes {
+		if attribute.Thresh != 0 || attribute.WhenFailed != "" {
+			t.Errorf("attribute %d: got thresh %d when failed %q", attribute.ID, attribute.Thresh, attribute.WhenFailed)
+		}
+	}
+}
+
+func TestDecodeSMARTDataLength(t *testing.T) {
+	data := readHexFixture(t, "smart_data.hex")
+	// The attribute table ends at byte 362, the rest of the block is not needed.
+	if _, err := DecodeSMARTData(data[:362], nil); err != nil {
+		t.Errorf("DecodeSMARTData of the attribute table: %v", err)
+	}
+	_, err := DecodeSMARTData(data[:361], nil)
+	if err == nil || err.Error() != "SMART data block too short: 361 bytes, expected at least 362" {
+		t.Errorf("got %v", err)
+	}
+}
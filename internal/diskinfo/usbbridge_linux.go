@@ -0,0 +1,111 @@
+//go:build linux
+
+package diskinfo
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BridgeDeviceTypes are the smartctl -d values tried, in order, for disks
+// behind a USB bridge smartctl does not recognize.
+var BridgeDeviceTypes = []string{
+	"sat",
+	"sat,12",
+	"usbjmicron",
+	"usbprolific",
+	"usbsunplus",
+	"usbcypress",
+	"sntjmicron",
+	"sntasmedia",
+	"sntrealtek",
+}
+
+// bridgeProbeBackoff is how long a disk for which no bridge device type
+// worked is read without trying them again.
+const bridgeProbeBackoff = time.Hour
+
+// deviceTypeCache remembers the smartctl device type that works for each
+// disk. An empty type means smartctl detects the disk on its own. Disks for
+// which no type worked are remembered until their next probe.
+type deviceTypeCache struct {
+	mu      sync.Mutex
+	types   map[string]string
+	retryAt map[string]time.Time
+}
+
+func newDeviceTypeCache() *deviceTypeCache {
+	return &deviceTypeCache{types: make(map[string]string), retryAt: make(map[string]time.Time)}
+}
+
+func (c *deviceTypeCache) get(disk string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	deviceType, ok := c.types[disk]
+	return deviceType, ok
+}
+
+func (c *deviceTypeCache) set(disk, deviceType string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.types[disk] = deviceType
+	delete(c.retryAt, disk)
+}
+
+// probeFailed records that no device type worked for the disk, so they are
+// not tried again before the back-off ends.
+func (c *deviceTypeCache) probeFailed(disk string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.retryAt[disk] = now.Add(bridgeProbeBackoff)
+}
+
+// backingOff reports whether the device types are not to be tried yet for
+// the disk.
+func (c *deviceTypeCache) backingOff(disk string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	retryAt, ok := c.retryAt[disk]
+	return ok && now.Before(retryAt)
+}
+
+func (c *deviceTypeCache) forget(disk string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.types, disk)
+}
+
+// isUSBBridgeError reports whether smartctl asked for an explicit device type,
+// which it does for USB bridges missing from its database.
+func isUSBBridgeError(data *SmartctlOutput) bool {
+	if data == nil {
+		return false
+	}
+	for _, message := range data.Smartctl.Messages {
+		if strings.Contains(message.String, "Unknown USB bridge") ||
+			strings.Contains(message.String, "specify device type with the -d option") {
+			return true
+		}
+	}
+	return false
+}
+
+// needsDeviceType reports whether a USB disk was only reached as a plain SCSI
+// device, without any SMART data, so a bridge device type is worth trying.
+func (l LinuxDiskInfo) needsDeviceType(disk string, data *SmartctlOutput) bool {
+	if data == nil || data.SmartStatus != nil || data.ATASMARTAttributes != nil || data.NVMESMARTHealthInformationLog != nil {
+		return false
+	}
+	return isUSBDevice(DefaultSysRoot, disk)
+}
+
+func isUSBDevice(sysRoot, disk string) bool {
+	name := filepath.Base(ParentDevice(sysRoot, disk))
+	resolved, err := filepath.EvalSymlinks(filepath.Join(sysRoot, "class", "block", name))
+	if err != nil {
+		return false
+	}
+	return strings.Contains(resolved, "/usb")
+}
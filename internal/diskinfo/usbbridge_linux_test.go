@@ -0,0 +1,133 @@
+//go:build linux
+
+package diskinfo
+
+import (
+	"context"
+	"errors"
+	"gama-client/internal/cmdrunner"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const unknownBridgeOutput = `{
+  "json_format_version": [1, 0],
+  "smartctl": {
+    "version": [7, 3],
+    "messages": [
+      {"string": "/dev/sdz: Unknown USB bridge [0x152d:0x0583 (0x209)]", "severity": "error"},
+      {"string": "Please specify device type with the -d option.", "severity": "error"}
+    ],
+    "exit_status": 0
+  },
+  "device": {"name": "/dev/sdz", "type": "scsi", "protocol": "SCSI"}
+}`
+
+// bridgeRunner answers like a USB bridge none of the device types reaches.
+func bridgeRunner(calls *int) cmdrunner.Runner {
+	return cmdrunner.RunnerFunc(func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		*calls++
+		if slices.Contains(args, "-d") {
+			return nil, errors.New("device open failed")
+		}
+		return []byte(unknownBridgeOutput), nil
+	})
+}
+
+func TestGetSmartDataBacksOffWhenNoDeviceTypeWorks(t *testing.T) {
+	var calls int
+	l := LinuxDiskInfo{ctx: context.Background(), runner: bridgeRunner(&calls), deviceTypes: newDeviceTypeCache()}
+
+	if _, err := l.getSmartData("/dev/sdz"); err != nil {
+		t.Fatalf("getSmartData: %v", err)
+	}
+	if want := 1 + len(BridgeDeviceTypes); calls != want {
+		t.Fatalf("first read ran smartctl %d times, want %d", calls, want)
+	}
+
+	calls = 0
+	if _, err := l.getSmartData("/dev/sdz"); err != nil {
+		t.Fatalf("getSmartData: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("read during the back-off ran smartctl %d times, want 1", calls)
+	}
+
+	l.deviceTypes.probeFailed("/dev/sdz", time.Now().Add(-bridgeProbeBackoff))
+	calls = 0
+	if _, err := l.getSmartData("/dev/sdz"); err != nil {
+		t.Fatalf("getSmartData: %v", err)
+	}
+	if want := 1 + len(BridgeDeviceTypes); calls != want {
+		t.Errorf("read after the back-off ran smartctl %d times, want %d", calls, want)
+	}
+}
+
+const satOutput = `{
+  "json_format_version": [1, 0],
+  "smartctl": {"version": [7, 3], "exit_status": 0},
+  "device": {"name": "/dev/sdz", "type": "sat", "protocol": "ATA"},
+  "smart_status": {"passed": true},
+  "temperature": {"current": 34}
+}`
+
+// satRunner answers like a USB bridge smartctl only reaches with -d sat, and
+// records the arguments of every call.
+func satRunner(calls *[]string) cmdrunner.Runner {
+	return cmdrunner.RunnerFunc(func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		*calls = append(*calls, strings.Join(args, " "))
+		switch {
+		case !slices.Contains(args, "-d"):
+			return []byte(unknownBridgeOutput), &cmdrunner.ExitError{ExitCode: 1}
+		case slices.Contains(args, "sat"):
+			return []byte(satOutput), nil
+		}
+		return nil, errors.New("device open failed")
+	})
+}
+
+func TestGetSmartDataCachesWorkingDeviceType(t *testing.T) {
+	var calls []string
+	l := LinuxDiskInfo{ctx: context.Background(), runner: satRunner(&calls), deviceTypes: newDeviceTypeCache()}
+
+	data, err := l.getSmartData("/dev/sdz")
+	if err != nil {
+		t.Fatalf("getSmartData: %v", err)
+	}
+	if data.SmartStatus == nil || !data.SmartStatus.Passed {
+		t.Errorf("got %+v, want the SMART data read through -d sat", data)
+	}
+	want := []string{"-a -x -j /dev/sdz", "-a -x -j -d sat /dev/sdz"}
+	if !slices.Equal(calls, want) {
+		t.Fatalf("got calls %q, want %q", calls, want)
+	}
+	if deviceType, ok := l.deviceTypes.get("/dev/sdz"); !ok || deviceType != "sat" {
+		t.Errorf("got cached device type %q, %v, want sat", deviceType, ok)
+	}
+
+	calls = nil
+	if _, err := l.getSmartData("/dev/sdz"); err != nil {
+		t.Fatalf("getSmartData: %v", err)
+	}
+	if want := []string{"-a -x -j -d sat /dev/sdz"}; !slices.Equal(calls, want) {
+		t.Errorf("got calls %q, want %q", calls, want)
+	}
+}
+
+func TestDeviceTypeCacheSetEndsBackOff(t *testing.T) {
+	cache := newDeviceTypeCache()
+	now := time.Now()
+	cache.probeFailed("/dev/sdz", now)
+	if !cache.backingOff("/dev/sdz", now.Add(bridgeProbeBackoff-time.Second)) {
+		t.Error("expected a back-off")
+	}
+	if cache.backingOff("/dev/sdz", now.Add(bridgeProbeBackoff)) {
+		t.Error("back-off should end")
+	}
+	cache.set("/dev/sdz", "sat")
+	if cache.backingOff("/dev/sdz", now) {
+		t.Error("a working device type should end the back-off")
+	}
+}
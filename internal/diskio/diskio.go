@@ -0,0 +1,141 @@
+package diskio
+
+import (
+	"context"
+	"fmt"
+	"gama-client/internal/diskinfo"
+	"github.com/shirou/gopsutil/v3/disk"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// IOStats holds the throughput, latency and utilization of a block device
+// computed over the interval between two consecutive collections.
+type IOStats struct {
+	DeviceName         string
+	Interval           time.Duration
+	ReadBytesPerSec    float64
+	WriteBytesPerSec   float64
+	ReadIOPS           float64
+	WriteIOPS          float64
+	ReadAwaitMs        float64
+	WriteAwaitMs       float64
+	AwaitMs            float64
+	UtilizationPercent float64
+	IOsInProgress      uint64
+}
+
+// Collector samples the kernel I/O counters and turns them into rates.
+// The first call to Collect only primes the previous sample.
+type Collector struct {
+	ctx        context.Context
+	sysRoot    string
+	previous   map[string]disk.IOCountersStat
+	previousAt time.Time
+}
+
+func NewCollector(ctx context.Context) *Collector {
+	return &Collector{ctx: ctx, sysRoot: diskinfo.DefaultSysRoot}
+}
+
+func (c *Collector) Collect() ([]IOStats, error) {
+	counters, err := disk.IOCountersWithContext(c.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read disk io counters: %w", err)
+	}
+	return c.update(counters, time.Now()), nil
+}
+
+// update computes the rates since the previous sample and replaces it with
+// counters. Partitions are skipped, their I/O is accounted to the disk.
+func (c *Collector) update(counters map[string]disk.IOCountersStat, now time.Time) []IOStats {
+	previous, previousAt := c.previous, c.previousAt
+	c.previous, c.previousAt = counters, now
+	if previous == nil {
+		return nil
+	}
+
+	interval := now.Sub(previousAt)
+	if interval <= 0 {
+		return nil
+	}
+	var stats []IOStats
+	for name, current := range counters {
+		if skipDevice(name) || c.isPartition(name) {
+			continue
+		}
+		last, ok := previous[name]
+		if !ok || counterReset(last, current) {
+			continue
+		}
+		stats = append(stats, computeStats(devicePath(name), last, current, interval))
+	}
+	return stats
+}
+
+func computeStats(device string, last, current disk.IOCountersStat, interval time.Duration) IOStats {
+	seconds := interval.Seconds()
+	reads := float64(current.ReadCount - last.ReadCount)
+	writes := float64(current.WriteCount - last.WriteCount)
+	readTime := float64(current.ReadTime - last.ReadTime)
+	writeTime := float64(current.WriteTime - last.WriteTime)
+	ioTime := float64(current.IoTime - last.IoTime)
+
+	stats := IOStats{
+		DeviceName:       device,
+		Interval:         interval,
+		ReadBytesPerSec:  float64(current.ReadBytes-last.ReadBytes) / seconds,
+		WriteBytesPerSec: float64(current.WriteBytes-last.WriteBytes) / seconds,
+		ReadIOPS:         reads / seconds,
+		WriteIOPS:        writes / seconds,
+		IOsInProgress:    current.IopsInProgress,
+	}
+	if reads > 0 {
+		stats.ReadAwaitMs = readTime / reads
+	}
+	if writes > 0 {
+		stats.WriteAwaitMs = writeTime / writes
+	}
+	if reads+writes > 0 {
+		stats.AwaitMs = (readTime + writeTime) / (reads + writes)
+	}
+	// IoTime is the time in milliseconds the device had requests queued.
+	stats.UtilizationPercent = ioTime / float64(interval.Milliseconds()) * 100
+	if stats.UtilizationPercent > 100 {
+		stats.UtilizationPercent = 100
+	}
+	return stats
+}
+
+// counterReset reports whether any counter went backwards, which happens
+// when a device is re-attached or a counter wraps.
+func counterReset(last, current disk.IOCountersStat) bool {
+	return current.ReadCount < last.ReadCount ||
+		current.WriteCount < last.WriteCount ||
+		current.ReadBytes < last.ReadBytes ||
+		current.WriteBytes < last.WriteBytes ||
+		current.ReadTime < last.ReadTime ||
+		current.WriteTime < last.WriteTime ||
+		current.IoTime < last.IoTime
+}
+
+func skipDevice(name string) bool {
+	return strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") || strings.HasPrefix(name, "zram")
+}
+
+// isPartition reports whether sysfs marks the block device as a partition.
+// It is false where there is no sysfs.
+func (c *Collector) isPartition(name string) bool {
+	_, err := os.Stat(filepath.Join(c.sysRoot, "class", "block", name, "partition"))
+	return err == nil
+}
+
+func devicePath(name string) string {
+	if runtime.GOOS == "linux" {
+		return "/dev/" + name
+	}
+	return name
+}
@@ -0,0 +1,137 @@
+package diskio
+
+import (
+	"context"
+	"github.com/shirou/gopsutil/v3/disk"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func counters(readCount, writeCount, readBytes, writeBytes, readTime, writeTime, ioTime uint64) disk.IOCountersStat {
+	return disk.IOCountersStat{
+		ReadCount:  readCount,
+		WriteCount: writeCount,
+		ReadBytes:  readBytes,
+		WriteBytes: writeBytes,
+		ReadTime:   readTime,
+		WriteTime:  writeTime,
+		IoTime:     ioTime,
+	}
+}
+
+func TestComputeStats(t *testing.T) {
+	last := counters(1000, 500, 1<<20, 1<<21, 4000, 9000, 10000)
+	current := counters(1200, 600, 1<<20+10<<20, 1<<21+5<<20, 4600, 9800, 12500)
+	current.IopsInProgress = 3
+	got := computeStats("/dev/sda", last, current, 10*time.Second)
+	want := IOStats{
+		DeviceName:         "/dev/sda",
+		Interval:           10 * time.Second,
+		ReadBytesPerSec:    1 << 20,
+		WriteBytesPerSec:   512 << 10,
+		ReadIOPS:           20,
+		WriteIOPS:          10,
+		ReadAwaitMs:        3,
+		WriteAwaitMs:       8,
+		AwaitMs:            1400.0 / 300,
+		UtilizationPercent: 25,
+		IOsInProgress:      3,
+	}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestComputeStatsIdle(t *testing.T) {
+	sample := counters(1000, 500, 1<<20, 1<<21, 4000, 9000, 10000)
+	got := computeStats("/dev/sda", sample, sample, 10*time.Second)
+	if got.ReadAwaitMs != 0 || got.WriteAwaitMs != 0 || got.AwaitMs != 0 || got.UtilizationPercent != 0 {
+		t.Errorf("got %+v, want no latency without I/O", got)
+	}
+
+	// The busy time can exceed the interval by the sampling jitter.
+	busy := sample
+	busy.IoTime += 10100
+	if got := computeStats("/dev/sda", sample, busy, 10*time.Second); got.UtilizationPercent != 100 {
+		t.Errorf("got utilization %v, want 100", got.UtilizationPercent)
+	}
+}
+
+func TestCounterReset(t *testing.T) {
+	last := counters(1000, 500, 1<<20, 1<<21, 4000, 9000, 10000)
+	tests := []struct {
+		name    string
+		current disk.IOCountersStat
+		want    bool
+	}{
+		{name: "unchanged", current: last},
+		{name: "increasing", current: counters(1001, 501, 1<<20+512, 1<<21+512, 4001, 9001, 10001)},
+		{name: "reads wrapped", current: counters(3, 501, 1<<20+512, 1<<21+512, 4001, 9001, 10001), want: true},
+		{name: "bytes wrapped", current: counters(1001, 501, 1<<20+512, 1024, 4001, 9001, 10001), want: true},
+		{name: "busy time wrapped", current: counters(1001, 501, 1<<20+512, 1<<21+512, 4001, 9001, 12), want: true},
+		{name: "device re-attached", current: counters(0, 0, 0, 0, 0, 0, 0), want: true},
+	}
+	for _, test := range tests {
+		if got := counterReset(last, test.current); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSkipDevice(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "loop0", want: true},
+		{name: "ram15", want: true},
+		{name: "zram0", want: true},
+		{name: "sda"},
+		{name: "nvme0n1"},
+		{name: "dm-0"},
+	}
+	for _, test := range tests {
+		if got := skipDevice(test.name); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	collector := NewCollector(context.Background())
+	collector.sysRoot = filepath.Join("testdata", "sys")
+	start := time.Unix(1700000000, 0)
+	idle := counters(1000, 500, 1<<20, 1<<21, 4000, 9000, 10000)
+	busy := counters(1200, 600, 1<<20+10<<20, 1<<21+5<<20, 4600, 9800, 12500)
+
+	first := map[string]disk.IOCountersStat{"sda": idle, "sda1": idle, "nvme0n1": idle, "nvme0n1p2": idle, "loop0": idle, "sdb": busy}
+	if stats := collector.update(first, start); stats != nil {
+		t.Fatalf("got %+v for the first sample, want none", stats)
+	}
+
+	// sdb was reset and sdc has no previous sample.
+	second := map[string]disk.IOCountersStat{"sda": busy, "sda1": busy, "nvme0n1": busy, "nvme0n1p2": busy, "loop0": busy, "sdb": idle, "sdc": busy}
+	stats := collector.update(second, start.Add(10*time.Second))
+	var devices []string
+	for _, device := range stats {
+		devices = append(devices, device.DeviceName)
+		if device.ReadIOPS != 20 || device.UtilizationPercent != 25 {
+			t.Errorf("%s: got %+v", device.DeviceName, device)
+		}
+	}
+	sort.Strings(devices)
+	if len(devices) != 2 || devices[0] != devicePath("nvme0n1") || devices[1] != devicePath("sda") {
+		t.Errorf("got devices %q, want the nvme0n1 and sda disks", devices)
+	}
+
+	// The reset counters are the previous sample of the next collection.
+	third := map[string]disk.IOCountersStat{"sdb": busy}
+	if stats := collector.update(third, start.Add(20*time.Second)); len(stats) != 1 || stats[0].ReadIOPS != 20 {
+		t.Errorf("got %+v, want the rates of sdb since its reset", stats)
+	}
+	if stats := collector.update(third, start.Add(20*time.Second)); stats != nil {
+		t.Errorf("got %+v for an empty interval, want none", stats)
+	}
+}
@@ -0,0 +1,84 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaultRange is the range of the queries without from.
+const defaultRange = 24 * time.Hour
+
+// NewHandler serves the history as JSON:
+//
+//	GET /api/v1/disks                          latest classification of every disk
+//	GET /api/v1/disks/{disk_id}/status         classifications of a disk
+//	GET /api/v1/disks/{disk_id}/attributes     SMART attributes of a disk, ?id= for one
+//
+// The ranges are selected with from and to, as RFC 3339 times, and default to
+// the last 24 hours.
+func NewHandler(store *Store) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/disks", func(w http.ResponseWriter, r *http.Request) {
+		disks, err := store.Disks()
+		writeJSON(w, disks, err)
+	})
+	mux.HandleFunc("GET /api/v1/disks/{disk}/status", func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := parseRange(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		points, err := store.Status(r.PathValue("disk"), from, to)
+		writeJSON(w, points, err)
+	})
+	mux.HandleFunc("GET /api/v1/disks/{disk}/attributes", func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := parseRange(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		id := 0
+		if value := r.URL.Query().Get("id"); value != "" {
+			if id, err = strconv.Atoi(value); err != nil {
+				http.Error(w, fmt.Sprintf("invalid id %q", value), http.StatusBadRequest)
+				return
+			}
+		}
+		series, err := store.Attributes(r.PathValue("disk"), id, from, to)
+		writeJSON(w, series, err)
+	})
+	return mux
+}
+
+func parseRange(r *http.Request) (time.Time, time.Time, error) {
+	query := r.URL.Query()
+	to := time.Now()
+	if value := query.Get("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to %q", value)
+		}
+		to = parsed
+	}
+	from := to.Add(-defaultRange)
+	if value := query.Get("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from %q", value)
+		}
+		from = parsed
+	}
+	return from, to, nil
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
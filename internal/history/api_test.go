@@ -0,0 +1,79 @@
+package history
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	store := openStore(t)
+	recordBucket(t, store)
+	handler := NewHandler(store)
+	from, to := t0.Format(time.RFC3339), t0.Add(time.Hour).Format(time.RFC3339)
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+		count  int
+	}{
+		{name: "disks", target: "/api/v1/disks", status: http.StatusOK, count: 2},
+		{name: "status", target: "/api/v1/disks/sda/status?from=" + from + "&to=" + to, status: http.StatusOK, count: 5},
+		{name: "status range", target: "/api/v1/disks/sda/status?from=" + from + "&to=" + t0.Add(4*time.Minute).Format(time.RFC3339), status: http.StatusOK, count: 2},
+		{name: "default range", target: "/api/v1/disks/sda/status", status: http.StatusOK, count: 0},
+		{name: "attributes", target: "/api/v1/disks/sda/attributes?from=" + from + "&to=" + to, status: http.StatusOK, count: 1},
+		{name: "attribute", target: "/api/v1/disks/sda/attributes?id=5&from=" + from + "&to=" + to, status: http.StatusOK, count: 1},
+		{name: "unknown disk", target: "/api/v1/disks/sdz/status?from=" + from, status: http.StatusOK, count: 0},
+		{name: "bad from", target: "/api/v1/disks/sda/status?from=yesterday", status: http.StatusBadRequest},
+		{name: "bad to", target: "/api/v1/disks/sda/attributes?to=1700000000", status: http.StatusBadRequest},
+		{name: "bad id", target: "/api/v1/disks/sda/attributes?id=reallocated", status: http.StatusBadRequest},
+		{name: "method", target: "/api/v1/disks", status: http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			method := http.MethodGet
+			if test.status == http.StatusMethodNotAllowed {
+				method = http.MethodPost
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(method, test.target, nil))
+			if recorder.Code != test.status {
+				t.Fatalf("got status %d, want %d: %s", recorder.Code, test.status, recorder.Body)
+			}
+			if test.status != http.StatusOK {
+				return
+			}
+			if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("got Content-Type %q", contentType)
+			}
+			var items []json.RawMessage
+			if err := json.Unmarshal(recorder.Body.Bytes(), &items); err != nil {
+				t.Fatalf("invalid body %s: %v", recorder.Body, err)
+			}
+			if len(items) != test.count {
+				t.Errorf("got %d items, want %d: %s", len(items), test.count, recorder.Body)
+			}
+		})
+	}
+}
+
+func TestHandlerStatusFields(t *testing.T) {
+	store := openStore(t)
+	recordBucket(t, store)
+	recorder := httptest.NewRecorder()
+	NewHandler(store).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/disks", nil))
+	var disks []map[string]interface{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &disks); err != nil {
+		t.Fatal(err)
+	}
+	sda, sdb := disks[0], disks[1]
+	if sda["disk_id"] != "sda" || sda["status"] != "Safe" || sda["temperature"] != float64(41) || sda["time"] != "2023-11-14T22:32:00Z" {
+		t.Errorf("got %v", sda)
+	}
+	if _, ok := sdb["temperature"]; ok {
+		t.Errorf("got a temperature for a disk without one: %v", sdb)
+	}
+}
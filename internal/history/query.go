@@ -0,0 +1,137 @@
+package history
+
+import (
+	"database/sql"
+	"time"
+)
+
+// StatusPoint is a classification of a disk, or the worst one of a
+// downsampling bucket, whose Temperature is the average and Samples the
+// number of merged classifications.
+type StatusPoint struct {
+	Time           time.Time `json:"time"`
+	Host           string    `json:"host"`
+	Client         string    `json:"client"`
+	Device         string    `json:"device"`
+	DiskID         string    `json:"disk_id"`
+	Status         string    `json:"status"`
+	Check          string    `json:"check"`
+	Condition      string    `json:"condition"`
+	Temperature    *int      `json:"temperature,omitempty"`
+	TemperatureMax *int      `json:"temperature_max,omitempty"`
+	Samples        int       `json:"samples"`
+}
+
+// AttributePoint is a reading of a SMART attribute. Downsampled points hold
+// the lowest normalized values and the highest raw value of their bucket.
+type AttributePoint struct {
+	Time    time.Time `json:"time"`
+	Value   int       `json:"value"`
+	Worst   int       `json:"worst"`
+	Thresh  int       `json:"thresh"`
+	Raw     int64     `json:"raw"`
+	Samples int       `json:"samples"`
+}
+
+// AttributeDelta is the change of an attribute between the first and the
+// last point of a range.
+type AttributeDelta struct {
+	Value int   `json:"value"`
+	Raw   int64 `json:"raw"`
+}
+
+// AttributeSeries is the history of a SMART attribute of a disk.
+type AttributeSeries struct {
+	ID     int              `json:"id"`
+	Name   string           `json:"name"`
+	Points []AttributePoint `json:"points"`
+	Delta  AttributeDelta   `json:"delta"`
+}
+
+const statusColumns = `time, host, client, device, disk_id, status, level, check_id, condition, temperature, temperature_max, samples`
+
+func scanStatus(rows *sql.Rows) (StatusPoint, int, error) {
+	var point StatusPoint
+	var unix int64
+	var level int
+	var temperature, temperatureMax sql.NullInt64
+	err := rows.Scan(&unix, &point.Host, &point.Client, &point.Device, &point.DiskID, &point.Status, &level,
+		&point.Check, &point.Condition, &temperature, &temperatureMax, &point.Samples)
+	point.Time = time.Unix(unix, 0).UTC()
+	point.Temperature = nullInt(temperature)
+	point.TemperatureMax = nullInt(temperatureMax)
+	return point, level, err
+}
+
+func nullInt(value sql.NullInt64) *int {
+	if !value.Valid {
+		return nil
+	}
+	converted := int(value.Int64)
+	return &converted
+}
+
+// Disks returns the latest classification of every disk.
+func (s *Store) Disks() ([]StatusPoint, error) {
+	rows, err := s.db.Query(`SELECT ` + statusColumns + ` FROM disk_status AS d
+		WHERE time = (SELECT max(time) FROM disk_status WHERE disk_id = d.disk_id) ORDER BY device`)
+	if err != nil {
+		return nil, err
+	}
+	return collectStatus(rows)
+}
+
+// Status returns the classifications of a disk between from and to, oldest
+// first.
+func (s *Store) Status(diskID string, from, to time.Time) ([]StatusPoint, error) {
+	rows, err := s.db.Query(`SELECT `+statusColumns+` FROM disk_status
+		WHERE disk_id = ? AND time >= ? AND time <= ? ORDER BY time`, diskID, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	return collectStatus(rows)
+}
+
+func collectStatus(rows *sql.Rows) ([]StatusPoint, error) {
+	defer rows.Close()
+	points := []StatusPoint{}
+	for rows.Next() {
+		point, _, err := scanStatus(rows)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, point)
+	}
+	return points, rows.Err()
+}
+
+// Attributes returns the SMART attributes of a disk between from and to, all
+// of them when id is 0.
+func (s *Store) Attributes(diskID string, id int, from, to time.Time) ([]AttributeSeries, error) {
+	rows, err := s.db.Query(`SELECT id, name, time, value, worst, thresh, raw, samples FROM smart_attribute
+		WHERE disk_id = ? AND (? = 0 OR id = ?) AND time >= ? AND time <= ? ORDER BY id, time`,
+		diskID, id, id, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	series := []AttributeSeries{}
+	for rows.Next() {
+		var attributeID int
+		var name string
+		var unix int64
+		var point AttributePoint
+		if err := rows.Scan(&attributeID, &name, &unix, &point.Value, &point.Worst, &point.Thresh, &point.Raw, &point.Samples); err != nil {
+			return nil, err
+		}
+		point.Time = time.Unix(unix, 0).UTC()
+		if len(series) == 0 || series[len(series)-1].ID != attributeID {
+			series = append(series, AttributeSeries{ID: attributeID, Name: name})
+		}
+		current := &series[len(series)-1]
+		current.Points = append(current.Points, point)
+		first := current.Points[0]
+		current.Delta = AttributeDelta{Value: point.Value - first.Value, Raw: point.Raw - first.Raw}
+	}
+	return series, rows.Err()
+}
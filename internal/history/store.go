@@ -0,0 +1,264 @@
+package history
+
+import (
+	"database/sql"
+	"fmt"
+	"gama-client/internal/diskinfo"
+	_ "modernc.org/sqlite"
+	"time"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS disk_status (
+	time            INTEGER NOT NULL,
+	host            TEXT    NOT NULL,
+	client          TEXT    NOT NULL,
+	device          TEXT    NOT NULL,
+	disk_id         TEXT    NOT NULL,
+	status          TEXT    NOT NULL,
+	level           INTEGER NOT NULL,
+	check_id        TEXT    NOT NULL,
+	condition       TEXT    NOT NULL,
+	temperature     INTEGER,
+	temperature_max INTEGER,
+	samples         INTEGER NOT NULL,
+	downsampled     INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS disk_status_disk ON disk_status (disk_id, time);
+CREATE INDEX IF NOT EXISTS disk_status_time ON disk_status (downsampled, time);
+CREATE TABLE IF NOT EXISTS smart_attribute (
+	time        INTEGER NOT NULL,
+	disk_id     TEXT    NOT NULL,
+	id          INTEGER NOT NULL,
+	name        TEXT    NOT NULL,
+	value       INTEGER NOT NULL,
+	worst       INTEGER NOT NULL,
+	thresh      INTEGER NOT NULL,
+	raw         INTEGER NOT NULL,
+	samples     INTEGER NOT NULL,
+	downsampled INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS smart_attribute_disk ON smart_attribute (disk_id, id, time);
+CREATE INDEX IF NOT EXISTS smart_attribute_time ON smart_attribute (downsampled, time);
+`
+
+// Store keeps the classified disks and their SMART attributes in a SQLite
+// database. Rows older than the retention are merged into one row per disk
+// and downsampling bucket, which are kept for the downsampled retention.
+type Store struct {
+	db                   *sql.DB
+	retention            time.Duration
+	bucket               time.Duration
+	downsampledRetention time.Duration
+}
+
+// Open creates the database at path, or opens the one of a previous run.
+func Open(path string, retention, bucket, downsampledRetention time.Duration) (*Store, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history database: %w", err)
+	}
+	// A single connection serializes the writes, which SQLite requires.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create history schema: %w", err)
+	}
+	return &Store{db: db, retention: retention, bucket: bucket, downsampledRetention: downsampledRetention}, nil
+}
+
+// Record stores the disks of a collection and returns the number of rows
+// written.
+func (s *Store) Record(host, client string, at time.Time, disks []diskinfo.DiskInfo) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	rows := 0
+	for _, disk := range disks {
+		diskID := diskinfo.DiskID(disk.DeviceName)
+		var temperature sql.NullInt64
+		if disk.TemperatureSource != "" {
+			temperature = sql.NullInt64{Int64: int64(disk.Temperature), Valid: true}
+		}
+		_, err := tx.Exec(`INSERT INTO disk_status VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1, 0)`,
+			at.Unix(), host, client, disk.DeviceName, diskID, string(disk.Status), disk.StatusToInt(), disk.Check, disk.Condition, temperature, temperature)
+		if err != nil {
+			return 0, err
+		}
+		rows++
+		for _, attribute := range disk.Health.Attributes {
+			_, err := tx.Exec(`INSERT INTO smart_attribute VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1, 0)`,
+				at.Unix(), diskID, attribute.ID, attribute.Name, attribute.Value, attribute.Worst, attribute.Thresh, attribute.Raw.Value)
+			if err != nil {
+				return 0, err
+			}
+			rows++
+		}
+	}
+	return rows, tx.Commit()
+}
+
+type statusKey struct {
+	bucket int64
+	diskID string
+}
+
+type attributeKey struct {
+	bucket int64
+	diskID string
+	id     int
+}
+
+// Downsample merges the rows older than the retention into their bucket and
+// deletes the downsampled rows older than the downsampled retention. Only
+// whole buckets are merged, so each bucket is merged once.
+func (s *Store) Downsample(now time.Time) error {
+	seconds := int64(s.bucket / time.Second)
+	cutoff := now.Add(-s.retention).Unix() / seconds * seconds
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := downsampleStatus(tx, cutoff, seconds); err != nil {
+		return fmt.Errorf("failed to downsample disk status: %w", err)
+	}
+	if err := downsampleAttributes(tx, cutoff, seconds); err != nil {
+		return fmt.Errorf("failed to downsample SMART attributes: %w", err)
+	}
+	expired := now.Add(-s.downsampledRetention).Unix()
+	for _, table := range []string{"disk_status", "smart_attribute"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE downsampled = 1 AND time < ?`, expired); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// downsampleStatus keeps the worst status of each bucket, with the check and
+// condition that caused it, and the average and maximum temperature.
+func downsampleStatus(tx *sql.Tx, cutoff, seconds int64) error {
+	rows, err := tx.Query(`SELECT time, host, client, device, disk_id, status, level, check_id, condition, temperature, temperature_max, samples
+		FROM disk_status WHERE downsampled = 0 AND time < ? ORDER BY time`, cutoff)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	type aggregate struct {
+		row              StatusPoint
+		level            int
+		temperatureSum   int64
+		temperatureCount int64
+	}
+	aggregates := make(map[statusKey]*aggregate)
+	var order []statusKey
+	for rows.Next() {
+		point, level, err := scanStatus(rows)
+		if err != nil {
+			return err
+		}
+		key := statusKey{bucket: point.Time.Unix() / seconds * seconds, diskID: point.DiskID}
+		current, ok := aggregates[key]
+		if !ok {
+			current = &aggregate{row: point, level: level}
+			current.row.Time = time.Unix(key.bucket, 0)
+			current.row.Temperature, current.row.TemperatureMax, current.row.Samples = nil, nil, 0
+			aggregates[key] = current
+			order = append(order, key)
+		}
+		if level >= current.level {
+			current.level = level
+			current.row.Status, current.row.Check, current.row.Condition = point.Status, point.Check, point.Condition
+		}
+		current.row.Samples += point.Samples
+		if point.Temperature != nil {
+			current.temperatureSum += int64(*point.Temperature)
+			current.temperatureCount++
+		}
+		if point.TemperatureMax != nil && (current.row.TemperatureMax == nil || *point.TemperatureMax > *current.row.TemperatureMax) {
+			current.row.TemperatureMax = point.TemperatureMax
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, key := range order {
+		current := aggregates[key]
+		row := current.row
+		var temperature, temperatureMax sql.NullInt64
+		if current.temperatureCount > 0 {
+			temperature = sql.NullInt64{Int64: current.temperatureSum / current.temperatureCount, Valid: true}
+		}
+		if row.TemperatureMax != nil {
+			temperatureMax = sql.NullInt64{Int64: int64(*row.TemperatureMax), Valid: true}
+		}
+		_, err := tx.Exec(`INSERT INTO disk_status VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1)`,
+			key.bucket, row.Host, row.Client, row.Device, row.DiskID, row.Status, current.level, row.Check, row.Condition, temperature, temperatureMax, row.Samples)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`DELETE FROM disk_status WHERE downsampled = 0 AND time < ?`, cutoff)
+	return err
+}
+
+// downsampleAttributes keeps the lowest normalized values and the highest raw
+// value of each bucket.
+func downsampleAttributes(tx *sql.Tx, cutoff, seconds int64) error {
+	rows, err := tx.Query(`SELECT time, disk_id, id, name, value, worst, thresh, raw, samples
+		FROM smart_attribute WHERE downsampled = 0 AND time < ? ORDER BY time`, cutoff)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	type aggregate struct {
+		diskID string
+		point  AttributePoint
+		id     int
+		name   string
+	}
+	aggregates := make(map[attributeKey]*aggregate)
+	var order []attributeKey
+	for rows.Next() {
+		var unix int64
+		var diskID, name string
+		var id int
+		var point AttributePoint
+		if err := rows.Scan(&unix, &diskID, &id, &name, &point.Value, &point.Worst, &point.Thresh, &point.Raw, &point.Samples); err != nil {
+			return err
+		}
+		key := attributeKey{bucket: unix / seconds * seconds, diskID: diskID, id: id}
+		current, ok := aggregates[key]
+		if !ok {
+			point.Time = time.Unix(key.bucket, 0)
+			aggregates[key] = &aggregate{diskID: diskID, point: point, id: id, name: name}
+			order = append(order, key)
+			continue
+		}
+		current.point.Value = min(current.point.Value, point.Value)
+		current.point.Worst = min(current.point.Worst, point.Worst)
+		current.point.Thresh = point.Thresh
+		current.point.Raw = max(current.point.Raw, point.Raw)
+		current.point.Samples += point.Samples
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, key := range order {
+		current := aggregates[key]
+		point := current.point
+		_, err := tx.Exec(`INSERT INTO smart_attribute VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 1)`,
+			key.bucket, current.diskID, current.id, current.name, point.Value, point.Worst, point.Thresh, point.Raw, point.Samples)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`DELETE FROM smart_attribute WHERE downsampled = 0 AND time < ?`, cutoff)
+	return err
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,200 @@
+package history
+
+import (
+	"gama-client/internal/diskinfo"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// t0 starts a downsampling bucket of testBucket.
+var t0 = time.Unix(1700000400, 0).UTC()
+
+const (
+	testRetention            = time.Hour
+	testBucket               = 10 * time.Minute
+	testDownsampledRetention = 24 * time.Hour
+)
+
+func openStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := Open(filepath.Join(t.TempDir(), "history.db"), testRetention, testBucket, testDownsampledRetention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// testDisk is a disk with the temperature, none when negative, and a
+// reallocated sectors attribute.
+func testDisk(device string, status diskinfo.StatusType, check, condition string, temperature int, value, worst int, raw int64) diskinfo.DiskInfo {
+	disk := diskinfo.DiskInfo{DeviceName: device, Status: status, Check: check, Condition: condition}
+	if temperature >= 0 {
+		disk.Temperature, disk.TemperatureSource = temperature, diskinfo.TemperatureSourceSMART
+	}
+	disk.Health.Attributes = []diskinfo.SMARTAttribute{
+		{ID: 5, Name: "Reallocated_Sector_Ct", Value: value, Worst: worst, Thresh: 10, Raw: diskinfo.SMARTRaw{Value: raw}},
+	}
+	return disk
+}
+
+func record(t *testing.T, store *Store, at time.Time, disks ...diskinfo.DiskInfo) {
+	t.Helper()
+	if _, err := store.Record("web1", "acme", at, disks); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// recordBucket fills the first bucket of /dev/sda, whose worst status is the
+// last Error, and the next one, and a first bucket of /dev/sdb without any
+// temperature.
+func recordBucket(t *testing.T, store *Store) {
+	t.Helper()
+	record(t, store, t0.Add(time.Minute),
+		testDisk("/dev/sda", diskinfo.StatusSafe, diskinfo.CheckOK, "All checks passed", 40, 100, 100, 0),
+		testDisk("/dev/sdb", diskinfo.StatusSafe, diskinfo.CheckOK, "All checks passed", -1, 100, 100, 0))
+	record(t, store, t0.Add(3*time.Minute),
+		testDisk("/dev/sda", diskinfo.StatusError, diskinfo.CheckSMARTFailed, "SMART status check failed", 50, 98, 98, 8),
+		testDisk("/dev/sdb", diskinfo.StatusSafe, diskinfo.CheckOK, "All checks passed", -1, 100, 100, 0))
+	record(t, store, t0.Add(5*time.Minute),
+		testDisk("/dev/sda", diskinfo.StatusWarning, diskinfo.CheckWear, "Wear at 90%", -1, 99, 97, 4))
+	record(t, store, t0.Add(7*time.Minute),
+		testDisk("/dev/sda", diskinfo.StatusError, diskinfo.CheckPendingSectors, "12 pending sectors", 45, 99, 97, 6))
+	record(t, store, t0.Add(12*time.Minute),
+		testDisk("/dev/sda", diskinfo.StatusSafe, diskinfo.CheckOK, "All checks passed", 41, 99, 97, 6))
+}
+
+func intValue(value *int) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+func TestDownsampleStatus(t *testing.T) {
+	store := openStore(t)
+	recordBucket(t, store)
+
+	// The cutoff falls in the second bucket, which is not merged yet.
+	now := t0.Add(testRetention + 15*time.Minute)
+	for i := 0; i < 2; i++ {
+		if err := store.Downsample(now); err != nil {
+			t.Fatal(err)
+		}
+		points, err := store.Status("sda", t0, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(points) != 2 {
+			t.Fatalf("run %d: got %d points, want the merged bucket and the raw row: %+v", i, len(points), points)
+		}
+		merged := points[0]
+		if !merged.Time.Equal(t0) || merged.Samples != 4 || merged.Status != "Error" ||
+			merged.Check != diskinfo.CheckPendingSectors || merged.Condition != "12 pending sectors" {
+			t.Errorf("run %d: got merged bucket %+v", i, merged)
+		}
+		if intValue(merged.Temperature) != 45 || intValue(merged.TemperatureMax) != 50 {
+			t.Errorf("run %d: got temperature %v and max %v, want 45 and 50", i, intValue(merged.Temperature), intValue(merged.TemperatureMax))
+		}
+		if raw := points[1]; !raw.Time.Equal(t0.Add(12*time.Minute)) || raw.Samples != 1 || intValue(raw.Temperature) != 41 {
+			t.Errorf("run %d: got raw row %+v", i, raw)
+		}
+	}
+
+	points, err := store.Status("sdb", t0, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 1 || points[0].Samples != 2 || points[0].Temperature != nil || points[0].TemperatureMax != nil {
+		t.Errorf("got %+v, want one bucket of 2 samples without temperature", points)
+	}
+}
+
+func TestDownsampleAttributes(t *testing.T) {
+	store := openStore(t)
+	recordBucket(t, store)
+	now := t0.Add(testRetention + 15*time.Minute)
+	if err := store.Downsample(now); err != nil {
+		t.Fatal(err)
+	}
+	series, err := store.Attributes("sda", 5, t0, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 1 || series[0].Name != "Reallocated_Sector_Ct" || len(series[0].Points) != 2 {
+		t.Fatalf("got %+v", series)
+	}
+	merged := series[0].Points[0]
+	want := AttributePoint{Time: t0, Value: 98, Worst: 97, Thresh: 10, Raw: 8, Samples: 4}
+	if merged != want {
+		t.Errorf("got %+v, want %+v", merged, want)
+	}
+	if delta := series[0].Delta; delta != (AttributeDelta{Value: 1, Raw: -2}) {
+		t.Errorf("got delta %+v", delta)
+	}
+}
+
+func TestDownsampleExpiresBuckets(t *testing.T) {
+	store := openStore(t)
+	recordBucket(t, store)
+	if err := store.Downsample(t0.Add(testRetention + 15*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A day later the first bucket expired and the second one is merged.
+	now := t0.Add(testDownsampledRetention + time.Minute)
+	if err := store.Downsample(now); err != nil {
+		t.Fatal(err)
+	}
+	points, err := store.Status("sda", t0.Add(-time.Hour), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 1 || !points[0].Time.Equal(t0.Add(testBucket)) || points[0].Samples != 1 || intValue(points[0].TemperatureMax) != 41 {
+		t.Errorf("got %+v, want the second bucket only", points)
+	}
+	series, err := store.Attributes("sda", 0, t0.Add(-time.Hour), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 1 || len(series[0].Points) != 1 || !series[0].Points[0].Time.Equal(t0.Add(testBucket)) {
+		t.Errorf("got %+v, want the second bucket only", series)
+	}
+}
+
+func TestAttributesDelta(t *testing.T) {
+	store := openStore(t)
+	recordBucket(t, store)
+	series, err := store.Attributes("sda", 0, t0, t0.Add(8*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 1 || len(series[0].Points) != 4 {
+		t.Fatalf("got %+v", series)
+	}
+	if delta := series[0].Delta; delta != (AttributeDelta{Value: -1, Raw: 6}) {
+		t.Errorf("got delta %+v, want -1 and 6", delta)
+	}
+	if series, err := store.Attributes("sda", 194, t0, t0.Add(time.Hour)); err != nil || len(series) != 0 {
+		t.Errorf("got %+v, %v for a missing attribute", series, err)
+	}
+}
+
+func TestDisksReturnsLatestRow(t *testing.T) {
+	store := openStore(t)
+	recordBucket(t, store)
+	disks, err := store.Disks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(disks) != 2 {
+		t.Fatalf("got %+v, want one row per disk", disks)
+	}
+	if disks[0].Device != "/dev/sda" || !disks[0].Time.Equal(t0.Add(12*time.Minute)) || disks[0].Status != "Safe" {
+		t.Errorf("got %+v, want the last row of /dev/sda", disks[0])
+	}
+	if disks[1].Device != "/dev/sdb" || !disks[1].Time.Equal(t0.Add(3*time.Minute)) || disks[1].Host != "web1" || disks[1].Client != "acme" {
+		t.Errorf("got %+v, want the last row of /dev/sdb", disks[1])
+	}
+}
@@ -0,0 +1,148 @@
+package hwmon
+
+import (
+	"fmt"
+	"gama-client/internal/diskinfo"
+	"github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// mismatchThreshold is the difference in °C between SMART and hwmon readings
+// above which the cross-check is logged.
+const mismatchThreshold = 5
+
+// Sensor is a drive temperature reported by the drivetemp or nvme hwmon
+// drivers.
+type Sensor struct {
+	HwmonName   string
+	Driver      string
+	DeviceName  string
+	Temperature int
+}
+
+// Reader walks /sys/class/hwmon. The root is configurable so captured sysfs
+// trees can be read.
+type Reader struct {
+	sysRoot string
+}
+
+func NewReader(sysRoot string) *Reader {
+	return &Reader{sysRoot: sysRoot}
+}
+
+var nvmeNamespace = regexp.MustCompile(`^nvme\d+n\d+$`)
+
+// Read returns the drive sensors mapped to their block devices. Sensors from
+// other drivers, or that cannot be mapped, are skipped.
+func (r *Reader) Read() ([]Sensor, error) {
+	hwmonDir := filepath.Join(r.sysRoot, "class", "hwmon")
+	entries, err := os.ReadDir(hwmonDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read hwmon devices: %w", err)
+	}
+
+	var sensors []Sensor
+	for _, entry := range entries {
+		dir := filepath.Join(hwmonDir, entry.Name())
+		driver, err := readValue(filepath.Join(dir, "name"))
+		if err != nil || (driver != "drivetemp" && driver != "nvme") {
+			continue
+		}
+		milliDegrees, err := readValue(filepath.Join(dir, "temp1_input"))
+		if err != nil {
+			logrus.Debugf("Unable to read %s temperature: %v", entry.Name(), err)
+			continue
+		}
+		value, err := strconv.Atoi(milliDegrees)
+		if err != nil {
+			continue
+		}
+		for _, device := range blockDevices(filepath.Join(dir, "device")) {
+			sensors = append(sensors, Sensor{
+				HwmonName:   entry.Name(),
+				Driver:      driver,
+				DeviceName:  "/dev/" + device,
+				Temperature: value / 1000,
+			})
+		}
+	}
+	return sensors, nil
+}
+
+// blockDevices lists the block devices behind a hwmon device: the block/
+// directory of a SCSI device for drivetemp, or the namespaces of an NVMe
+// controller.
+func blockDevices(deviceDir string) []string {
+	if entries, err := os.ReadDir(filepath.Join(deviceDir, "block")); err == nil {
+		var devices []string
+		for _, entry := range entries {
+			devices = append(devices, entry.Name())
+		}
+		return devices
+	}
+	entries, err := os.ReadDir(deviceDir)
+	if err != nil {
+		return nil
+	}
+	var devices []string
+	for _, entry := range entries {
+		if nvmeNamespace.MatchString(entry.Name()) {
+			devices = append(devices, entry.Name())
+		}
+	}
+	if len(devices) > 0 {
+		return devices
+	}
+	// Older kernels register the NVMe hwmon on the PCI device.
+	controllers, _ := os.ReadDir(filepath.Join(deviceDir, "nvme"))
+	for _, controller := range controllers {
+		namespaces, _ := os.ReadDir(filepath.Join(deviceDir, "nvme", controller.Name()))
+		for _, namespace := range namespaces {
+			if nvmeNamespace.MatchString(namespace.Name()) {
+				devices = append(devices, namespace.Name())
+			}
+		}
+	}
+	return devices
+}
+
+// ApplyToDisks fills the temperature of the disks SMART could not read, and
+// cross-checks it against the SMART value otherwise. A fallback reading above
+// 70°C raises a Warning, like the SMART classification does.
+func ApplyToDisks(disks []diskinfo.DiskInfo, sensors []Sensor, sysRoot string) {
+	for _, sensor := range sensors {
+		for i := range disks {
+			disk := &disks[i]
+			if disk.DeviceName != sensor.DeviceName && diskinfo.ParentDevice(sysRoot, disk.DeviceName) != sensor.DeviceName {
+				continue
+			}
+			if disk.TemperatureSource == "" {
+				disk.Temperature = sensor.Temperature
+				disk.TemperatureSource = diskinfo.TemperatureSourceHwmon
+				if sensor.Temperature > 70 {
+					disk.Escalate(diskinfo.StatusWarning, diskinfo.CheckTemperature, "Temperature exceeds 70°C")
+				}
+				continue
+			}
+			if diff := disk.Temperature - sensor.Temperature; diff > mismatchThreshold || diff < -mismatchThreshold {
+				logrus.Warnf("Temperature mismatch on %s: %s reports %d°C, %s reports %d°C",
+					disk.DeviceName, disk.TemperatureSource, disk.Temperature, sensor.Driver+"/"+sensor.HwmonName, sensor.Temperature)
+			}
+		}
+	}
+}
+
+func readValue(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
@@ -0,0 +1,72 @@
+package hwmon
+
+import (
+	"gama-client/internal/diskinfo"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var fixtureRoot = filepath.Join("testdata", "sys")
+
+func TestRead(t *testing.T) {
+	sensors, err := NewReader(fixtureRoot).Read()
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	// hwmon3 is a CPU sensor and hwmon4 has no temperature input.
+	want := []Sensor{
+		{HwmonName: "hwmon0", Driver: "drivetemp", DeviceName: "/dev/sda", Temperature: 72},
+		{HwmonName: "hwmon1", Driver: "nvme", DeviceName: "/dev/nvme0n1", Temperature: 41},
+		{HwmonName: "hwmon2", Driver: "nvme", DeviceName: "/dev/nvme1n1", Temperature: 38},
+	}
+	if !reflect.DeepEqual(sensors, want) {
+		t.Errorf("got %+v, want %+v", sensors, want)
+	}
+}
+
+func TestReadWithoutHwmon(t *testing.T) {
+	sensors, err := NewReader(t.TempDir()).Read()
+	if sensors != nil || err != nil {
+		t.Errorf("got %v, %v", sensors, err)
+	}
+}
+
+func TestApplyToDisks(t *testing.T) {
+	sensors, err := NewReader(fixtureRoot).Read()
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	disks := []diskinfo.DiskInfo{
+		{Status: diskinfo.StatusWarning, Check: diskinfo.CheckSMARTUnavailable, Condition: "SMART data unavailable", DeviceName: "/dev/sda"},
+		{Status: diskinfo.StatusSafe, Check: diskinfo.CheckOK, Condition: "All checks passed", DeviceName: "/dev/nvme0n1", Temperature: 40, TemperatureSource: diskinfo.TemperatureSourceSMART},
+		{Status: diskinfo.StatusSafe, Check: diskinfo.CheckOK, Condition: "All checks passed", DeviceName: "/dev/nvme1n1p1"},
+	}
+	ApplyToDisks(disks, sensors, "")
+
+	tests := []struct {
+		status      diskinfo.StatusType
+		check       string
+		temperature int
+		source      string
+	}{
+		// An equally severe finding keeps the disk's own condition.
+		{diskinfo.StatusWarning, diskinfo.CheckSMARTUnavailable, 72, diskinfo.TemperatureSourceHwmon},
+		// The SMART reading is kept and only cross-checked.
+		{diskinfo.StatusSafe, diskinfo.CheckOK, 40, diskinfo.TemperatureSourceSMART},
+		{diskinfo.StatusSafe, diskinfo.CheckOK, 38, diskinfo.TemperatureSourceHwmon},
+	}
+	for i, test := range tests {
+		disk := disks[i]
+		if disk.Status != test.status || disk.Check != test.check || disk.Temperature != test.temperature || disk.TemperatureSource != test.source {
+			t.Errorf("%s: got %s %s %d°C from %q, want %s %s %d°C from %q", disk.DeviceName, disk.Status, disk.Check, disk.Temperature, disk.TemperatureSource,
+				test.status, test.check, test.temperature, test.source)
+		}
+	}
+
+	hot := []diskinfo.DiskInfo{{Status: diskinfo.StatusSafe, Check: diskinfo.CheckOK, Condition: "All checks passed", DeviceName: "/dev/sda"}}
+	ApplyToDisks(hot, sensors, "")
+	if hot[0].Status != diskinfo.StatusWarning || hot[0].Check != diskinfo.CheckTemperature || hot[0].Condition != "Temperature exceeds 70°C" {
+		t.Errorf("got %s %s %q", hot[0].Status, hot[0].Check, hot[0].Condition)
+	}
+}
@@ -0,0 +1,268 @@
+package kmsg
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"gama-client/internal/diskinfo"
+	"github.com/shirou/gopsutil/v3/host"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultDevice = "/dev/kmsg"
+	// DefaultWindow is how long a kernel error keeps the disk in Warning.
+	DefaultWindow = 24 * time.Hour
+)
+
+// Source provides the kernel log records. Follow reports whether the reader
+// blocks waiting for new records (the live ring buffer) or ends at EOF (a
+// captured log).
+type Source interface {
+	Open() (io.ReadCloser, error)
+	Follow() bool
+}
+
+// DevKmsgSource reads the live kernel ring buffer. Every read returns a single
+// record, starting with the records already in the buffer.
+type DevKmsgSource struct {
+	Path string
+}
+
+func (s DevKmsgSource) Open() (io.ReadCloser, error) {
+	return os.Open(s.Path)
+}
+
+func (s DevKmsgSource) Follow() bool {
+	return true
+}
+
+// FileSource reads a captured /dev/kmsg or dmesg output.
+type FileSource struct {
+	Path string
+}
+
+func (s FileSource) Open() (io.ReadCloser, error) {
+	return os.Open(s.Path)
+}
+
+func (s FileSource) Follow() bool {
+	return false
+}
+
+// Event counts the storage errors of one kind logged for a device.
+type Event struct {
+	DeviceName  string
+	Kind        string
+	Count       int
+	LastMessage string
+	LastSeen    time.Time
+}
+
+type pattern struct {
+	kind   string
+	regexp *regexp.Regexp
+}
+
+// The first capture group of each pattern identifies the device: a block
+// device name, an ATA port (ataN) or an NVMe controller (nvmeN).
+var patterns = []pattern{
+	{"io_error", regexp.MustCompile(`(?:blk_update_request|I/O error|critical medium error|critical target error).*?, dev (\w+),`)},
+	{"buffer_io_error", regexp.MustCompile(`Buffer I/O error on (?:dev|device) (\w+),`)},
+	{"scsi_error", regexp.MustCompile(`sd \S+ \[(\w+)\] .*(?:FAILED Result|Sense Key : Medium Error|Unrecovered read error)`)},
+	{"ata_error", regexp.MustCompile(`^(ata\d+)(?:\.\d+)?: (?:exception Emask|failed command|status: \{ DRDY ERR \}|error: \{ UNC \})`)},
+	{"ata_reset", regexp.MustCompile(`^(ata\d+)(?:\.\d+)?: (?:hard resetting link|soft resetting link|reset failed|SATA link down|limiting SATA link speed)`)},
+	{"nvme_timeout", regexp.MustCompile(`^nvme (nvme\d+): (?:I/O \d+ (?:\(\S+\) )?QID \d+ timeout|controller is down|Abort status|Device not ready)`)},
+	{"nvme_error", regexp.MustCompile(`^(nvme\d+n\d+): I/O Cmd.*I/O Error`)},
+}
+
+var (
+	kmsgRecord  = regexp.MustCompile(`^\d+,\d+,(\d+),[^;]*;(.*)$`)
+	dmesgRecord = regexp.MustCompile(`^\[\s*[\d.]+\]\s*(.*)$`)
+	ataPortPath = regexp.MustCompile(`/(ata\d+)/`)
+)
+
+// Follower matches storage error patterns in the kernel log and counts them
+// per device.
+type Follower struct {
+	source   Source
+	sysRoot  string
+	bootTime time.Time
+
+	mu     sync.Mutex
+	events map[string]*Event
+}
+
+func NewFollower(source Source, sysRoot string) *Follower {
+	follower := &Follower{source: source, sysRoot: sysRoot, events: make(map[string]*Event)}
+	if bootTime, err := host.BootTime(); err == nil {
+		follower.bootTime = time.Unix(int64(bootTime), 0)
+	}
+	return follower
+}
+
+// Run reads the source until the context is cancelled or, for sources that do
+// not follow, until EOF.
+func (f *Follower) Run(ctx context.Context) error {
+	reader, err := f.source.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open kernel log: %w", err)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		reader.Close()
+	})
+	defer func() {
+		if stop() {
+			reader.Close()
+		}
+	}()
+
+	buffered := bufio.NewReaderSize(reader, 8192)
+	for {
+		line, err := buffered.ReadString('\n')
+		if line != "" {
+			f.processLine(strings.TrimRight(line, "\n"))
+		}
+		if err == nil {
+			continue
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		// The ring buffer overwrote records we had not read yet.
+		if errors.Is(err, syscall.EPIPE) {
+			continue
+		}
+		if errors.Is(err, io.EOF) && !f.source.Follow() {
+			return nil
+		}
+		return fmt.Errorf("failed to read kernel log: %w", err)
+	}
+}
+
+func (f *Follower) processLine(line string) {
+	// Continuation lines of /dev/kmsg records carry key=value dictionaries.
+	if line == "" || strings.HasPrefix(line, " ") {
+		return
+	}
+	seen := time.Now()
+	message := line
+	if match := kmsgRecord.FindStringSubmatch(line); match != nil {
+		message = match[2]
+		if usec, err := strconv.ParseInt(match[1], 10, 64); err == nil && !f.bootTime.IsZero() {
+			seen = f.bootTime.Add(time.Duration(usec) * time.Microsecond)
+		}
+	} else if match := dmesgRecord.FindStringSubmatch(line); match != nil {
+		message = match[1]
+	}
+
+	for _, p := range patterns {
+		match := p.regexp.FindStringSubmatch(message)
+		if match == nil {
+			continue
+		}
+		f.record(f.resolveDevice(match[1]), p.kind, message, seen)
+		return
+	}
+}
+
+func (f *Follower) record(device, kind, message string, seen time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := device + "|" + kind
+	event, ok := f.events[key]
+	if !ok {
+		event = &Event{DeviceName: device, Kind: kind}
+		f.events[key] = event
+	}
+	event.Count++
+	event.LastMessage = message
+	if seen.After(event.LastSeen) {
+		event.LastSeen = seen
+	}
+}
+
+// resolveDevice maps the name found in the message to a /dev path. ATA ports
+// are resolved through sysfs and NVMe controllers are kept as /dev/nvmeN.
+func (f *Follower) resolveDevice(name string) string {
+	if strings.HasPrefix(name, "ata") {
+		if device := f.ataPortDevice(name); device != "" {
+			return device
+		}
+	}
+	return "/dev/" + name
+}
+
+func (f *Follower) ataPortDevice(port string) string {
+	entries, err := os.ReadDir(filepath.Join(f.sysRoot, "class", "block"))
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		resolved, err := filepath.EvalSymlinks(filepath.Join(f.sysRoot, "class", "block", entry.Name()))
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(resolved, "partition")); err == nil {
+			continue
+		}
+		if match := ataPortPath.FindStringSubmatch(resolved); match != nil && match[1] == port {
+			return "/dev/" + entry.Name()
+		}
+	}
+	return ""
+}
+
+// Events returns a snapshot of the counted errors sorted by device and kind.
+func (f *Follower) Events() []Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	events := make([]Event, 0, len(f.events))
+	for _, event := range f.events {
+		events = append(events, *event)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].DeviceName != events[j].DeviceName {
+			return events[i].DeviceName < events[j].DeviceName
+		}
+		return events[i].Kind < events[j].Kind
+	})
+	return events
+}
+
+// ApplyToDisks escalates to Warning the disks with kernel errors logged within
+// the window. NVMe controller events apply to all of their namespaces.
+func ApplyToDisks(disks []diskinfo.DiskInfo, events []Event, window time.Duration) {
+	cutoff := time.Now().Add(-window)
+	for _, event := range events {
+		if event.LastSeen.Before(cutoff) {
+			continue
+		}
+		condition := fmt.Sprintf("%d kernel %s messages logged for %s", event.Count, strings.ReplaceAll(event.Kind, "_", " "), event.DeviceName)
+		for i := range disks {
+			if matchesDevice(disks[i].DeviceName, event.DeviceName) {
+				disks[i].Escalate(diskinfo.StatusWarning, diskinfo.CheckKernelErrors, condition)
+			}
+		}
+	}
+}
+
+func matchesDevice(diskName, eventDevice string) bool {
+	if diskName == eventDevice {
+		return true
+	}
+	if strings.HasPrefix(eventDevice, "/dev/nvme") && !strings.Contains(strings.TrimPrefix(eventDevice, "/dev/nvme"), "n") {
+		return strings.HasPrefix(diskName, eventDevice+"n")
+	}
+	return diskinfo.ParentDevice("", diskName) == eventDevice || diskinfo.ParentDevice("", eventDevice) == diskName
+}
@@ -0,0 +1,147 @@
+package kmsg
+
+import (
+	"context"
+	"gama-client/internal/diskinfo"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeSysfs builds a sysfs tree where sdc, and its partition sdc1, sit behind
+// ATA port ata3 and nvme0n1 behind an NVMe controller.
+func fakeSysfs(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	devices := map[string]string{
+		"sdc":     "devices/pci0000:00/0000:00:17.0/ata3/host2/target2:0:0/2:0:0:0/block/sdc",
+		"sdc1":    "devices/pci0000:00/0000:00:17.0/ata3/host2/target2:0:0/2:0:0:0/block/sdc/sdc1",
+		"nvme0n1": "devices/pci0000:00/0000:00:1d.0/0000:3d:00.0/nvme/nvme0/nvme0n1",
+	}
+	if err := os.MkdirAll(filepath.Join(root, "class", "block"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, path := range devices {
+		if err := os.MkdirAll(filepath.Join(root, path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(filepath.Join(root, path), filepath.Join(root, "class", "block", name)); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, devices["sdc1"], "partition"), []byte("1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func newTestFollower(path, sysRoot string, bootTime time.Time) *Follower {
+	return &Follower{source: FileSource{Path: path}, sysRoot: sysRoot, bootTime: bootTime, events: make(map[string]*Event)}
+}
+
+func TestFileSourceKmsg(t *testing.T) {
+	bootTime := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	follower := newTestFollower(filepath.Join("testdata", "kmsg.txt"), fakeSysfs(t), bootTime)
+	if err := follower.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	want := []struct {
+		device string
+		kind   string
+		count  int
+	}{
+		{"/dev/nvme0", "nvme_timeout", 2},
+		{"/dev/nvme0n1", "nvme_error", 1},
+		{"/dev/sdc", "ata_error", 2},
+		{"/dev/sdc", "ata_reset", 1},
+		{"/dev/sdc", "io_error", 1},
+		{"/dev/sdc", "scsi_error", 1},
+		{"/dev/sdc1", "buffer_io_error", 1},
+	}
+	events := follower.Events()
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, w := range want {
+		if events[i].DeviceName != w.device || events[i].Kind != w.kind || events[i].Count != w.count {
+			t.Errorf("event %d: got %s %s %d, want %s %s %d", i, events[i].DeviceName, events[i].Kind, events[i].Count, w.device, w.kind, w.count)
+		}
+	}
+
+	// The record timestamps are microseconds since boot.
+	if last := events[1].LastSeen; !last.Equal(bootTime.Add(6100 * time.Second)) {
+		t.Errorf("got nvme error seen at %v, want %v", last, bootTime.Add(6100*time.Second))
+	}
+	if events[2].LastMessage != "ata3.00: failed command: READ DMA EXT" {
+		t.Errorf("got last message %q", events[2].LastMessage)
+	}
+}
+
+func TestFileSourceDmesg(t *testing.T) {
+	follower := newTestFollower(filepath.Join("testdata", "dmesg.txt"), t.TempDir(), time.Time{})
+	if err := follower.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	events := follower.Events()
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2: %+v", len(events), events)
+	}
+	// Without sysfs the ATA port cannot be resolved to its disk.
+	if events[0].DeviceName != "/dev/ata1" || events[0].Kind != "ata_error" || events[0].Count != 3 {
+		t.Errorf("got %+v", events[0])
+	}
+	if events[1].DeviceName != "/dev/sdb" || events[1].Kind != "io_error" || events[1].Count != 1 {
+		t.Errorf("got %+v", events[1])
+	}
+}
+
+func TestFileSourceMissing(t *testing.T) {
+	follower := newTestFollower(filepath.Join(t.TempDir(), "kmsg"), "", time.Time{})
+	if err := follower.Run(context.Background()); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestApplyToDisks(t *testing.T) {
+	follower := newTestFollower(filepath.Join("testdata", "kmsg.txt"), fakeSysfs(t), time.Now().Add(-2*time.Hour))
+	if err := follower.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	devices := []string{"/dev/nvme0n1", "/dev/sdc", "/dev/sda"}
+	disks := make([]diskinfo.DiskInfo, len(devices))
+	for i, device := range devices {
+		disks[i] = diskinfo.DiskInfo{Status: diskinfo.StatusSafe, Check: diskinfo.CheckOK, Condition: "All checks passed", DeviceName: device}
+	}
+	ApplyToDisks(disks, follower.Events(), DefaultWindow)
+
+	tests := []struct {
+		status    diskinfo.StatusType
+		check     string
+		condition string
+	}{
+		// Controller events apply to the namespaces of the controller.
+		{diskinfo.StatusWarning, diskinfo.CheckKernelErrors, "2 kernel nvme timeout messages logged for /dev/nvme0"},
+		{diskinfo.StatusWarning, diskinfo.CheckKernelErrors, "2 kernel ata error messages logged for /dev/sdc"},
+		{diskinfo.StatusSafe, diskinfo.CheckOK, "All checks passed"},
+	}
+	for i, test := range tests {
+		disk := disks[i]
+		if disk.Status != test.status || disk.Check != test.check || disk.Condition != test.condition {
+			t.Errorf("%s: got %s %s %q, want %s %s %q", disk.DeviceName, disk.Status, disk.Check, disk.Condition, test.status, test.check, test.condition)
+		}
+	}
+}
+
+func TestApplyToDisksIgnoresOldEvents(t *testing.T) {
+	follower := newTestFollower(filepath.Join("testdata", "kmsg.txt"), fakeSysfs(t), time.Now().Add(-48*time.Hour))
+	if err := follower.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	disks := []diskinfo.DiskInfo{{Status: diskinfo.StatusSafe, Check: diskinfo.CheckOK, Condition: "All checks passed", DeviceName: "/dev/sdc"}}
+	ApplyToDisks(disks, follower.Events(), DefaultWindow)
+	if disks[0].Status != diskinfo.StatusSafe {
+		t.Errorf("got %s %q", disks[0].Status, disks[0].Condition)
+	}
+}
@@ -0,0 +1,256 @@
+package lvm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gama-client/internal/cmdrunner"
+	"gama-client/internal/diskinfo"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type LogicalVolume struct {
+	Name        string
+	VolumeGroup string
+	Attr        string
+	SegmentType string
+	// DataPercent and MetadataPercent are only reported for thin pools and
+	// snapshots, -1 otherwise.
+	DataPercent     float64
+	MetadataPercent float64
+	// SyncPercent is only reported for RAID and mirror volumes, -1 otherwise.
+	SyncPercent  float64
+	HealthStatus string
+	// Devices are the physical volumes backing the volume, resolved through
+	// its hidden sub-volumes for RAID, mirror and thin pools.
+	Devices []string
+	// Disks are the whole disks holding the devices, e.g. /dev/sda for
+	// /dev/sda1.
+	Disks []string
+	// MissingPVs counts the backing physical volumes that cannot be found.
+	MissingPVs int
+	Hidden     bool
+}
+
+func (lv LogicalVolume) FullName() string {
+	return lv.VolumeGroup + "/" + lv.Name
+}
+
+func (lv LogicalVolume) IsThinPool() bool {
+	return lv.SegmentType == "thin-pool"
+}
+
+func (lv LogicalVolume) IsRaid() bool {
+	return strings.HasPrefix(lv.SegmentType, "raid") || lv.SegmentType == "mirror"
+}
+
+// Partial reports the 'p' volume health flag of lv_attr, set when physical
+// volumes are missing.
+func (lv LogicalVolume) Partial() bool {
+	return len(lv.Attr) > 8 && lv.Attr[8] == 'p'
+}
+
+func (lv LogicalVolume) Status() (diskinfo.StatusType, string) {
+	name := lv.FullName()
+	if lv.Partial() || lv.MissingPVs > 0 || lv.HealthStatus == "partial" {
+		return diskinfo.StatusError, fmt.Sprintf("LVM volume %s is missing physical volumes", name)
+	}
+	if lv.HealthStatus == "refresh needed" {
+		return diskinfo.StatusError, fmt.Sprintf("LVM volume %s has failed devices, refresh needed", name)
+	}
+	if lv.IsThinPool() && (lv.DataPercent >= 98 || lv.MetadataPercent >= 95) {
+		return diskinfo.StatusError, fmt.Sprintf("LVM thin pool %s is full (data %.1f%%, metadata %.1f%%)", name, lv.DataPercent, lv.MetadataPercent)
+	}
+	if lv.HealthStatus == "mismatches exist" {
+		return diskinfo.StatusWarning, fmt.Sprintf("LVM volume %s has RAID mismatches", name)
+	}
+	if lv.IsRaid() && lv.SyncPercent >= 0 && lv.SyncPercent < 100 {
+		return diskinfo.StatusWarning, fmt.Sprintf("LVM volume %s is not in sync (%.1f%%)", name, lv.SyncPercent)
+	}
+	if lv.IsThinPool() && lv.DataPercent >= 90 {
+		return diskinfo.StatusWarning, fmt.Sprintf("LVM thin pool %s data usage exceeds 90%%", name)
+	}
+	if lv.IsThinPool() && lv.MetadataPercent >= 80 {
+		return diskinfo.StatusWarning, fmt.Sprintf("LVM thin pool %s metadata usage exceeds 80%%", name)
+	}
+	return diskinfo.StatusSafe, "All checks passed"
+}
+
+func (lv LogicalVolume) StatusToInt() int {
+	status, _ := lv.Status()
+	return diskinfo.DiskInfo{Status: status}.StatusToInt()
+}
+
+// Collector runs lvs through a cmdrunner.Runner so the parsing can be fed with
+// captured output.
+type Collector struct {
+	ctx     context.Context
+	runner  cmdrunner.Runner
+	sysRoot string
+}
+
+func NewCollector(ctx context.Context, runner cmdrunner.Runner) *Collector {
+	return &Collector{ctx: ctx, runner: runner, sysRoot: diskinfo.DefaultSysRoot}
+}
+
+// Collect returns no volumes when the LVM tools are not installed.
+func (c *Collector) Collect() ([]LogicalVolume, error) {
+	output, err := c.runner.Run(c.ctx, "lvs", "-a", "--reportformat", "json", "--units", "b", "--nosuffix",
+		"-o", "lv_name,vg_name,lv_attr,segtype,data_percent,metadata_percent,copy_percent,lv_health_status,devices")
+	if err != nil && len(output) == 0 {
+		if cmdrunner.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to run lvs: %w", err)
+	}
+	volumes, err := ParseReport(output)
+	if err != nil {
+		return nil, err
+	}
+	for i := range volumes {
+		for _, device := range volumes[i].Devices {
+			volumes[i].Disks = append(volumes[i].Disks, diskinfo.ParentDevice(c.sysRoot, device))
+		}
+	}
+	return volumes, nil
+}
+
+type lvsReport struct {
+	Report []struct {
+		LV []lvsRow `json:"lv"`
+	} `json:"report"`
+}
+
+type lvsRow struct {
+	LVName          string `json:"lv_name"`
+	VGName          string `json:"vg_name"`
+	LVAttr          string `json:"lv_attr"`
+	SegType         string `json:"segtype"`
+	DataPercent     string `json:"data_percent"`
+	MetadataPercent string `json:"metadata_percent"`
+	CopyPercent     string `json:"copy_percent"`
+	LVHealthStatus  string `json:"lv_health_status"`
+	Devices         string `json:"devices"`
+}
+
+var deviceReference = regexp.MustCompile(`^(.+)\(\d+\)$`)
+
+// ParseReport parses the output of `lvs -a --reportformat json` and returns
+// the visible volumes. Hidden sub-volumes are only used to resolve devices.
+func ParseReport(output []byte) ([]LogicalVolume, error) {
+	var report lvsReport
+	if err := json.Unmarshal(output, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse lvs output: %w", err)
+	}
+
+	var volumes []*LogicalVolume
+	byName := make(map[string]*LogicalVolume)
+	references := make(map[string][]string)
+	for _, section := range report.Report {
+		for _, row := range section.LV {
+			hidden := strings.HasPrefix(row.LVName, "[")
+			name := strings.Trim(row.LVName, "[]")
+			key := row.VGName + "/" + name
+			lv, ok := byName[key]
+			if !ok {
+				// lvs prints one row per segment; the first one carries the volume attributes.
+				lv = &LogicalVolume{
+					Name:            name,
+					VolumeGroup:     row.VGName,
+					Attr:            row.LVAttr,
+					SegmentType:     row.SegType,
+					DataPercent:     parsePercent(row.DataPercent),
+					MetadataPercent: parsePercent(row.MetadataPercent),
+					SyncPercent:     parsePercent(row.CopyPercent),
+					HealthStatus:    row.LVHealthStatus,
+					Hidden:          hidden,
+				}
+				byName[key] = lv
+				volumes = append(volumes, lv)
+			}
+			for _, device := range strings.Split(row.Devices, ",") {
+				match := deviceReference.FindStringSubmatch(strings.TrimSpace(device))
+				if match == nil {
+					continue
+				}
+				references[key] = append(references[key], match[1])
+			}
+		}
+	}
+
+	var visible []LogicalVolume
+	for _, lv := range volumes {
+		seen := make(map[string]bool)
+		resolveDevices(lv, lv.VolumeGroup+"/"+lv.Name, byName, references, seen)
+		if !lv.Hidden {
+			visible = append(visible, *lv)
+		}
+	}
+	return visible, nil
+}
+
+// resolveDevices follows the references of a volume until reaching physical
+// volumes. "[unknown]" is what lvs prints for a missing physical volume.
+func resolveDevices(lv *LogicalVolume, key string, byName map[string]*LogicalVolume, references map[string][]string, seen map[string]bool) {
+	if seen[key] {
+		return
+	}
+	seen[key] = true
+	for _, reference := range references[key] {
+		if reference == "[unknown]" {
+			lv.MissingPVs++
+			continue
+		}
+		subKey := lv.VolumeGroup + "/" + strings.Trim(reference, "[]")
+		if _, isVolume := byName[subKey]; isVolume {
+			resolveDevices(lv, subKey, byName, references, seen)
+			continue
+		}
+		lv.Devices = append(lv.Devices, reference)
+	}
+}
+
+// ApplyToDisks escalates the disks backing an unhealthy volume. Thin pool
+// usage is a capacity concern and does not affect the disks.
+func ApplyToDisks(disks []diskinfo.DiskInfo, volumes []LogicalVolume) {
+	for _, lv := range volumes {
+		status, condition := lv.Status()
+		if status == diskinfo.StatusSafe || (lv.IsThinPool() && lv.HealthStatus == "" && !lv.Partial()) {
+			continue
+		}
+		for i := range disks {
+			if lv.backedBy(disks[i].DeviceName) {
+				disks[i].Escalate(status, diskinfo.CheckLVM, condition)
+			}
+		}
+	}
+}
+
+// backedBy reports whether the device, or the disk holding one, backs the
+// volume.
+func (lv LogicalVolume) backedBy(name string) bool {
+	for _, device := range lv.Devices {
+		if device == name {
+			return true
+		}
+	}
+	for _, disk := range lv.Disks {
+		if disk == name {
+			return true
+		}
+	}
+	return false
+}
+
+func parsePercent(value string) float64 {
+	if value == "" {
+		return -1
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return -1
+	}
+	return parsed
+}
@@ -0,0 +1,174 @@
+package lvm
+
+import (
+	"context"
+	"errors"
+	"gama-client/internal/cmdrunner"
+	"gama-client/internal/diskinfo"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func fixtureRunner(t *testing.T) cmdrunner.Runner {
+	return cmdrunner.RunnerFunc(func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		if name != "lvs" {
+			t.Errorf("unexpected command %s", name)
+		}
+		return os.ReadFile(filepath.Join("testdata", "lvs.json"))
+	})
+}
+
+func collect(t *testing.T) map[string]LogicalVolume {
+	t.Helper()
+	volumes, err := NewCollector(context.Background(), fixtureRunner(t)).Collect()
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	byName := make(map[string]LogicalVolume, len(volumes))
+	for _, lv := range volumes {
+		byName[lv.FullName()] = lv
+	}
+	return byName
+}
+
+func TestCollectResolvesSubVolumes(t *testing.T) {
+	volumes := collect(t)
+	if len(volumes) != 5 {
+		t.Fatalf("got %d visible volumes, want 5: %v", len(volumes), volumes)
+	}
+
+	data := volumes["vg0/data"]
+	if !reflect.DeepEqual(data.Devices, []string{"/dev/sdr1"}) || data.MissingPVs != 1 || !data.Partial() {
+		t.Errorf("vg0/data: got %+v", data)
+	}
+	pool := volumes["vg0/pool"]
+	if !reflect.DeepEqual(pool.Devices, []string{"/dev/sds1", "/dev/sdq2"}) || pool.DataPercent != 93.52 || pool.MetadataPercent != 12.07 {
+		t.Errorf("vg0/pool: got %+v", pool)
+	}
+	if thin := volumes["vg0/vm-101-disk-0"]; len(thin.Devices) != 0 || thin.SyncPercent != -1 {
+		t.Errorf("vg0/vm-101-disk-0: got %+v", thin)
+	}
+	backup := volumes["vg1/backup"]
+	if !reflect.DeepEqual(backup.Devices, []string{"/dev/sdt1", "/dev/sdu1"}) || backup.SyncPercent != 42.18 {
+		t.Errorf("vg1/backup: got %+v", backup)
+	}
+}
+
+func TestLogicalVolumeStatus(t *testing.T) {
+	volumes := collect(t)
+	tests := []struct {
+		name      string
+		status    diskinfo.StatusType
+		condition string
+	}{
+		{"vg0/data", diskinfo.StatusError, "LVM volume vg0/data is missing physical volumes"},
+		{"vg0/pool", diskinfo.StatusWarning, "LVM thin pool vg0/pool data usage exceeds 90%"},
+		{"vg0/root", diskinfo.StatusSafe, "All checks passed"},
+		{"vg0/vm-101-disk-0", diskinfo.StatusSafe, "All checks passed"},
+		{"vg1/backup", diskinfo.StatusWarning, "LVM volume vg1/backup is not in sync (42.2%)"},
+	}
+	for _, test := range tests {
+		status, condition := volumes[test.name].Status()
+		if status != test.status || condition != test.condition {
+			t.Errorf("%s: got %s %q, want %s %q", test.name, status, condition, test.status, test.condition)
+		}
+	}
+
+	full := LogicalVolume{Name: "pool", VolumeGroup: "vg2", SegmentType: "thin-pool", DataPercent: 40, MetadataPercent: 96}
+	if status, condition := full.Status(); status != diskinfo.StatusError || condition != "LVM thin pool vg2/pool is full (data 40.0%, metadata 96.0%)" {
+		t.Errorf("vg2/pool: got %s %q", status, condition)
+	}
+}
+
+func TestCollectWithoutLVM(t *testing.T) {
+	runner := cmdrunner.RunnerFunc(func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		return nil, &exec.Error{Name: name, Err: exec.ErrNotFound}
+	})
+	volumes, err := NewCollector(context.Background(), runner).Collect()
+	if volumes != nil || err != nil {
+		t.Errorf("got %v, %v", volumes, err)
+	}
+
+	runner = cmdrunner.RunnerFunc(func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		return nil, errors.New("permission denied")
+	})
+	if _, err := NewCollector(context.Background(), runner).Collect(); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestApplyToDisks(t *testing.T) {
+	volumes, err := NewCollector(context.Background(), fixtureRunner(t)).Collect()
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	devices := []string{"/dev/sdq", "/dev/sdr", "/dev/sds", "/dev/sdt"}
+	disks := make([]diskinfo.DiskInfo, len(devices))
+	for i, device := range devices {
+		disks[i] = diskinfo.DiskInfo{Status: diskinfo.StatusSafe, Check: diskinfo.CheckOK, Condition: "All checks passed", DeviceName: device}
+	}
+	ApplyToDisks(disks, volumes)
+
+	tests := []struct {
+		status    diskinfo.StatusType
+		check     string
+		condition string
+	}{
+		// Thin pool usage does not affect the disks backing it.
+		{diskinfo.StatusSafe, diskinfo.CheckOK, "All checks passed"},
+		{diskinfo.StatusError, diskinfo.CheckLVM, "LVM volume vg0/data is missing physical volumes"},
+		{diskinfo.StatusSafe, diskinfo.CheckOK, "All checks passed"},
+		{diskinfo.StatusWarning, diskinfo.CheckLVM, "LVM volume vg1/backup is not in sync (42.2%)"},
+	}
+	for i, test := range tests {
+		disk := disks[i]
+		if disk.Status != test.status || disk.Check != test.check || disk.Condition != test.condition {
+			t.Errorf("%s: got %s %s %q, want %s %s %q", disk.DeviceName, disk.Status, disk.Check, disk.Condition, test.status, test.check, test.condition)
+		}
+	}
+}
+
+// partitionSysfs builds a sysfs root holding the partition of the disk.
+func partitionSysfs(t *testing.T, disk, partition string) string {
+	t.Helper()
+	root := t.TempDir()
+	dir := filepath.Join(root, "devices", "virtual", "block", disk, partition)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "partition"), []byte("1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "class", "block"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(dir, filepath.Join(root, "class", "block", partition)); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestApplyToDisksResolvesThroughSysfs(t *testing.T) {
+	runner := cmdrunner.RunnerFunc(func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		return []byte(`{"report": [{"lv": [
+			{"lv_name":"root", "vg_name":"vg0", "lv_attr":"-wi-ao--p-", "segtype":"linear", "lv_health_status":"partial", "devices":"/dev/dasda1(0)"}
+		]}]}`), nil
+	})
+	collector := NewCollector(context.Background(), runner)
+	collector.sysRoot = partitionSysfs(t, "dasda", "dasda1")
+	volumes, err := collector.Collect()
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	if len(volumes) != 1 || !reflect.DeepEqual(volumes[0].Disks, []string{"/dev/dasda"}) {
+		t.Fatalf("got %+v, want /dev/dasda1 on /dev/dasda", volumes)
+	}
+	disks := []diskinfo.DiskInfo{{Status: diskinfo.StatusSafe, Check: diskinfo.CheckOK, Condition: "All checks passed", DeviceName: "/dev/dasda"}}
+	ApplyToDisks(disks, volumes)
+	if disks[0].Status != diskinfo.StatusError || disks[0].Check != diskinfo.CheckLVM {
+		t.Errorf("got %s %s %q, want an LVM error", disks[0].Status, disks[0].Check, disks[0].Condition)
+	}
+}
@@ -0,0 +1,241 @@
+package mdraid
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"gama-client/internal/diskinfo"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultProcRoot = "/proc"
+	DefaultSysRoot  = diskinfo.DefaultSysRoot
+)
+
+type Member struct {
+	Name       string
+	DeviceName string
+	// DiskName is the whole disk holding the member, e.g. /dev/sda for /dev/sda1.
+	DiskName string
+	Role     int
+	Faulty   bool
+	Spare    bool
+}
+
+type Array struct {
+	Name          string
+	State         string
+	Level         string
+	RaidDisks     int
+	ActiveDisks   int
+	DegradedDisks int
+	SyncAction    string
+	// SyncProgress is the percentage of the running resync/recovery, -1 when idle.
+	SyncProgress float64
+	Members      []Member
+}
+
+func (a Array) FailedMembers() []Member {
+	var failed []Member
+	for _, member := range a.Members {
+		if member.Faulty {
+			failed = append(failed, member)
+		}
+	}
+	return failed
+}
+
+func (a Array) Status() (diskinfo.StatusType, string) {
+	if a.State == "inactive" {
+		return diskinfo.StatusError, fmt.Sprintf("RAID array %s is inactive", a.Name)
+	}
+	if a.DegradedDisks > 0 {
+		return diskinfo.StatusError, fmt.Sprintf("RAID array %s is degraded (%d of %d members missing)", a.Name, a.DegradedDisks, a.RaidDisks)
+	}
+	if failed := a.FailedMembers(); len(failed) > 0 {
+		return diskinfo.StatusError, fmt.Sprintf("RAID array %s has %d failed members", a.Name, len(failed))
+	}
+	return diskinfo.StatusSafe, "All checks passed"
+}
+
+func (a Array) StatusToInt() int {
+	status, _ := a.Status()
+	return diskinfo.DiskInfo{Status: status}.StatusToInt()
+}
+
+// Collector reads the md arrays from /proc/mdstat and sysfs. Both roots are
+// configurable so captured fixtures can be parsed.
+type Collector struct {
+	procRoot string
+	sysRoot  string
+}
+
+func NewCollector(procRoot, sysRoot string) *Collector {
+	return &Collector{procRoot: procRoot, sysRoot: sysRoot}
+}
+
+// Collect returns no arrays when the md driver is not loaded.
+func (c *Collector) Collect() ([]Array, error) {
+	file, err := os.Open(filepath.Join(c.procRoot, "mdstat"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open mdstat: %w", err)
+	}
+	defer file.Close()
+
+	arrays, err := ParseMDStat(file)
+	if err != nil {
+		return nil, err
+	}
+	for i := range arrays {
+		c.readSysfs(&arrays[i])
+	}
+	return arrays, nil
+}
+
+// readSysfs refines the mdstat view with the per-array md attributes, which
+// are more precise than the progress bar and flags printed in mdstat.
+func (c *Collector) readSysfs(array *Array) {
+	mdDir := filepath.Join(c.sysRoot, "block", array.Name, "md")
+	if value, err := readSysfsValue(filepath.Join(mdDir, "degraded")); err == nil {
+		if degraded, err := strconv.Atoi(value); err == nil {
+			array.DegradedDisks = degraded
+		}
+	}
+	if value, err := readSysfsValue(filepath.Join(mdDir, "sync_action")); err == nil {
+		array.SyncAction = value
+		if value == "idle" {
+			array.SyncProgress = -1
+		}
+	}
+	if value, err := readSysfsValue(filepath.Join(mdDir, "sync_completed")); err == nil {
+		var done, total float64
+		if _, err := fmt.Sscanf(value, "%g / %g", &done, &total); err == nil && total > 0 {
+			array.SyncProgress = done / total * 100
+		}
+	}
+	for i := range array.Members {
+		member := &array.Members[i]
+		member.DiskName = diskinfo.ParentDevice(c.sysRoot, member.DeviceName)
+		state, err := readSysfsValue(filepath.Join(mdDir, "dev-"+member.Name, "state"))
+		if err != nil {
+			continue
+		}
+		for _, flag := range strings.Split(state, ",") {
+			switch flag {
+			case "faulty":
+				member.Faulty = true
+			case "spare":
+				member.Spare = true
+			}
+		}
+	}
+}
+
+var (
+	arrayHeader  = regexp.MustCompile(`^(md\S+)\s*:\s*(\S+)(?:\s+\(([^)]+)\))?\s*(.*)$`)
+	memberToken  = regexp.MustCompile(`^(\S+)\[(\d+)\]((?:\([A-Z]\))*)$`)
+	diskCounts   = regexp.MustCompile(`\[(\d+)/(\d+)\]\s+\[([U_]+)\]`)
+	syncProgress = regexp.MustCompile(`(resync|recovery|reshape|check|repair)\s*=\s*([\d.]+)%`)
+	syncPending  = regexp.MustCompile(`(resync|recovery|reshape|check|repair)\s*=\s*(DELAYED|PENDING)`)
+)
+
+// ParseMDStat parses the content of /proc/mdstat.
+func ParseMDStat(reader io.Reader) ([]Array, error) {
+	var arrays []Array
+	var current *Array
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			current = nil
+			continue
+		}
+		if match := arrayHeader.FindStringSubmatch(line); match != nil {
+			arrays = append(arrays, parseArrayHeader(match))
+			current = &arrays[len(arrays)-1]
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		if match := diskCounts.FindStringSubmatch(trimmed); match != nil {
+			current.RaidDisks, _ = strconv.Atoi(match[1])
+			current.ActiveDisks, _ = strconv.Atoi(match[2])
+			current.DegradedDisks = strings.Count(match[3], "_")
+		}
+		if match := syncProgress.FindStringSubmatch(trimmed); match != nil {
+			current.SyncAction = match[1]
+			current.SyncProgress, _ = strconv.ParseFloat(match[2], 64)
+		} else if match := syncPending.FindStringSubmatch(trimmed); match != nil {
+			current.SyncAction = match[1]
+			current.SyncProgress = 0
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read mdstat: %w", err)
+	}
+	return arrays, nil
+}
+
+func parseArrayHeader(match []string) Array {
+	array := Array{Name: match[1], State: match[2], SyncAction: "idle", SyncProgress: -1}
+	fields := strings.Fields(match[4])
+	if len(fields) > 0 && !memberToken.MatchString(fields[0]) {
+		array.Level = fields[0]
+		fields = fields[1:]
+	}
+	for _, field := range fields {
+		token := memberToken.FindStringSubmatch(field)
+		if token == nil {
+			continue
+		}
+		role, _ := strconv.Atoi(token[2])
+		array.Members = append(array.Members, Member{
+			Name:       token[1],
+			DeviceName: "/dev/" + token[1],
+			DiskName:   diskinfo.ParentDevice("", "/dev/"+token[1]),
+			Role:       role,
+			Faulty:     strings.Contains(token[3], "(F)"),
+			Spare:      strings.Contains(token[3], "(S)"),
+		})
+	}
+	return array
+}
+
+// ApplyToDisks escalates the disks backing a faulty or degraded array. Disks
+// are matched either by partition or by whole-disk device name.
+func ApplyToDisks(disks []diskinfo.DiskInfo, arrays []Array) {
+	for _, array := range arrays {
+		status, condition := array.Status()
+		for _, member := range array.Members {
+			memberStatus, memberCondition := status, condition
+			if member.Faulty {
+				memberStatus = diskinfo.StatusError
+				memberCondition = fmt.Sprintf("Member %s marked as failed in RAID array %s", member.Name, array.Name)
+			}
+			for i := range disks {
+				if disks[i].DeviceName == member.DeviceName || disks[i].DeviceName == member.DiskName {
+					disks[i].Escalate(memberStatus, diskinfo.CheckMDRaid, memberCondition)
+				}
+			}
+		}
+	}
+}
+
+func readSysfsValue(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
@@ -0,0 +1,174 @@
+package mdraid
+
+import (
+	"gama-client/internal/diskinfo"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readFixture(t *testing.T) []Array {
+	t.Helper()
+	file, err := os.Open(filepath.Join("testdata", "proc", "mdstat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	arrays, err := ParseMDStat(file)
+	if err != nil {
+		t.Fatalf("ParseMDStat: %v", err)
+	}
+	return arrays
+}
+
+func arrayByName(t *testing.T, arrays []Array, name string) Array {
+	t.Helper()
+	for _, array := range arrays {
+		if array.Name == name {
+			return array
+		}
+	}
+	t.Fatalf("array %s not found in %+v", name, arrays)
+	return Array{}
+}
+
+func memberByName(t *testing.T, array Array, name string) Member {
+	t.Helper()
+	for _, member := range array.Members {
+		if member.Name == name {
+			return member
+		}
+	}
+	t.Fatalf("member %s not found in %s", name, array.Name)
+	return Member{}
+}
+
+func TestParseMDStat(t *testing.T) {
+	arrays := readFixture(t)
+	if len(arrays) != 4 {
+		t.Fatalf("got %d arrays, want 4", len(arrays))
+	}
+
+	recovering := arrayByName(t, arrays, "md1")
+	if recovering.Level != "raid5" || recovering.RaidDisks != 3 || recovering.ActiveDisks != 2 || recovering.DegradedDisks != 1 {
+		t.Errorf("md1: got %+v", recovering)
+	}
+	if recovering.SyncAction != "recovery" || recovering.SyncProgress != 12.6 {
+		t.Errorf("md1: got sync %s %g%%", recovering.SyncAction, recovering.SyncProgress)
+	}
+
+	degraded := arrayByName(t, arrays, "md0")
+	failed := memberByName(t, degraded, "sdf1")
+	if !failed.Faulty || failed.DeviceName != "/dev/sdf1" || failed.DiskName != "/dev/sdf" || failed.Role != 2 {
+		t.Errorf("md0 sdf1: got %+v", failed)
+	}
+	if degraded.SyncAction != "idle" || degraded.SyncProgress != -1 {
+		t.Errorf("md0: got sync %s %g", degraded.SyncAction, degraded.SyncProgress)
+	}
+
+	healthy := arrayByName(t, arrays, "md2")
+	if spare := memberByName(t, healthy, "sdg1"); !spare.Spare || spare.Faulty {
+		t.Errorf("md2 sdg1: got %+v", spare)
+	}
+	if nvme := memberByName(t, healthy, "nvme0n1p2"); nvme.DiskName != "/dev/nvme0n1" {
+		t.Errorf("md2 nvme0n1p2: got disk %s", nvme.DiskName)
+	}
+
+	inactive := arrayByName(t, arrays, "md127")
+	if inactive.State != "inactive" || inactive.Level != "" || len(inactive.Members) != 1 {
+		t.Errorf("md127: got %+v", inactive)
+	}
+}
+
+func TestArrayStatus(t *testing.T) {
+	arrays := readFixture(t)
+	tests := []struct {
+		name      string
+		status    diskinfo.StatusType
+		condition string
+	}{
+		{"md1", diskinfo.StatusError, "RAID array md1 is degraded (1 of 3 members missing)"},
+		{"md0", diskinfo.StatusError, "RAID array md0 is degraded (1 of 2 members missing)"},
+		{"md2", diskinfo.StatusSafe, "All checks passed"},
+		{"md127", diskinfo.StatusError, "RAID array md127 is inactive"},
+	}
+	for _, test := range tests {
+		status, condition := arrayByName(t, arrays, test.name).Status()
+		if status != test.status || condition != test.condition {
+			t.Errorf("%s: got %s %q, want %s %q", test.name, status, condition, test.status, test.condition)
+		}
+	}
+
+	failedOnly := Array{Name: "md3", State: "active", Members: []Member{{Name: "sda1", Faulty: true}}}
+	if status, condition := failedOnly.Status(); status != diskinfo.StatusError || condition != "RAID array md3 has 1 failed members" {
+		t.Errorf("md3: got %s %q", status, condition)
+	}
+}
+
+func TestCollectorReadsSysfs(t *testing.T) {
+	arrays, err := NewCollector(filepath.Join("testdata", "proc"), filepath.Join("testdata", "sys")).Collect()
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+
+	recovering := arrayByName(t, arrays, "md1")
+	if recovering.SyncAction != "recover" || math.Abs(recovering.SyncProgress-12.62) > 0.01 {
+		t.Errorf("md1: got sync %s %g%%", recovering.SyncAction, recovering.SyncProgress)
+	}
+	if rebuilding := memberByName(t, recovering, "sdd1"); !rebuilding.Spare {
+		t.Errorf("md1 sdd1: got %+v", rebuilding)
+	}
+
+	degraded := arrayByName(t, arrays, "md0")
+	if degraded.DegradedDisks != 1 || len(degraded.FailedMembers()) != 1 {
+		t.Errorf("md0: got %+v", degraded)
+	}
+	if member := memberByName(t, degraded, "sde1"); member.Faulty || member.DiskName != "/dev/sde" {
+		t.Errorf("md0 sde1: got %+v", member)
+	}
+
+	// Arrays without sysfs attributes keep the mdstat view.
+	if inactive := arrayByName(t, arrays, "md127"); inactive.SyncProgress != -1 {
+		t.Errorf("md127: got progress %g", inactive.SyncProgress)
+	}
+}
+
+func TestCollectorWithoutMDDriver(t *testing.T) {
+	arrays, err := NewCollector(t.TempDir(), t.TempDir()).Collect()
+	if arrays != nil || err != nil {
+		t.Errorf("got %v, %v", arrays, err)
+	}
+}
+
+func TestApplyToDisks(t *testing.T) {
+	arrays, err := NewCollector(filepath.Join("testdata", "proc"), filepath.Join("testdata", "sys")).Collect()
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	disks := []diskinfo.DiskInfo{
+		{Status: diskinfo.StatusSafe, Check: diskinfo.CheckOK, Condition: "All checks passed", DeviceName: "/dev/sdb"},
+		{Status: diskinfo.StatusSafe, Check: diskinfo.CheckOK, Condition: "All checks passed", DeviceName: "/dev/sdf"},
+		{Status: diskinfo.StatusSafe, Check: diskinfo.CheckOK, Condition: "All checks passed", DeviceName: "/dev/nvme0n1"},
+		{Status: diskinfo.StatusError, Check: diskinfo.CheckSMARTFailed, Condition: "SMART status check failed", DeviceName: "/dev/sde"},
+	}
+	ApplyToDisks(disks, arrays)
+
+	tests := []struct {
+		status    diskinfo.StatusType
+		check     string
+		condition string
+	}{
+		{diskinfo.StatusError, diskinfo.CheckMDRaid, "RAID array md1 is degraded (1 of 3 members missing)"},
+		{diskinfo.StatusError, diskinfo.CheckMDRaid, "Member sdf1 marked as failed in RAID array md0"},
+		{diskinfo.StatusSafe, diskinfo.CheckOK, "All checks passed"},
+		// An equally severe finding does not replace the disk's own.
+		{diskinfo.StatusError, diskinfo.CheckSMARTFailed, "SMART status check failed"},
+	}
+	for i, test := range tests {
+		disk := disks[i]
+		if disk.Status != test.status || disk.Check != test.check || disk.Condition != test.condition {
+			t.Errorf("%s: got %s %s %q, want %s %s %q", disk.DeviceName, disk.Status, disk.Check, disk.Condition, test.status, test.check, test.condition)
+		}
+	}
+}
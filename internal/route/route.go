@@ -0,0 +1,156 @@
+package route
+
+import (
+	"gama-client/internal/appconfig"
+	"gama-client/internal/diskinfo"
+	"gama-client/internal/sink"
+	"path"
+)
+
+// Result is what the routes match: the finding on a disk, or the host itself
+// for the points of no disk, which have no device, status or check.
+type Result struct {
+	Host   string
+	Client string
+	Device string
+	DiskID string
+	Status diskinfo.StatusType
+	Check  string
+}
+
+// DiskResult is the result of a classified disk.
+func DiskResult(host, client string, disk diskinfo.DiskInfo) Result {
+	return Result{
+		Host:   host,
+		Client: client,
+		Device: disk.DeviceName,
+		DiskID: diskinfo.DiskID(disk.DeviceName),
+		Status: disk.Status,
+		Check:  disk.Check,
+	}
+}
+
+// Router applies the routes. The sinks and notifiers named by no route are
+// not routed and receive every result.
+type Router struct {
+	routes    []appconfig.RouteConfig
+	sinks     map[string]bool
+	notifiers map[string]bool
+}
+
+func NewRouter(routes []appconfig.RouteConfig) *Router {
+	router := &Router{routes: routes, sinks: make(map[string]bool), notifiers: make(map[string]bool)}
+	for _, route := range routes {
+		for _, name := range route.Sinks {
+			router.sinks[name] = true
+		}
+		for _, name := range route.Notifiers {
+			router.notifiers[name] = true
+		}
+	}
+	return router
+}
+
+// Sink reports whether the sink receives the result.
+func (r *Router) Sink(name string, result Result) bool {
+	if !r.sinks[name] {
+		return true
+	}
+	return r.receives(name, result, func(route appconfig.RouteConfig) []string { return route.Sinks })
+}
+
+// Notifier reports whether the notifier receives the result.
+func (r *Router) Notifier(name string, result Result) bool {
+	if !r.notifiers[name] {
+		return true
+	}
+	return r.receives(name, result, func(route appconfig.RouteConfig) []string { return route.Notifiers })
+}
+
+func (r *Router) receives(name string, result Result, outputs func(route appconfig.RouteConfig) []string) bool {
+	for _, route := range r.routes {
+		if !matches(route.Match, result) {
+			continue
+		}
+		for _, output := range outputs(route) {
+			if output == name {
+				return true
+			}
+		}
+		if !route.Continue {
+			return false
+		}
+	}
+	return false
+}
+
+// Batch returns the part of the batch routed to the sink: the disks and
+// points it receives, and every collector status.
+func (r *Router) Batch(name string, batch sink.Batch) sink.Batch {
+	if !r.sinks[name] {
+		return batch
+	}
+	disks := make(map[string]Result, len(batch.Disks))
+	routed := batch
+	routed.Disks = nil
+	for _, disk := range batch.Disks {
+		result := DiskResult(batch.Host, batch.Client, disk)
+		disks[disk.DeviceName] = result
+		if r.Sink(name, result) {
+			routed.Disks = append(routed.Disks, disk)
+		}
+	}
+	routed.Points = nil
+	for _, point := range batch.Points {
+		device := point.Tags["device"]
+		result, ok := disks[device]
+		if !ok {
+			result = Result{Host: batch.Host, Client: batch.Client}
+			if device != "" {
+				result.Device, result.DiskID = device, diskinfo.DiskID(device)
+			}
+		}
+		if r.Sink(name, result) {
+			routed.Points = append(routed.Points, point)
+		}
+	}
+	return routed
+}
+
+func matches(match appconfig.RouteMatch, result Result) bool {
+	if !accepts(match.Statuses, string(result.Status)) || !accepts(match.Checks, result.Check) {
+		return false
+	}
+	if !accepts(match.Hosts, result.Host) || !accepts(match.Clients, result.Client) {
+		return false
+	}
+	if len(match.Devices) == 0 {
+		return true
+	}
+	if result.Device == "" {
+		return false
+	}
+	for _, pattern := range match.Devices {
+		if ok, _ := path.Match(pattern, result.Device); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, result.DiskID); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// accepts reports whether value is in values, any value being accepted when
+// values is empty.
+func accepts(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, accepted := range values {
+		if accepted == value {
+			return true
+		}
+	}
+	return false
+}
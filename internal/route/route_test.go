@@ -0,0 +1,142 @@
+package route
+
+import (
+	"errors"
+	"gama-client/internal/appconfig"
+	"gama-client/internal/diskinfo"
+	"gama-client/internal/sink"
+	"strings"
+	"testing"
+)
+
+func disk(device string, status diskinfo.StatusType, check string) Result {
+	return Result{Host: "web1", Client: "acme", Device: device, DiskID: diskinfo.DiskID(device), Status: status, Check: check}
+}
+
+func TestRouterNotifier(t *testing.T) {
+	router := NewRouter([]appconfig.RouteConfig{
+		{Match: appconfig.RouteMatch{Clients: []string{"globex"}}, Notifiers: []string{"globex-slack"}},
+		{Match: appconfig.RouteMatch{Hosts: []string{"db1"}}, Notifiers: []string{"dba-email"}, Continue: true},
+		{Match: appconfig.RouteMatch{Devices: []string{"/dev/nvme*"}}, Notifiers: []string{"nvme-webhook"}, Continue: true},
+		{Match: appconfig.RouteMatch{Devices: []string{"PHYSICALDRIVE*"}}, Notifiers: []string{"windows-webhook"}},
+		{Match: appconfig.RouteMatch{Statuses: []string{"Error"}, Checks: []string{diskinfo.CheckSMARTFailed}}, Notifiers: []string{"pagerduty"}},
+		{Match: appconfig.RouteMatch{Statuses: []string{"Error", "Warning"}}, Notifiers: []string{"slack"}},
+	})
+	failed := disk("/dev/sda", diskinfo.StatusError, diskinfo.CheckSMARTFailed)
+	worn := disk("/dev/sda", diskinfo.StatusWarning, diskinfo.CheckWear)
+	nvme := disk("/dev/nvme0n1", diskinfo.StatusError, diskinfo.CheckSMARTFailed)
+	windows := disk(`\\.\PHYSICALDRIVE1`, diskinfo.StatusError, diskinfo.CheckSMARTFailed)
+	db := failed
+	db.Host = "db1"
+	globex := failed
+	globex.Client = "globex"
+
+	tests := []struct {
+		name   string
+		result Result
+		want   []string
+	}{
+		{name: "first match wins", result: failed, want: []string{"pagerduty", "email-0"}},
+		{name: "later route", result: worn, want: []string{"slack", "email-0"}},
+		{name: "client", result: globex, want: []string{"globex-slack", "email-0"}},
+		{name: "host continues", result: db, want: []string{"dba-email", "pagerduty", "email-0"}},
+		{name: "device glob continues", result: nvme, want: []string{"nvme-webhook", "pagerduty", "email-0"}},
+		{name: "disk id glob", result: windows, want: []string{"windows-webhook", "email-0"}},
+		{name: "safe", result: disk("/dev/sda", diskinfo.StatusSafe, diskinfo.CheckOK), want: []string{"email-0"}},
+		{name: "no disk", result: Result{Host: "web1", Client: "acme"}, want: []string{"email-0"}},
+	}
+	// email-0 is named by no route and receives everything.
+	notifiers := []string{"globex-slack", "dba-email", "nvme-webhook", "windows-webhook", "pagerduty", "slack", "email-0"}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, name := range notifiers {
+				if router.Notifier(name, test.result) {
+					got = append(got, name)
+				}
+			}
+			if !sameNames(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRouterSink(t *testing.T) {
+	router := NewRouter([]appconfig.RouteConfig{
+		{Match: appconfig.RouteMatch{Clients: []string{"acme"}}, Sinks: []string{"acme-influx"}, Continue: true},
+		{Match: appconfig.RouteMatch{Statuses: []string{"Error"}}, Sinks: []string{"errors"}},
+	})
+	tests := []struct {
+		name   string
+		result Result
+		want   []string
+	}{
+		{name: "continue", result: disk("/dev/sda", diskinfo.StatusError, diskinfo.CheckSMARTFailed), want: []string{"acme-influx", "errors", "influxdb"}},
+		{name: "first route only", result: disk("/dev/sda", diskinfo.StatusSafe, diskinfo.CheckOK), want: []string{"acme-influx", "influxdb"}},
+		{name: "no route", result: Result{Host: "web1", Client: "globex", Device: "/dev/sda", Status: diskinfo.StatusSafe}, want: []string{"influxdb"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, name := range []string{"acme-influx", "errors", "influxdb"} {
+				if router.Sink(name, test.result) {
+					got = append(got, name)
+				}
+			}
+			if !sameNames(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRouterBatch(t *testing.T) {
+	router := NewRouter([]appconfig.RouteConfig{
+		{Match: appconfig.RouteMatch{Statuses: []string{"Error"}}, Sinks: []string{"errors"}},
+		{Match: appconfig.RouteMatch{}, Sinks: []string{"influxdb"}},
+	})
+	collectorErr := errors.New("zpool not found")
+	batch := sink.Batch{
+		Host:   "web1",
+		Client: "acme",
+		Disks: []diskinfo.DiskInfo{
+			{DeviceName: "/dev/sda", Status: diskinfo.StatusSafe, Check: diskinfo.CheckOK},
+			{DeviceName: "/dev/sdb", Status: diskinfo.StatusError, Check: diskinfo.CheckSMARTFailed},
+		},
+		Points: []sink.Point{
+			{Measurement: "disk_status", Tags: map[string]string{"device": "/dev/sda"}},
+			{Measurement: "disk_status", Tags: map[string]string{"device": "/dev/sdb"}},
+			{Measurement: "disk_io", Tags: map[string]string{"device": "/dev/sdc"}},
+			{Measurement: "sink_write", Tags: map[string]string{"sink": "influxdb"}},
+		},
+		Collectors: []sink.CollectorStatus{{Name: "zfs", Error: collectorErr}, {Name: "mdraid"}},
+	}
+
+	routed := router.Batch("errors", batch)
+	if len(routed.Disks) != 1 || routed.Disks[0].DeviceName != "/dev/sdb" {
+		t.Errorf("got disks %+v, want /dev/sdb only", routed.Disks)
+	}
+	if len(routed.Points) != 1 || routed.Points[0].Tags["device"] != "/dev/sdb" {
+		t.Errorf("got points %+v, want the /dev/sdb one only", routed.Points)
+	}
+	if len(routed.Collectors) != 2 || routed.Collectors[0].Error != collectorErr {
+		t.Errorf("got collectors %+v, want both", routed.Collectors)
+	}
+	if routed.Host != "web1" || routed.Client != "acme" {
+		t.Errorf("got host %q and client %q", routed.Host, routed.Client)
+	}
+
+	// The catch-all route receives the points of no disk, and those of a
+	// device that was not classified.
+	if routed := router.Batch("influxdb", batch); len(routed.Disks) != 1 || len(routed.Points) != 3 {
+		t.Errorf("got %d disks and %d points, want 1 and 3", len(routed.Disks), len(routed.Points))
+	}
+	if routed := router.Batch("history", batch); len(routed.Disks) != 2 || len(routed.Points) != 4 {
+		t.Errorf("unrouted sink got %d disks and %d points, want everything", len(routed.Disks), len(routed.Points))
+	}
+}
+
+func sameNames(got, want []string) bool {
+	return strings.Join(got, ",") == strings.Join(want, ",")
+}
@@ -2,46 +2,448 @@ package internal
 
 import (
 	"context"
+	"errors"
+	"gama-client/internal/alert"
 	"gama-client/internal/appconfig"
+	"gama-client/internal/btrfs"
+	"gama-client/internal/cmdrunner"
 	"gama-client/internal/diskinfo"
-	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
-	"github.com/influxdata/influxdb-client-go/v2/api"
-	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"gama-client/internal/diskio"
+	"gama-client/internal/hwmon"
+	"gama-client/internal/kmsg"
+	"gama-client/internal/lvm"
+	"gama-client/internal/mdraid"
+	"gama-client/internal/route"
+	"gama-client/internal/sink"
+	"gama-client/internal/zfs"
 	"github.com/sirupsen/logrus"
+	"os"
+	"strconv"
 	"time"
 )
 
-func sendDiskInfo(ctx context.Context, cancelFunc context.CancelFunc, writeAPI api.WriteAPIBlocking, diskInfoProvider diskinfo.DiskInfoProvider, config *appconfig.AppConfig) {
+// diskEnricher adjusts the classification of the collected disks with the
+// findings of another collector.
+type diskEnricher func(disks []diskinfo.DiskInfo)
+
+// collection accumulates the points of one cycle, tagged with the host and
+// client of the agent, and the outcome of each collector.
+type collection struct {
+	config     *appconfig.AppConfig
+	time       time.Time
+	points     []sink.Point
+	collectors []sink.CollectorStatus
+}
+
+func newCollection(config *appconfig.AppConfig) *collection {
+	return &collection{config: config, time: time.Now()}
+}
+
+func (c *collection) add(measurement string, tags map[string]string, fields map[string]interface{}) {
+	tags["host"] = c.config.InfluxTags.Host
+	tags["client"] = c.config.InfluxTags.Client
+	c.points = append(c.points, sink.Point{Measurement: measurement, Tags: tags, Fields: fields, Time: c.time})
+}
+
+func (c *collection) report(collector string, err error) {
+	c.collectors = append(c.collectors, sink.CollectorStatus{Name: collector, Error: err})
+}
+
+func (c *collection) batch(disks []diskinfo.DiskInfo) sink.Batch {
+	return sink.Batch{
+		Time:       c.time,
+		Host:       c.config.InfluxTags.Host,
+		Client:     c.config.InfluxTags.Client,
+		Disks:      disks,
+		Points:     c.points,
+		Collectors: c.collectors,
+	}
+}
+
+func collectDiskInfo(c *collection, cancelFunc context.CancelFunc, diskInfoProvider diskinfo.DiskInfoProvider, enrichers ...diskEnricher) []diskinfo.DiskInfo {
 	disks, err := diskInfoProvider.GetDisksInfo()
+	c.report("smart", err)
 	if err != nil {
 		logrus.Errorf("Failed to retrieve disk info: %v", err)
 		time.Sleep(30 * time.Second)
 		cancelFunc()
 	}
+	for _, enrich := range enrichers {
+		if enrich != nil {
+			enrich(disks)
+		}
+	}
 	for _, diskInfo := range disks {
 		tags := map[string]string{
-			"host":   config.InfluxTags.Host,
-			"client": config.InfluxTags.Client,
 			"device": diskInfo.DeviceName,
 		}
 		fields := map[string]interface{}{
-			"status":      diskInfo.StatusToInt(),
-			"temperature": diskInfo.Temperature,
+			"status":             diskInfo.StatusToInt(),
+			"temperature":        diskInfo.Temperature,
+			"temperature_source": diskInfo.TemperatureSource,
+		}
+		c.add("disk", tags, fields)
+		collectSmartAttributes(c, diskInfo)
+		collectReliability(c, diskInfo)
+	}
+	return disks
+}
+
+func collectSmartAttributes(c *collection, diskInfo diskinfo.DiskInfo) {
+	for _, attribute := range diskInfo.Health.Attributes {
+		tags := map[string]string{
+			"device": diskInfo.DeviceName,
+			"id":     strconv.Itoa(attribute.ID),
+			"name":   attribute.Name,
+		}
+		fields := map[string]interface{}{
+			"value":       attribute.Value,
+			"worst":       attribute.Worst,
+			"thresh":      attribute.Thresh,
+			"raw":         attribute.Raw.Value,
+			"when_failed": attribute.WhenFailed,
+		}
+		c.add("disk_smart_attribute", tags, fields)
+	}
+}
+
+// collectReliability adds the storage reliability counters reported for the
+// disk, if any.
+func collectReliability(c *collection, diskInfo diskinfo.DiskInfo) {
+	health := diskInfo.Health
+	fields := map[string]interface{}{}
+	for name, value := range map[string]*int{
+		"wear":            health.Wear,
+		"temperature_max": health.TemperatureMax,
+		"power_on_hours":  health.PowerOnHours,
+	} {
+		if value != nil {
+			fields[name] = *value
+		}
+	}
+	for name, value := range map[string]*int64{
+		"read_errors_total":        health.ReadErrorsTotal,
+		"read_errors_uncorrected":  health.ReadErrorsUncorrected,
+		"write_errors_total":       health.WriteErrorsTotal,
+		"write_errors_uncorrected": health.WriteErrorsUncorrected,
+	} {
+		if value != nil {
+			fields[name] = *value
+		}
+	}
+	if len(fields) == 0 {
+		return
+	}
+	c.add("disk_reliability", map[string]string{"device": diskInfo.DeviceName}, fields)
+}
+
+func collectDiskIO(c *collection, ioCollector *diskio.Collector) {
+	stats, err := ioCollector.Collect()
+	c.report("disk_io", err)
+	if err != nil {
+		logrus.Errorf("Failed to retrieve disk io stats: %v", err)
+		return
+	}
+	for _, ioStats := range stats {
+		tags := map[string]string{
+			"device": ioStats.DeviceName,
+		}
+		fields := map[string]interface{}{
+			"read_bytes_per_sec":  ioStats.ReadBytesPerSec,
+			"write_bytes_per_sec": ioStats.WriteBytesPerSec,
+			"read_iops":           ioStats.ReadIOPS,
+			"write_iops":          ioStats.WriteIOPS,
+			"read_await_ms":       ioStats.ReadAwaitMs,
+			"write_await_ms":      ioStats.WriteAwaitMs,
+			"await_ms":            ioStats.AwaitMs,
+			"utilization_percent": ioStats.UtilizationPercent,
+			"ios_in_progress":     int64(ioStats.IOsInProgress),
+		}
+		c.add("disk_io", tags, fields)
+	}
+}
+
+func collectMDArrays(c *collection, mdCollector *mdraid.Collector) diskEnricher {
+	arrays, err := mdCollector.Collect()
+	c.report("mdraid", err)
+	if err != nil {
+		logrus.Errorf("Failed to retrieve md arrays: %v", err)
+		return nil
+	}
+	for _, array := range arrays {
+		status, condition := array.Status()
+		if status != diskinfo.StatusSafe {
+			logrus.Warnf("RAID array %s: %s", array.Name, condition)
+		}
+		tags := map[string]string{
+			"array": array.Name,
+			"level": array.Level,
+		}
+		fields := map[string]interface{}{
+			"status":         array.StatusToInt(),
+			"condition":      condition,
+			"state":          array.State,
+			"raid_disks":     array.RaidDisks,
+			"active_disks":   array.ActiveDisks,
+			"degraded_disks": array.DegradedDisks,
+			"failed_members": len(array.FailedMembers()),
+			"sync_action":    array.SyncAction,
+			"sync_progress":  array.SyncProgress,
+		}
+		c.add("md_array", tags, fields)
+	}
+	return func(disks []diskinfo.DiskInfo) {
+		mdraid.ApplyToDisks(disks, arrays)
+	}
+}
+
+func collectZFSPools(c *collection, zfsCollector *zfs.Collector) diskEnricher {
+	pools, err := zfsCollector.Collect()
+	c.report("zfs", err)
+	if err != nil {
+		logrus.Errorf("Failed to retrieve zfs pools: %v", err)
+		return nil
+	}
+	for _, pool := range pools {
+		status, condition := pool.Status()
+		if status != diskinfo.StatusSafe {
+			logrus.Warnf("ZFS pool %s: %s", pool.Name, condition)
+		}
+		readErrors, writeErrors, checksumErrors := pool.ErrorTotals()
+		tags := map[string]string{
+			"pool": pool.Name,
+		}
+		fields := map[string]interface{}{
+			"status":          pool.StatusToInt(),
+			"condition":       condition,
+			"state":           pool.State,
+			"size":            int64(pool.Size),
+			"allocated":       int64(pool.Allocated),
+			"free":            int64(pool.Free),
+			"fragmentation":   pool.Fragmentation,
+			"capacity":        pool.Capacity,
+			"read_errors":     int64(readErrors),
+			"write_errors":    int64(writeErrors),
+			"checksum_errors": int64(checksumErrors),
+			"scan_function":   pool.ScanFunction,
+			"scan_state":      pool.ScanState,
+			"scan_progress":   pool.ScanProgress,
+			"scan_errors":     pool.ScanErrors,
+		}
+		c.add("zfs_pool", tags, fields)
+		for _, vdev := range pool.Vdevs {
+			if vdev.Depth == 0 {
+				continue
+			}
+			vdevStatus, vdevCondition := vdev.Status()
+			vdevTags := map[string]string{
+				"pool":   pool.Name,
+				"vdev":   vdev.Name,
+				"device": vdev.DeviceName,
+			}
+			vdevFields := map[string]interface{}{
+				"status":          diskinfo.DiskInfo{Status: vdevStatus}.StatusToInt(),
+				"condition":       vdevCondition,
+				"state":           vdev.State,
+				"read_errors":     int64(vdev.ReadErrors),
+				"write_errors":    int64(vdev.WriteErrors),
+				"checksum_errors": int64(vdev.ChecksumErrors),
+			}
+			c.add("zfs_vdev", vdevTags, vdevFields)
+		}
+	}
+	return func(disks []diskinfo.DiskInfo) {
+		zfs.ApplyToDisks(disks, pools)
+	}
+}
+
+func collectBtrfsStats(c *collection, btrfsCollector *btrfs.Collector) diskEnricher {
+	stats, err := btrfsCollector.Collect()
+	c.report("btrfs", err)
+	if err != nil {
+		logrus.Errorf("Failed to retrieve btrfs device stats: %v", err)
+		return nil
+	}
+	for _, device := range stats {
+		status, condition := device.Status()
+		if status != diskinfo.StatusSafe {
+			logrus.Warnf("Btrfs %s: %s", device.Mountpoint, condition)
+		}
+		tags := map[string]string{
+			"mountpoint": device.Mountpoint,
+			"device":     device.DeviceName,
+		}
+		fields := map[string]interface{}{
+			"status":          device.StatusToInt(),
+			"condition":       condition,
+			"write_io_errs":   int64(device.WriteErrors),
+			"read_io_errs":    int64(device.ReadErrors),
+			"flush_io_errs":   int64(device.FlushErrors),
+			"corruption_errs": int64(device.CorruptionErrors),
+			"generation_errs": int64(device.GenerationErrors),
+			"missing":         device.Missing,
 		}
-		point := write.NewPoint("disk", tags, fields, time.Now())
-		time.Sleep(5 * time.Second)
+		c.add("btrfs_device", tags, fields)
+	}
+	return func(disks []diskinfo.DiskInfo) {
+		btrfs.ApplyToDisks(disks, stats)
+	}
+}
 
-		if err := writeAPI.WritePoint(ctx, point); err != nil {
-			logrus.Errorf("Error sending flux point %v", err)
+func collectLVMVolumes(c *collection, lvmCollector *lvm.Collector) diskEnricher {
+	volumes, err := lvmCollector.Collect()
+	c.report("lvm", err)
+	if err != nil {
+		logrus.Errorf("Failed to retrieve lvm volumes: %v", err)
+		return nil
+	}
+	for _, lv := range volumes {
+		status, condition := lv.Status()
+		if status != diskinfo.StatusSafe {
+			logrus.Warnf("LVM %s: %s", lv.FullName(), condition)
+		}
+		tags := map[string]string{
+			"volume_group": lv.VolumeGroup,
+			"volume":       lv.Name,
+			"segtype":      lv.SegmentType,
+		}
+		fields := map[string]interface{}{
+			"status":           lv.StatusToInt(),
+			"condition":        condition,
+			"attr":             lv.Attr,
+			"health_status":    lv.HealthStatus,
+			"missing_pvs":      lv.MissingPVs,
+			"data_percent":     lv.DataPercent,
+			"metadata_percent": lv.MetadataPercent,
+			"sync_percent":     lv.SyncPercent,
+		}
+		c.add("lvm_volume", tags, fields)
+	}
+	return func(disks []diskinfo.DiskInfo) {
+		lvm.ApplyToDisks(disks, volumes)
+	}
+}
+
+func collectKernelErrors(c *collection, follower *kmsg.Follower) diskEnricher {
+	events := follower.Events()
+	for _, event := range events {
+		tags := map[string]string{
+			"device": event.DeviceName,
+			"kind":   event.Kind,
+		}
+		fields := map[string]interface{}{
+			"count":        event.Count,
+			"last_message": event.LastMessage,
+			"last_seen":    event.LastSeen.Unix(),
+		}
+		c.add("kernel_io_error", tags, fields)
+	}
+	return func(disks []diskinfo.DiskInfo) {
+		kmsg.ApplyToDisks(disks, events, kmsg.DefaultWindow)
+	}
+}
+
+func hwmonTemperatures(c *collection, reader *hwmon.Reader) diskEnricher {
+	sensors, err := reader.Read()
+	c.report("hwmon", err)
+	if err != nil {
+		logrus.Errorf("Failed to read hwmon sensors: %v", err)
+		return nil
+	}
+	return func(disks []diskinfo.DiskInfo) {
+		hwmon.ApplyToDisks(disks, sensors, diskinfo.DefaultSysRoot)
+	}
+}
+
+func followKernelLog(ctx context.Context, follower *kmsg.Follower) {
+	if err := follower.Run(ctx); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			logrus.Debugf("Kernel log not available: %v", err)
+			return
+		}
+		logrus.Errorf("Kernel log follower stopped: %v", err)
+	}
+}
+
+// collectSinkStats reports the write outcomes of the sinks, as of the end of
+// the previous cycle.
+func collectSinkStats(c *collection, sinks []sink.Sink) {
+	for _, output := range sinks {
+		reporter, ok := output.(sink.StatsReporter)
+		if !ok {
+			continue
+		}
+		stats := reporter.Stats()
+		tags := map[string]string{
+			"sink": output.Name(),
+		}
+		fields := map[string]interface{}{
+			"written_batches": stats.WrittenBatches,
+			"written_points":  stats.WrittenPoints,
+			"failed_batches":  stats.FailedBatches,
+			"failed_points":   stats.FailedPoints,
+			"dropped_batches": stats.DroppedBatches,
+			"dropped_points":  stats.DroppedPoints,
+			"retries":         stats.Retries,
+			"queued_batches":  stats.Queued,
+		}
+		if stats.Spooling {
+			fields["spooled_batches"] = stats.SpooledBatches
+			fields["spooled_bytes"] = stats.SpooledBytes
+			fields["spool_dropped_batches"] = stats.SpoolDroppedBatches
+			fields["spool_dropped_bytes"] = stats.SpoolDroppedBytes
+		}
+		if !stats.LastSuccess.IsZero() {
+			fields["last_success"] = stats.LastSuccess.Unix()
+		}
+		if stats.LastError != "" {
+			fields["last_error"] = stats.LastError
+		}
+		c.add("sink_write", tags, fields)
+	}
+}
+
+// writeBatch writes to each sink the part of the batch routed to it.
+func writeBatch(ctx context.Context, sinks []sink.Sink, router *route.Router, batch sink.Batch) {
+	for _, output := range sinks {
+		if err := output.Write(ctx, router.Batch(output.Name(), batch)); err != nil {
+			logrus.Errorf("Error writing to sink %s: %v", output.Name(), err)
 		}
 	}
 }
 
 func Service(ctx context.Context, cancelFunc context.CancelFunc, config *appconfig.AppConfig) {
-	client := influxdb2.NewClient(config.InfluxURL, config.InfluxToken)
-	defer client.Close()
-	writeAPI := client.WriteAPIBlocking(config.InfluxOrg, config.InfluxBucket)
+	sinks, err := sink.NewSinks(config)
+	if err != nil {
+		logrus.Errorf("Failed to create sinks: %v", err)
+		cancelFunc()
+		return
+	}
+	defer func() {
+		for _, output := range sinks {
+			output.Close()
+		}
+	}()
+	router := route.NewRouter(config.Routes)
+	alerts, err := alert.NewManager(config.Alerting, router)
+	if err != nil {
+		logrus.Errorf("Failed to create alerting: %v", err)
+		cancelFunc()
+		return
+	}
+	if alerts != nil {
+		sinks = append(sinks, alerts)
+	}
 	diskInfoProvider := diskinfo.NewDiskInfoProvider(ctx)
+	ioCollector := diskio.NewCollector(ctx)
+	mdCollector := mdraid.NewCollector(mdraid.DefaultProcRoot, mdraid.DefaultSysRoot)
+	runner := cmdrunner.NewExecRunner()
+	zfsCollector := zfs.NewCollector(ctx, runner)
+	btrfsCollector := btrfs.NewCollector(ctx, runner)
+	lvmCollector := lvm.NewCollector(ctx, runner)
+	kernelLog := kmsg.NewFollower(kmsg.DevKmsgSource{Path: kmsg.DefaultDevice}, diskinfo.DefaultSysRoot)
+	go followKernelLog(ctx, kernelLog)
+	hwmonReader := hwmon.NewReader(diskinfo.DefaultSysRoot)
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 	for {
@@ -50,7 +452,17 @@ func Service(ctx context.Context, cancelFunc context.CancelFunc, config *appconf
 			cancelFunc()
 			return
 		case <-ticker.C:
-			sendDiskInfo(ctx, cancelFunc, writeAPI, diskInfoProvider, config)
+			c := newCollection(config)
+			mdEnricher := collectMDArrays(c, mdCollector)
+			zfsEnricher := collectZFSPools(c, zfsCollector)
+			btrfsEnricher := collectBtrfsStats(c, btrfsCollector)
+			lvmEnricher := collectLVMVolumes(c, lvmCollector)
+			kernelEnricher := collectKernelErrors(c, kernelLog)
+			hwmonEnricher := hwmonTemperatures(c, hwmonReader)
+			disks := collectDiskInfo(c, cancelFunc, diskInfoProvider, hwmonEnricher, mdEnricher, zfsEnricher, btrfsEnricher, lvmEnricher, kernelEnricher)
+			collectDiskIO(c, ioCollector)
+			collectSinkStats(c, sinks)
+			writeBatch(ctx, sinks, router, c.batch(disks))
 		}
 	}
 }
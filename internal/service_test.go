@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"context"
+	"gama-client/internal/appconfig"
+	"gama-client/internal/diskinfo"
+	"gama-client/internal/sink"
+	"strings"
+	"testing"
+	"time"
+)
+
+type statsSink struct {
+	stats sink.WriteStats
+}
+
+func (s *statsSink) Name() string                            { return "primary" }
+func (s *statsSink) Write(context.Context, sink.Batch) error { return nil }
+func (s *statsSink) Close() error                            { return nil }
+func (s *statsSink) Stats() sink.WriteStats                  { return s.stats }
+
+func TestCollectSinkStatsReachesOutputs(t *testing.T) {
+	config := &appconfig.AppConfig{InfluxTags: appconfig.InfluxTagsConfig{Host: "web1", Client: "acme"}}
+	output := &statsSink{stats: sink.WriteStats{
+		WrittenBatches:      4,
+		Spooling:            true,
+		SpooledBatches:      3,
+		SpooledBytes:        2048,
+		SpoolDroppedBatches: 1,
+		SpoolDroppedBytes:   512,
+		LastSuccess:         time.Unix(1700000000, 0),
+	}}
+	c := newCollection(config)
+	collectSinkStats(c, []sink.Sink{output})
+	batch := c.batch(nil)
+
+	lines := sink.LineProtocol(batch.Points, time.Nanosecond)
+	for _, field := range []string{"spooled_batches=3i", "spooled_bytes=2048i", "spool_dropped_batches=1i", "spool_dropped_bytes=512i", "written_batches=4i"} {
+		if !strings.Contains(lines, field) {
+			t.Errorf("line protocol %q misses %s", lines, field)
+		}
+	}
+	if !strings.HasPrefix(lines, "sink_write,client=acme,host=web1,sink=primary ") {
+		t.Errorf("unexpected series in %q", lines)
+	}
+
+	var metrics strings.Builder
+	sink.WritePrometheus(&metrics, batch)
+	for _, metric := range []string{
+		`smp_sink_write_spooled_batches{client="acme",host="web1",sink="primary"} 3`,
+		`smp_sink_write_spool_dropped_bytes{client="acme",host="web1",sink="primary"} 512`,
+	} {
+		if !strings.Contains(metrics.String(), metric) {
+			t.Errorf("Prometheus output misses %s:\n%s", metric, metrics.String())
+		}
+	}
+}
+
+func TestCollectSinkStatsOmitsSpoolWithoutSpool(t *testing.T) {
+	c := newCollection(&appconfig.AppConfig{})
+	collectSinkStats(c, []sink.Sink{&statsSink{}})
+	if len(c.points) != 1 {
+		t.Fatalf("got %d points, want 1", len(c.points))
+	}
+	if _, ok := c.points[0].Fields["spooled_batches"]; ok {
+		t.Errorf("spool fields reported for a sink without spool: %v", c.points[0].Fields)
+	}
+}
+
+func TestCollectReliabilityEmitsReportedCounters(t *testing.T) {
+	wear, powerOnHours := 7, 8412
+	readErrors := int64(12)
+	disk := diskinfo.DiskInfo{DeviceName: `\\.\PHYSICALDRIVE0`, Health: diskinfo.HealthSnapshot{
+		Wear:            &wear,
+		PowerOnHours:    &powerOnHours,
+		ReadErrorsTotal: &readErrors,
+	}}
+	c := newCollection(&appconfig.AppConfig{})
+	collectReliability(c, disk)
+	collectReliability(c, diskinfo.DiskInfo{DeviceName: "/dev/sda"})
+	batch := c.batch(nil)
+
+	lines := sink.LineProtocol(batch.Points, time.Nanosecond)
+	if strings.Count(lines, "disk_reliability,") != 1 {
+		t.Fatalf("want one reliability point, got %q", lines)
+	}
+	for _, field := range []string{"wear=7i", "power_on_hours=8412i", "read_errors_total=12i"} {
+		if !strings.Contains(lines, field) {
+			t.Errorf("line protocol %q misses %s", lines, field)
+		}
+	}
+	if strings.Contains(lines, "write_errors_total") {
+		t.Errorf("unreported counter in %q", lines)
+	}
+}
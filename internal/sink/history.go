@@ -0,0 +1,154 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gama-client/internal/appconfig"
+	"gama-client/internal/history"
+	"github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// historyQueueSize is the number of collections waiting to be stored
+	// before new ones are dropped.
+	historyQueueSize = 4
+	// historyMaintenanceInterval is how often the old rows are downsampled.
+	historyMaintenanceInterval = time.Hour
+)
+
+// HistorySink stores the collections in a local SQLite database and serves
+// them over HTTP, so the history is available without any server. Writes and
+// downsampling happen in the background.
+type HistorySink struct {
+	name     string
+	store    *history.Store
+	interval time.Duration
+	server   *http.Server
+
+	queue chan Batch
+	done  chan struct{}
+	last  time.Time
+
+	mu    sync.Mutex
+	stats WriteStats
+}
+
+func NewHistorySink(config appconfig.SinkConfig) (*HistorySink, error) {
+	store, err := history.Open(config.HistoryPath,
+		time.Duration(config.HistoryRetentionDays)*24*time.Hour,
+		time.Duration(config.HistoryDownsampleMinutes)*time.Minute,
+		time.Duration(config.HistoryDownsampleRetentionDays)*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", config.HistoryListenAddress)
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to listen on %s: %w", config.HistoryListenAddress, err)
+	}
+	sink := &HistorySink{
+		name:     config.Name,
+		store:    store,
+		interval: time.Duration(config.HistoryIntervalSeconds) * time.Second,
+		server:   &http.Server{Handler: history.NewHandler(store), ReadHeaderTimeout: 10 * time.Second},
+		queue:    make(chan Batch, historyQueueSize),
+		done:     make(chan struct{}),
+	}
+	go func() {
+		if err := sink.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.Errorf("History API %s stopped: %v", config.Name, err)
+		}
+	}()
+	go sink.run()
+	logrus.Infof("Serving the history of %s on %s", config.HistoryPath, config.HistoryListenAddress)
+	return sink, nil
+}
+
+func (s *HistorySink) Name() string {
+	return s.name
+}
+
+// Write queues the collection, unless the previous one stored is more recent
+// than the interval.
+func (s *HistorySink) Write(_ context.Context, batch Batch) error {
+	if len(batch.Disks) == 0 || batch.Time.Sub(s.last) < s.interval {
+		return nil
+	}
+	select {
+	case s.queue <- batch:
+		s.last = batch.Time
+		return nil
+	default:
+		s.record(func(stats *WriteStats) {
+			stats.DroppedBatches++
+		})
+		return fmt.Errorf("history queue is full, dropped a collection of %d disks", len(batch.Disks))
+	}
+}
+
+func (s *HistorySink) run() {
+	defer close(s.done)
+	s.downsample()
+	ticker := time.NewTicker(historyMaintenanceInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case batch, ok := <-s.queue:
+			if !ok {
+				return
+			}
+			rows, err := s.store.Record(batch.Host, batch.Client, batch.Time, batch.Disks)
+			s.record(func(stats *WriteStats) {
+				if err != nil {
+					stats.FailedBatches++
+					stats.LastError = err.Error()
+					return
+				}
+				stats.WrittenBatches++
+				stats.WrittenPoints += int64(rows)
+				stats.LastSuccess = time.Now()
+			})
+			if err != nil {
+				logrus.Errorf("Error storing the history of %d disks: %v", len(batch.Disks), err)
+			}
+		case <-ticker.C:
+			s.downsample()
+		}
+	}
+}
+
+func (s *HistorySink) downsample() {
+	if err := s.store.Downsample(time.Now()); err != nil {
+		logrus.Errorf("Error downsampling the history of %s: %v", s.name, err)
+	}
+}
+
+func (s *HistorySink) record(update func(stats *WriteStats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update(&s.stats)
+}
+
+func (s *HistorySink) Stats() WriteStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	stats.Queued = len(s.queue)
+	return stats
+}
+
+// Close stores the queued collections, then stops the API and closes the
+// database.
+func (s *HistorySink) Close() error {
+	close(s.queue)
+	<-s.done
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s.server.Shutdown(ctx)
+	return s.store.Close()
+}
@@ -0,0 +1,62 @@
+package sink
+
+import (
+	"context"
+	"gama-client/internal/appconfig"
+	"gama-client/internal/diskinfo"
+	"gama-client/internal/history"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistorySinkStoresCollectionsAtInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	config := appconfig.SinkConfig{Name: "history-0", Type: appconfig.SinkHistory, HistoryConfig: appconfig.HistoryConfig{
+		HistoryPath:                    path,
+		HistoryListenAddress:           "127.0.0.1:0",
+		HistoryIntervalSeconds:         60,
+		HistoryRetentionDays:           7,
+		HistoryDownsampleMinutes:       60,
+		HistoryDownsampleRetentionDays: 365,
+	}}
+	output, err := NewHistorySink(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disk := diskinfo.DiskInfo{DeviceName: "/dev/sda", Status: diskinfo.StatusSafe, Check: diskinfo.CheckOK, Condition: "All checks passed",
+		Health: diskinfo.HealthSnapshot{Attributes: []diskinfo.SMARTAttribute{{ID: 5, Name: "Reallocated_Sector_Ct", Value: 100, Worst: 100, Thresh: 10}}}}
+	now := time.Now().Truncate(time.Second)
+	batches := []Batch{
+		{Time: now.Add(-2 * time.Minute), Host: "web1", Client: "acme", Disks: []diskinfo.DiskInfo{disk}},
+		// Within the interval of the previous collection.
+		{Time: now.Add(-90 * time.Second), Host: "web1", Client: "acme", Disks: []diskinfo.DiskInfo{disk}},
+		// A failed collection.
+		{Time: now.Add(-time.Minute), Host: "web1", Client: "acme"},
+		{Time: now.Add(-time.Minute), Host: "web1", Client: "acme", Disks: []diskinfo.DiskInfo{disk}},
+	}
+	for _, batch := range batches {
+		if err := output.Write(context.Background(), batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := output.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := output.Stats(); stats.WrittenBatches != 2 || stats.WrittenPoints != 4 || stats.FailedBatches != 0 {
+		t.Errorf("got %+v, want 2 batches of a status and an attribute row", stats)
+	}
+
+	store, err := history.Open(path, time.Hour, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	points, err := store.Status("sda", now.Add(-time.Hour), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 2 || !points[0].Time.Equal(now.Add(-2*time.Minute)) || !points[1].Time.Equal(now.Add(-time.Minute)) {
+		t.Errorf("got %+v", points)
+	}
+}
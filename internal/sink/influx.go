@@ -0,0 +1,361 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gama-client/internal/appconfig"
+	"gama-client/internal/spool"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	http2 "github.com/influxdata/influxdb-client-go/v2/api/http"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// influxQueueSize is the number of cycles waiting to be written before the
+	// oldest is dropped.
+	influxQueueSize = 16
+	// influxCloseTimeout is how long Close waits for the queue to drain.
+	influxCloseTimeout = 10 * time.Second
+	// spoolPrecision is the timestamp precision of the spooled batches, which
+	// are converted to the precision of the sink when sent, so they stay valid
+	// when influx_options changes between restarts.
+	spoolPrecision = time.Nanosecond
+)
+
+// influxPrecisions are the timestamp precisions of the influx_options.
+var influxPrecisions = map[string]time.Duration{
+	appconfig.PrecisionNanoseconds:  time.Nanosecond,
+	appconfig.PrecisionMicroseconds: time.Microsecond,
+	appconfig.PrecisionMilliseconds: time.Millisecond,
+	appconfig.PrecisionSeconds:      time.Second,
+}
+
+// influxBatch is the line protocol of one collection cycle.
+type influxBatch struct {
+	lines  string
+	points int
+}
+
+// lineWriter delivers the line protocol of a cycle to an InfluxDB v2 or v1
+// server, or to a line protocol listener. Failures worth retrying are returned
+// as a RetryableError.
+type lineWriter interface {
+	WriteLines(ctx context.Context, lines string) error
+	Close() error
+}
+
+// InfluxSink writes the points as line protocol. Write only queues the cycle;
+// a background writer sends each cycle as a single request, retrying with
+// RetryPolicy, so a slow or unreachable server never delays collection.
+//
+// With a spool, every cycle is stored on disk first and the spool is replayed
+// in order, so the batches survive an outage or a restart of the agent.
+type InfluxSink struct {
+	name      string
+	writer    lineWriter
+	precision time.Duration
+	policy    RetryPolicy
+	spool     *spool.Spool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	queue  chan influxBatch
+	done   chan struct{}
+
+	mu    sync.Mutex
+	stats WriteStats
+}
+
+// NewInfluxSink writes to an InfluxDB v2 bucket.
+func NewInfluxSink(config appconfig.SinkConfig) (*InfluxSink, error) {
+	httpClient, err := newInfluxHTTPClient(config.InfluxOptions)
+	if err != nil {
+		return nil, err
+	}
+	precision := influxPrecisions[config.InfluxOptions.Precision]
+	options := influxdb2.DefaultOptions().
+		SetHTTPClient(httpClient).
+		SetUseGZip(config.InfluxOptions.Gzip).
+		SetPrecision(precision)
+	client := influxdb2.NewClientWithOptions(config.InfluxURL, config.InfluxToken, options)
+	writer := &influxV2Writer{client: client, writeAPI: client.WriteAPIBlocking(config.InfluxOrg, config.InfluxBucket)}
+	return newInfluxSink(config.Name, writer, precision, config.SpoolConfig)
+}
+
+// newInfluxHTTPClient builds the HTTP client of an InfluxDB server with the
+// TLS, proxy and timeout settings of the influx_options.
+func newInfluxHTTPClient(options appconfig.InfluxOptions) (*http.Client, error) {
+	tlsConfig, err := newTLSConfig(options.CAFile, options.CertFile, options.KeyFile, options.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if options.ProxyURL != "" {
+		proxy, err := url.Parse(options.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy_url: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	return &http.Client{Transport: transport, Timeout: time.Duration(options.TimeoutSeconds) * time.Second}, nil
+}
+
+// newInfluxSink sends the points to writer, encoded with the timestamp
+// precision it expects.
+func newInfluxSink(name string, writer lineWriter, precision time.Duration, spoolConfig appconfig.SpoolConfig) (*InfluxSink, error) {
+	var buffer *spool.Spool
+	if spoolConfig.SpoolDir != "" {
+		var err error
+		maxAge := time.Duration(spoolConfig.SpoolMaxAgeHours) * time.Hour
+		buffer, err = spool.Open(spoolConfig.SpoolDir, int64(spoolConfig.SpoolMaxMB)<<20, maxAge)
+		if err != nil {
+			writer.Close()
+			return nil, err
+		}
+		if pending := buffer.Len(); pending > 0 {
+			logrus.Infof("Sink %s has %d spooled batches to replay", name, pending)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sink := &InfluxSink{
+		name:      name,
+		writer:    writer,
+		precision: precision,
+		policy:    DefaultRetryPolicy,
+		spool:     buffer,
+		ctx:       ctx,
+		cancel:    cancel,
+		queue:     make(chan influxBatch, influxQueueSize),
+		done:      make(chan struct{}),
+	}
+	if buffer != nil {
+		go sink.runSpooled()
+	} else {
+		go sink.run()
+	}
+	return sink, nil
+}
+
+func (s *InfluxSink) Name() string {
+	return s.name
+}
+
+// Write queues the batch. When the queue is full the oldest cycle is dropped.
+func (s *InfluxSink) Write(_ context.Context, batch Batch) error {
+	if len(batch.Points) == 0 {
+		return nil
+	}
+	precision := s.precision
+	if s.spool != nil {
+		precision = spoolPrecision
+	}
+	pending := influxBatch{lines: LineProtocol(batch.Points, precision), points: len(batch.Points)}
+	for {
+		select {
+		case s.queue <- pending:
+			return nil
+		default:
+		}
+		select {
+		case dropped := <-s.queue:
+			s.record(func(stats *WriteStats) {
+				stats.DroppedBatches++
+				stats.DroppedPoints += int64(dropped.points)
+			})
+			logrus.Warnf("Sink %s queue is full, dropped a batch of %d points", s.name, dropped.points)
+		default:
+		}
+	}
+}
+
+func (s *InfluxSink) run() {
+	defer close(s.done)
+	for batch := range s.queue {
+		s.send(batch)
+	}
+}
+
+func (s *InfluxSink) send(batch influxBatch) {
+	attempts, err := s.policy.Do(s.ctx, func() error {
+		return s.writer.WriteLines(s.ctx, batch.lines)
+	})
+	s.record(func(stats *WriteStats) {
+		stats.Retries += int64(attempts - 1)
+		if err != nil {
+			stats.FailedBatches++
+			stats.FailedPoints += int64(batch.points)
+			stats.LastError = err.Error()
+			return
+		}
+		stats.WrittenBatches++
+		stats.WrittenPoints += int64(batch.points)
+		stats.LastSuccess = time.Now()
+	})
+	switch {
+	case err != nil:
+		logrus.Errorf("Error writing %d points to %s after %d attempts: %v", batch.points, s.name, attempts, err)
+	case attempts > 1:
+		logrus.Infof("Wrote %d points to %s after %d attempts", batch.points, s.name, attempts)
+	default:
+		logrus.Debugf("Wrote %d points to %s", batch.points, s.name)
+	}
+}
+
+// runSpooled appends every cycle to the spool and replays it. After a
+// retryable failure, the replay waits for the backoff delay, or the delay the
+// server asked for, while new cycles keep being spooled.
+func (s *InfluxSink) runSpooled() {
+	defer close(s.done)
+	var retry <-chan time.Time
+	var retryAt time.Time
+	interval := s.policy.InitialInterval
+	for {
+		select {
+		case batch, ok := <-s.queue:
+			if !ok {
+				return
+			}
+			if err := s.spool.Append([]byte(batch.lines)); err != nil {
+				logrus.Errorf("Error spooling %d points for %s: %v", batch.points, s.name, err)
+				batch.lines = convertPrecision(batch.lines, s.precision)
+				s.send(batch)
+				continue
+			}
+			if time.Now().Before(retryAt) {
+				continue
+			}
+		case <-retry:
+		}
+		delay, ok := s.replay()
+		if ok {
+			retry, retryAt = nil, time.Time{}
+			interval = s.policy.InitialInterval
+			continue
+		}
+		if delay == 0 {
+			delay = interval
+			interval = min(interval*2, s.policy.MaxInterval)
+		}
+		delay = min(delay, s.policy.MaxRetryAfter)
+		retry, retryAt = time.After(delay), time.Now().Add(delay)
+	}
+}
+
+// replay writes the spooled batches in order until the spool is empty or a
+// write fails with a retryable error, in which case it returns the delay the
+// server asked for. Batches the server rejects are dropped.
+func (s *InfluxSink) replay() (time.Duration, bool) {
+	for {
+		data, ok, err := s.spool.Oldest()
+		if err != nil {
+			logrus.Errorf("Error reading spool of %s: %v", s.name, err)
+			continue
+		}
+		if !ok {
+			return 0, true
+		}
+		points := strings.Count(string(data), "\n")
+		err = s.writer.WriteLines(s.ctx, convertPrecision(string(data), s.precision))
+		var retryable *RetryableError
+		if errors.As(err, &retryable) {
+			s.record(func(stats *WriteStats) {
+				stats.Retries++
+				stats.LastError = err.Error()
+			})
+			logrus.Warnf("Error writing %d spooled points to %s, %d batches pending: %v", points, s.name, s.spool.Len(), err)
+			return retryable.RetryAfter, false
+		}
+		s.spool.Remove()
+		s.record(func(stats *WriteStats) {
+			if err != nil {
+				stats.FailedBatches++
+				stats.FailedPoints += int64(points)
+				stats.LastError = err.Error()
+				return
+			}
+			stats.WrittenBatches++
+			stats.WrittenPoints += int64(points)
+			stats.LastSuccess = time.Now()
+		})
+		if err != nil {
+			logrus.Errorf("Dropped %d spooled points rejected by %s: %v", points, s.name, err)
+		} else {
+			logrus.Debugf("Wrote %d spooled points to %s", points, s.name)
+		}
+	}
+}
+
+func (s *InfluxSink) record(update func(stats *WriteStats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update(&s.stats)
+}
+
+func (s *InfluxSink) Stats() WriteStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	stats.Queued = len(s.queue)
+	if s.spool != nil {
+		spooled, dropped := s.spool.Stats()
+		stats.Spooling = true
+		stats.SpooledBatches = spooled.Batches
+		stats.SpooledBytes = spooled.Bytes
+		stats.SpoolDroppedBatches = dropped.Batches
+		stats.SpoolDroppedBytes = dropped.Bytes
+	}
+	return stats
+}
+
+// Close waits for the queued batches to be written, or spooled, then gives up
+// on the remaining ones.
+func (s *InfluxSink) Close() error {
+	close(s.queue)
+	select {
+	case <-s.done:
+	case <-time.After(influxCloseTimeout):
+		s.cancel()
+		<-s.done
+	}
+	s.cancel()
+	return s.writer.Close()
+}
+
+type influxV2Writer struct {
+	client   influxdb2.Client
+	writeAPI api.WriteAPIBlocking
+}
+
+func (w *influxV2Writer) WriteLines(ctx context.Context, lines string) error {
+	return classifyInfluxError(w.writeAPI.WriteRecord(ctx, lines))
+}
+
+func (w *influxV2Writer) Close() error {
+	w.client.Close()
+	return nil
+}
+
+// classifyInfluxError marks network failures, 429 and 5xx responses as
+// retryable. Other responses, such as a malformed point or a bad token, fail
+// at once.
+func classifyInfluxError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var httpError *http2.Error
+	if !errors.As(err, &httpError) {
+		return err
+	}
+	if httpError.StatusCode != 0 && httpError.StatusCode != http.StatusTooManyRequests && httpError.StatusCode < 500 {
+		return err
+	}
+	return &RetryableError{Err: err, RetryAfter: time.Duration(httpError.RetryAfter) * time.Second}
+}
@@ -0,0 +1,178 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gama-client/internal/appconfig"
+	http2 "github.com/influxdata/influxdb-client-go/v2/api/http"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingWriter keeps the lines it is sent. It fails every write with a
+// retryable error when fail is set, or the first failures ones, asking to
+// retry after retryAfter.
+type recordingWriter struct {
+	mu         sync.Mutex
+	fail       bool
+	failures   int
+	retryAfter time.Duration
+	attempts   []time.Time
+	lines      []string
+}
+
+func (w *recordingWriter) WriteLines(_ context.Context, lines string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.attempts = append(w.attempts, time.Now())
+	if w.fail || len(w.attempts) <= w.failures {
+		return &RetryableError{Err: errUnavailable, RetryAfter: w.retryAfter}
+	}
+	w.lines = append(w.lines, lines)
+	return nil
+}
+
+func (w *recordingWriter) Close() error {
+	return nil
+}
+
+func (w *recordingWriter) written() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.lines...)
+}
+
+func TestInfluxSinkReplaysSpoolAtCurrentPrecision(t *testing.T) {
+	spoolConfig := appconfig.SpoolConfig{SpoolDir: t.TempDir(), SpoolMaxMB: 1, SpoolMaxAgeHours: 1}
+
+	// A sink writing milliseconds spools the batch while its server is down.
+	offline, err := newInfluxSink("influx", &recordingWriter{fail: true}, time.Millisecond, spoolConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := offline.Write(context.Background(), testBatch()); err != nil {
+		t.Fatal(err)
+	}
+	if err := offline.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// After a restart with second precision, the spooled batch is sent in
+	// seconds too.
+	writer := &recordingWriter{}
+	online, err := newInfluxSink("influx", writer, time.Second, spoolConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := online.Write(context.Background(), testBatch()); err != nil {
+		t.Fatal(err)
+	}
+	if err := online.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := "disk,device=/dev/sda,host=web1 status=1i 1700000000\n"
+	got := writer.written()
+	if len(got) != 2 || got[0] != want || got[1] != want {
+		t.Errorf("got %q, want two batches of %q", got, want)
+	}
+	if stats := online.Stats(); stats.WrittenBatches != 2 || stats.SpooledBatches != 0 {
+		t.Errorf("got %d written and %d spooled batches, want 2 and 0", stats.WrittenBatches, stats.SpooledBatches)
+	}
+}
+
+// waitWritten waits for the writer to deliver a batch and returns the times
+// of its attempts.
+func waitWritten(t *testing.T, writer *recordingWriter) []time.Time {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		writer.mu.Lock()
+		written, attempts := len(writer.lines), append([]time.Time(nil), writer.attempts...)
+		writer.mu.Unlock()
+		if written > 0 {
+			return attempts
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("batch not written")
+	return nil
+}
+
+func TestInfluxSinkSpoolBackoff(t *testing.T) {
+	policy := DefaultRetryPolicy
+	DefaultRetryPolicy = RetryPolicy{MaxAttempts: 5, InitialInterval: 20 * time.Millisecond, MaxInterval: 40 * time.Millisecond, MaxRetryAfter: 50 * time.Millisecond}
+	t.Cleanup(func() { DefaultRetryPolicy = policy })
+	tests := []struct {
+		name       string
+		retryAfter time.Duration
+		// delays are the least waits between the attempts.
+		delays []time.Duration
+	}{
+		{name: "backoff", delays: []time.Duration{20 * time.Millisecond, 40 * time.Millisecond, 40 * time.Millisecond}},
+		{name: "retry after", retryAfter: 30 * time.Millisecond, delays: []time.Duration{30 * time.Millisecond, 30 * time.Millisecond, 30 * time.Millisecond}},
+		{name: "retry after clamped", retryAfter: time.Hour, delays: []time.Duration{50 * time.Millisecond, 50 * time.Millisecond, 50 * time.Millisecond}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			writer := &recordingWriter{failures: len(test.delays), retryAfter: test.retryAfter}
+			spoolConfig := appconfig.SpoolConfig{SpoolDir: t.TempDir(), SpoolMaxMB: 1, SpoolMaxAgeHours: 1}
+			output, err := newInfluxSink("influx", writer, time.Second, spoolConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer output.Close()
+			if err := output.Write(context.Background(), testBatch()); err != nil {
+				t.Fatal(err)
+			}
+			// The replay is retried without any new collection.
+			attempts := waitWritten(t, writer)
+			if len(attempts) != len(test.delays)+1 {
+				t.Fatalf("got %d attempts, want %d", len(attempts), len(test.delays)+1)
+			}
+			for i, delay := range test.delays {
+				if got := attempts[i+1].Sub(attempts[i]); got < delay || got > delay*3/2+time.Second {
+					t.Errorf("delay %d: got %v, want at least %v", i, got, delay)
+				}
+			}
+			if stats := output.Stats(); stats.Retries != int64(len(test.delays)) || stats.WrittenBatches != 1 || stats.SpooledBatches != 0 {
+				t.Errorf("got %+v", stats)
+			}
+		})
+	}
+}
+
+func TestClassifyInfluxError(t *testing.T) {
+	tests := []struct {
+		err        error
+		retryable  bool
+		retryAfter time.Duration
+	}{
+		{err: &http2.Error{StatusCode: 0, Err: errUnavailable}, retryable: true},
+		{err: &http2.Error{StatusCode: http.StatusBadRequest, Message: "unable to parse points"}},
+		{err: &http2.Error{StatusCode: http.StatusUnauthorized, Message: "unauthorized access"}},
+		{err: &http2.Error{StatusCode: http.StatusTooManyRequests, RetryAfter: 10}, retryable: true, retryAfter: 10 * time.Second},
+		{err: &http2.Error{StatusCode: http.StatusServiceUnavailable}, retryable: true},
+		{err: fmt.Errorf("write failed: %w", &http2.Error{StatusCode: http.StatusBadGateway}), retryable: true},
+		{err: errUnavailable},
+	}
+	for _, test := range tests {
+		err := classifyInfluxError(test.err)
+		var retryable *RetryableError
+		if errors.As(err, &retryable) != test.retryable {
+			t.Errorf("%v: got retryable %v, want %v", test.err, !test.retryable, test.retryable)
+			continue
+		}
+		if test.retryable && retryable.RetryAfter != test.retryAfter {
+			t.Errorf("%v: got Retry-After %v, want %v", test.err, retryable.RetryAfter, test.retryAfter)
+		}
+		if !errors.Is(err, test.err) {
+			t.Errorf("%v: got %v, want it wrapped", test.err, err)
+		}
+	}
+	if classifyInfluxError(nil) != nil {
+		t.Error("got an error for a successful write")
+	}
+}
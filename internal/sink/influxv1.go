@@ -0,0 +1,96 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"gama-client/internal/appconfig"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// influxV1Precisions are the precision parameters of the 1.x write endpoint.
+var influxV1Precisions = map[string]string{
+	appconfig.PrecisionNanoseconds:  "ns",
+	appconfig.PrecisionMicroseconds: "u",
+	appconfig.PrecisionMilliseconds: "ms",
+	appconfig.PrecisionSeconds:      "s",
+}
+
+// NewInfluxV1Sink writes to a database of an InfluxDB 1.x server, or to any
+// listener of its /write endpoint such as Telegraf.
+func NewInfluxV1Sink(config appconfig.SinkConfig) (*InfluxSink, error) {
+	endpoint, err := url.Parse(strings.TrimSuffix(config.InfluxURL, "/") + "/write")
+	if err != nil {
+		return nil, fmt.Errorf("invalid influx_url: %w", err)
+	}
+	query := endpoint.Query()
+	query.Set("db", config.InfluxDatabase)
+	if config.InfluxRetentionPolicy != "" {
+		query.Set("rp", config.InfluxRetentionPolicy)
+	}
+	query.Set("precision", influxV1Precisions[config.InfluxOptions.Precision])
+	endpoint.RawQuery = query.Encode()
+	client, err := newInfluxHTTPClient(config.InfluxOptions)
+	if err != nil {
+		return nil, err
+	}
+	writer := &influxV1Writer{
+		client:   client,
+		url:      endpoint.String(),
+		username: config.InfluxUsername,
+		password: config.InfluxPassword,
+		gzip:     config.InfluxOptions.Gzip,
+	}
+	return newInfluxSink(config.Name, writer, influxPrecisions[config.InfluxOptions.Precision], config.SpoolConfig)
+}
+
+type influxV1Writer struct {
+	client   *http.Client
+	url      string
+	username string
+	password string
+	gzip     bool
+}
+
+func (w *influxV1Writer) WriteLines(ctx context.Context, lines string) error {
+	var body bytes.Buffer
+	if w.gzip {
+		compressor := gzip.NewWriter(&body)
+		if _, err := compressor.Write([]byte(lines)); err != nil {
+			return err
+		}
+		if err := compressor.Close(); err != nil {
+			return err
+		}
+	} else {
+		body.WriteString(lines)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, &body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.gzip {
+		request.Header.Set("Content-Encoding", "gzip")
+	}
+	if w.username != "" {
+		request.SetBasicAuth(w.username, w.password)
+	}
+	response, err := w.client.Do(request)
+	if err != nil {
+		return &RetryableError{Err: err}
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return ResponseError(response)
+	}
+	return nil
+}
+
+func (w *influxV1Writer) Close() error {
+	w.client.CloseIdleConnections()
+	return nil
+}
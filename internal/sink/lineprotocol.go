@@ -0,0 +1,145 @@
+package sink
+
+import (
+	"context"
+	"gama-client/internal/appconfig"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// udpPayloadSize keeps datagrams within the usual Ethernet MTU. A longer
+	// line is sent alone.
+	udpPayloadSize = 1400
+	dialTimeout    = 10 * time.Second
+	socketTimeout  = 20 * time.Second
+)
+
+// ToInfluxPoint converts the point, leaving out the empty tags, such as the
+// level of an inactive md array, which line protocol cannot represent.
+func ToInfluxPoint(point Point) *write.Point {
+	tags := make(map[string]string, len(point.Tags))
+	for key, value := range point.Tags {
+		if value != "" {
+			tags[key] = value
+		}
+	}
+	return write.NewPoint(point.Measurement, tags, point.Fields, point.Time)
+}
+
+// LineProtocol encodes the points as InfluxDB line protocol, one per line.
+func LineProtocol(points []Point, precision time.Duration) string {
+	var builder strings.Builder
+	for _, point := range points {
+		write.PointToLineProtocolBuffer(ToInfluxPoint(point), &builder, precision)
+	}
+	return builder.String()
+}
+
+// convertPrecision rescales the nanosecond timestamps of line protocol to the
+// precision. The timestamp is the last field of a line and never contains a
+// space; a line without one ends with a field set, which does not parse as an
+// integer and is left as is.
+func convertPrecision(lines string, precision time.Duration) string {
+	if precision <= time.Nanosecond {
+		return lines
+	}
+	var builder strings.Builder
+	builder.Grow(len(lines))
+	for _, line := range strings.SplitAfter(lines, "\n") {
+		end := strings.TrimSuffix(line, "\n")
+		space := strings.LastIndexByte(end, ' ')
+		timestamp, err := strconv.ParseInt(end[space+1:], 10, 64)
+		if space < 0 || err != nil {
+			builder.WriteString(line)
+			continue
+		}
+		builder.WriteString(end[:space+1])
+		builder.WriteString(strconv.FormatInt(timestamp/int64(precision), 10))
+		builder.WriteString(line[len(end):])
+	}
+	return builder.String()
+}
+
+// NewLineProtocolSink sends raw line protocol to a UDP, TCP or unix socket
+// listener, such as the Telegraf socket_listener input or the InfluxDB 1.x UDP
+// service.
+func NewLineProtocolSink(config appconfig.SinkConfig) (*InfluxSink, error) {
+	network, address, _ := strings.Cut(config.Address, "://")
+	return newInfluxSink(config.Name, &socketWriter{network: network, address: address}, time.Nanosecond, config.SpoolConfig)
+}
+
+// socketWriter keeps a connection to the listener and dials again after a
+// failed write. UDP batches are split into datagrams at line boundaries.
+type socketWriter struct {
+	network string
+	address string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (w *socketWriter) WriteLines(ctx context.Context, lines string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		dialer := net.Dialer{Timeout: dialTimeout}
+		conn, err := dialer.DialContext(ctx, w.network, w.address)
+		if err != nil {
+			return &RetryableError{Err: err}
+		}
+		w.conn = conn
+	}
+	w.conn.SetWriteDeadline(time.Now().Add(socketTimeout))
+	var err error
+	if w.network == "udp" {
+		for _, datagram := range splitLines(lines, udpPayloadSize) {
+			if _, err = w.conn.Write([]byte(datagram)); err != nil {
+				break
+			}
+		}
+	} else {
+		_, err = w.conn.Write([]byte(lines))
+	}
+	if err != nil {
+		w.conn.Close()
+		w.conn = nil
+		return &RetryableError{Err: err}
+	}
+	return nil
+}
+
+func (w *socketWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// splitLines groups whole lines into chunks of at most size bytes.
+func splitLines(lines string, size int) []string {
+	var chunks []string
+	for len(lines) > 0 {
+		end := len(lines)
+		if end > size {
+			end = strings.LastIndexByte(lines[:size], '\n') + 1
+			if end == 0 {
+				end = strings.IndexByte(lines, '\n') + 1
+				if end == 0 {
+					end = len(lines)
+				}
+			}
+		}
+		chunks = append(chunks, lines[:end])
+		lines = lines[end:]
+	}
+	return chunks
+}
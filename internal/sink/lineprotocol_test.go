@@ -0,0 +1,246 @@
+package sink
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"gama-client/internal/appconfig"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testTime = time.Unix(1700000000, 123456789)
+
+func TestLineProtocolEscaping(t *testing.T) {
+	point := Point{
+		Measurement: "disk status,raw",
+		Tags: map[string]string{
+			"device":     `\\.\PHYSICALDRIVE0`,
+			"model name": "WD,Red=4TB",
+			"level":      "",
+		},
+		Fields: map[string]interface{}{
+			"condition": `Member "sdb1" marked as failed in C:\raid`,
+			"status":    1,
+			"raw":       int64(1607730335744),
+			"progress":  12.5,
+			"spare":     true,
+		},
+		Time: testTime,
+	}
+	// Backslashes are only escapes before a comma, an equals sign or a space
+	// in tags, so the Windows device path is written as is.
+	want := `disk\ status\,raw,device=\\.\PHYSICALDRIVE0,model\ name=WD\,Red\=4TB ` +
+		`condition="Member \"sdb1\" marked as failed in C:\\raid",progress=12.5,raw=1607730335744i,spare=true,status=1i ` +
+		"1700000000123456789\n"
+	if got := LineProtocol([]Point{point}, time.Nanosecond); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestLineProtocolPrecision(t *testing.T) {
+	points := []Point{
+		{Measurement: "disk", Tags: map[string]string{"device": "/dev/sda"}, Fields: map[string]interface{}{"status": 0}, Time: testTime},
+		{Measurement: "disk", Tags: map[string]string{"device": "/dev/sdb"}, Fields: map[string]interface{}{"status": 2}, Time: testTime},
+	}
+	tests := map[time.Duration]string{
+		time.Nanosecond:  "1700000000123456789",
+		time.Microsecond: "1700000000123456",
+		time.Millisecond: "1700000000123",
+		time.Second:      "1700000000",
+	}
+	for precision, timestamp := range tests {
+		want := "disk,device=/dev/sda status=0i " + timestamp + "\ndisk,device=/dev/sdb status=2i " + timestamp + "\n"
+		if got := LineProtocol(points, precision); got != want {
+			t.Errorf("%s: got %q, want %q", precision, got, want)
+		}
+	}
+}
+
+func TestConvertPrecision(t *testing.T) {
+	lines := "disk,device=/dev/sda status=0i 1700000000123456789\n" +
+		`disk,device=/dev/sdb condition="failed at 1700000000" 1700000000123456789` + "\n" +
+		"disk,device=/dev/sdc status=1i\n"
+	want := "disk,device=/dev/sda status=0i 1700000000123\n" +
+		`disk,device=/dev/sdb condition="failed at 1700000000" 1700000000123` + "\n" +
+		"disk,device=/dev/sdc status=1i\n"
+	if got := convertPrecision(lines, time.Millisecond); got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+	if got := convertPrecision(lines, time.Nanosecond); got != lines {
+		t.Errorf("got %q at nanosecond precision", got)
+	}
+	for precision := range influxPrecisions {
+		points := testBatch().Points
+		if got, want := convertPrecision(LineProtocol(points, time.Nanosecond), influxPrecisions[precision]), LineProtocol(points, influxPrecisions[precision]); got != want {
+			t.Errorf("%s: got %q, want %q", precision, got, want)
+		}
+	}
+}
+
+func TestSplitLines(t *testing.T) {
+	lines := "aaaa\nbbbb\ncccccccccccc\ndd\n"
+	want := []string{"aaaa\nbbbb\n", "cccccccccccc\n", "dd\n"}
+	got := splitLines(lines, 10)
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := splitLines("", 10); got != nil {
+		t.Errorf("got %q for no lines", got)
+	}
+}
+
+func testBatch() Batch {
+	return Batch{Time: testTime, Points: []Point{
+		{Measurement: "disk", Tags: map[string]string{"device": "/dev/sda", "host": "web1"}, Fields: map[string]interface{}{"status": 1}, Time: testTime},
+	}}
+}
+
+const testBatchLine = "disk,device=/dev/sda,host=web1 status=1i 1700000000123456789\n"
+
+func TestLineProtocolSinkUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	output, err := NewLineProtocolSink(appconfig.SinkConfig{Name: "telegraf", LineProtocolConfig: appconfig.LineProtocolConfig{Address: "udp://" + conn.LocalAddr().String()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+	if err := output.Write(context.Background(), testBatch()); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buffer := make([]byte, udpPayloadSize)
+	n, _, err := conn.ReadFrom(buffer)
+	if err != nil {
+		t.Fatalf("no datagram received: %v", err)
+	}
+	if got := string(buffer[:n]); got != testBatchLine {
+		t.Errorf("got %q, want %q", got, testBatchLine)
+	}
+}
+
+func TestLineProtocolSinkTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		received <- line
+	}()
+
+	output, err := NewLineProtocolSink(appconfig.SinkConfig{Name: "telegraf", LineProtocolConfig: appconfig.LineProtocolConfig{Address: "tcp://" + listener.Addr().String()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+	if err := output.Write(context.Background(), testBatch()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case line := <-received:
+		if line != testBatchLine {
+			t.Errorf("got %q, want %q", line, testBatchLine)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no line received")
+	}
+}
+
+func TestInfluxV1Sink(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	config := appconfig.SinkConfig{
+		Name:           "influx18",
+		InfluxConfig:   appconfig.InfluxConfig{InfluxURL: server.URL + "/", InfluxOptions: appconfig.InfluxOptions{Precision: appconfig.PrecisionSeconds}},
+		InfluxV1Config: appconfig.InfluxV1Config{InfluxDatabase: "disks", InfluxRetentionPolicy: "weekly", InfluxUsername: "agent", InfluxPassword: "secret"},
+	}
+	output, err := NewInfluxV1Sink(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+	if err := output.Write(context.Background(), testBatch()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case request := <-received:
+		query := request.URL.Query()
+		if request.URL.Path != "/write" || query.Get("db") != "disks" || query.Get("rp") != "weekly" || query.Get("precision") != "s" {
+			t.Errorf("got %s", request.URL)
+		}
+		if username, password, ok := request.BasicAuth(); !ok || username != "agent" || password != "secret" {
+			t.Errorf("got basic auth %q %q %v", username, password, ok)
+		}
+		if body := <-bodies; body != "disk,device=/dev/sda,host=web1 status=1i 1700000000\n" {
+			t.Errorf("got body %q", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no write received")
+	}
+}
+
+func TestInfluxV1SinkGzip(t *testing.T) {
+	bodies := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+		reader, err := gzip.NewReader(r.Body)
+		if err == nil {
+			body, err = io.ReadAll(reader)
+		}
+		if r.Header.Get("Content-Encoding") != "gzip" || err != nil {
+			t.Errorf("got Content-Encoding %q: %v", r.Header.Get("Content-Encoding"), err)
+		}
+		bodies <- string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	config := appconfig.SinkConfig{
+		Name:           "influx18",
+		InfluxConfig:   appconfig.InfluxConfig{InfluxURL: server.URL, InfluxOptions: appconfig.InfluxOptions{Gzip: true}},
+		InfluxV1Config: appconfig.InfluxV1Config{InfluxDatabase: "disks"},
+	}
+	output, err := NewInfluxV1Sink(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+	if err := output.Write(context.Background(), testBatch()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case body := <-bodies:
+		if body != testBatchLine {
+			t.Errorf("got body %q, want %q", body, testBatchLine)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no write received")
+	}
+}
@@ -0,0 +1,150 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gama-client/internal/appconfig"
+	"gama-client/internal/diskinfo"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/sirupsen/logrus"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	mqttPublishTimeout    = 10 * time.Second
+	mqttDisconnectQuiesce = 250 // milliseconds
+	mqttOnline            = "online"
+	mqttOffline           = "offline"
+)
+
+// MQTTSink publishes the state of every disk as JSON to
+// <prefix>/<host>/<disk_id>/state. The availability of the agent is published
+// to <prefix>/<host>/status: online when connected, and offline as the last
+// will when the connection is lost or the agent stops.
+type MQTTSink struct {
+	name   string
+	client mqtt.Client
+	prefix string
+	qos    byte
+	retain bool
+}
+
+// mqttDiskState is the payload of a disk state message.
+type mqttDiskState struct {
+	Device            string    `json:"device"`
+	Status            string    `json:"status"`
+	StatusCode        int       `json:"status_code"`
+	Condition         string    `json:"condition"`
+	Temperature       *int      `json:"temperature,omitempty"`
+	TemperatureSource string    `json:"temperature_source,omitempty"`
+	Host              string    `json:"host"`
+	Client            string    `json:"client"`
+	Time              time.Time `json:"time"`
+}
+
+func NewMQTTSink(config appconfig.SinkConfig, tags appconfig.InfluxTagsConfig) (*MQTTSink, error) {
+	host := tags.Host
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+	sink := &MQTTSink{
+		name:   config.Name,
+		prefix: strings.TrimSuffix(config.MQTTTopicPrefix, "/") + "/" + diskinfo.DiskID(host),
+		qos:    *config.MQTTQoS,
+		retain: *config.MQTTRetain,
+	}
+	clientID := config.MQTTClientID
+	if clientID == "" {
+		clientID = "smp-" + diskinfo.DiskID(host)
+	}
+	options := mqtt.NewClientOptions().
+		AddBroker(config.MQTTBroker).
+		SetClientID(clientID).
+		SetUsername(config.MQTTUsername).
+		SetPassword(config.MQTTPassword).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetWill(sink.statusTopic(), mqttOffline, sink.qos, true).
+		SetOnConnectHandler(func(client mqtt.Client) {
+			logrus.Infof("Connected to MQTT broker %s", config.MQTTBroker)
+			client.Publish(sink.statusTopic(), sink.qos, true, mqttOnline)
+		}).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			logrus.Warnf("Lost connection to MQTT broker %s: %v", config.MQTTBroker, err)
+		})
+	if config.MQTTCAFile != "" || config.MQTTCertFile != "" || config.MQTTInsecureSkipVerify {
+		tlsConfig, err := newTLSConfig(config.MQTTCAFile, config.MQTTCertFile, config.MQTTKeyFile, config.MQTTInsecureSkipVerify)
+		if err != nil {
+			return nil, err
+		}
+		options.SetTLSConfig(tlsConfig)
+	}
+	sink.client = mqtt.NewClient(options)
+	// With ConnectRetry the client keeps connecting in the background, so an
+	// unreachable broker does not prevent the agent from starting.
+	sink.client.Connect()
+	return sink, nil
+}
+
+func (s *MQTTSink) Name() string {
+	return s.name
+}
+
+func (s *MQTTSink) statusTopic() string {
+	return s.prefix + "/status"
+}
+
+func (s *MQTTSink) Write(_ context.Context, batch Batch) error {
+	if !s.client.IsConnectionOpen() {
+		return fmt.Errorf("not connected to the MQTT broker")
+	}
+	var tokens []mqtt.Token
+	for _, disk := range batch.Disks {
+		state := mqttDiskState{
+			Device:     disk.DeviceName,
+			Status:     string(disk.Status),
+			StatusCode: disk.StatusToInt(),
+			Condition:  disk.Condition,
+			Host:       batch.Host,
+			Client:     batch.Client,
+			Time:       batch.Time,
+		}
+		if disk.TemperatureSource != "" {
+			temperature := disk.Temperature
+			state.Temperature = &temperature
+			state.TemperatureSource = disk.TemperatureSource
+		}
+		payload, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+		topic := s.prefix + "/" + diskinfo.DiskID(disk.DeviceName) + "/state"
+		tokens = append(tokens, s.client.Publish(topic, s.qos, s.retain, payload))
+	}
+	var errs []error
+	for _, token := range tokens {
+		if !token.WaitTimeout(mqttPublishTimeout) {
+			errs = append(errs, fmt.Errorf("publish timed out"))
+		} else if err := token.Error(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d disk states not published: %w", len(errs), len(tokens), errors.Join(errs...))
+	}
+	return nil
+}
+
+// Close marks the agent offline, as the last will is not sent on a clean
+// disconnect.
+func (s *MQTTSink) Close() error {
+	if s.client.IsConnectionOpen() {
+		s.client.Publish(s.statusTopic(), s.qos, true, mqttOffline).WaitTimeout(mqttPublishTimeout)
+	}
+	s.client.Disconnect(mqttDisconnectQuiesce)
+	return nil
+}
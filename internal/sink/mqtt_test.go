@@ -0,0 +1,135 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"gama-client/internal/appconfig"
+	"gama-client/internal/diskinfo"
+	server "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+)
+
+type mqttMessage struct {
+	topic   string
+	payload string
+}
+
+// startBroker runs an in-process broker and returns its address and the
+// messages published to the smp/ topics.
+func startBroker(t *testing.T) (string, *server.Server, <-chan mqttMessage) {
+	t.Helper()
+	broker := server.New(&server.Options{InlineClient: true, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err := broker.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+	listener := listeners.NewTCP(listeners.Config{ID: "test", Address: "127.0.0.1:0"})
+	if err := broker.AddListener(listener); err != nil {
+		t.Fatal(err)
+	}
+	messages := make(chan mqttMessage, 16)
+	err := broker.Subscribe("smp/#", 1, func(_ *server.Client, _ packets.Subscription, pk packets.Packet) {
+		messages <- mqttMessage{topic: pk.TopicName, payload: string(pk.Payload)}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := broker.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { broker.Close() })
+	return "tcp://" + listener.Address(), broker, messages
+}
+
+func expectMessage(t *testing.T, messages <-chan mqttMessage, topic string) string {
+	t.Helper()
+	select {
+	case message := <-messages:
+		if message.topic != topic {
+			t.Fatalf("got a message on %s, want %s", message.topic, topic)
+		}
+		return message.payload
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no message on %s", topic)
+	}
+	return ""
+}
+
+func mqttConfig(broker string) appconfig.SinkConfig {
+	qos, retain := byte(1), true
+	return appconfig.SinkConfig{Name: "mqtt", MQTTConfig: appconfig.MQTTConfig{
+		MQTTBroker:      broker,
+		MQTTTopicPrefix: "smp/",
+		MQTTQoS:         &qos,
+		MQTTRetain:      &retain,
+	}}
+}
+
+func TestMQTTSinkPublishesDiskStates(t *testing.T) {
+	address, broker, messages := startBroker(t)
+	output, err := NewMQTTSink(mqttConfig(address), appconfig.InfluxTagsConfig{Host: "web1", Client: "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload := expectMessage(t, messages, "smp/web1/status"); payload != mqttOnline {
+		t.Errorf("got status %q", payload)
+	}
+
+	batch := Batch{Time: testTime, Host: "web1", Client: "acme", Disks: []diskinfo.DiskInfo{
+		{Status: diskinfo.StatusWarning, Check: diskinfo.CheckTemperature, Condition: "Temperature exceeds 70°C", DeviceName: "/dev/sda", Temperature: 72, TemperatureSource: diskinfo.TemperatureSourceSMART},
+		{Status: diskinfo.StatusSafe, Check: diskinfo.CheckOK, Condition: "All checks passed", DeviceName: `\\.\PHYSICALDRIVE1`},
+	}}
+	if err := output.Write(context.Background(), batch); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	var state map[string]interface{}
+	if err := json.Unmarshal([]byte(expectMessage(t, messages, "smp/web1/sda/state")), &state); err != nil {
+		t.Fatal(err)
+	}
+	if state["device"] != "/dev/sda" || state["status"] != "Warning" || state["status_code"] != 1.0 || state["temperature"] != 72.0 ||
+		state["temperature_source"] != "smart" || state["host"] != "web1" || state["client"] != "acme" {
+		t.Errorf("got %v", state)
+	}
+	state = nil
+	if err := json.Unmarshal([]byte(expectMessage(t, messages, "smp/web1/PHYSICALDRIVE1/state")), &state); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := state["temperature"]; ok || state["status_code"] != 0.0 {
+		t.Errorf("got %v", state)
+	}
+	if retained := broker.Topics.Messages("smp/web1/+/state"); len(retained) != 2 {
+		t.Errorf("got %d retained disk states, want 2", len(retained))
+	}
+
+	if err := output.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if payload := expectMessage(t, messages, "smp/web1/status"); payload != mqttOffline {
+		t.Errorf("got status %q on close", payload)
+	}
+}
+
+func TestMQTTSinkWithoutBroker(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Nothing listens on the address once the listener is closed.
+	listener.Close()
+	output, err := NewMQTTSink(mqttConfig("tcp://"+listener.Addr().String()), appconfig.InfluxTagsConfig{Host: "web1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+	batch := Batch{Disks: []diskinfo.DiskInfo{{Status: diskinfo.StatusSafe, DeviceName: "/dev/sda"}}}
+	if err := output.Write(context.Background(), batch); err == nil {
+		t.Error("expected an error without a broker")
+	}
+}
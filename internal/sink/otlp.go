@@ -0,0 +1,410 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"gama-client/internal/appconfig"
+	"gama-client/internal/version"
+	"github.com/sirupsen/logrus"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	otlpScopeName = "gama-client"
+	otlpTimeout   = 20 * time.Second
+)
+
+// otlpCounters lists the fields exported as monotonic cumulative sums. Every
+// other numeric field is a gauge.
+var otlpCounters = map[string]map[string]bool{
+	"kernel_io_error":  {"count": true},
+	"disk_reliability": {"read_errors_total": true, "read_errors_uncorrected": true, "write_errors_total": true, "write_errors_uncorrected": true},
+	"zfs_pool":         {"read_errors": true, "write_errors": true, "checksum_errors": true},
+	"zfs_vdev":         {"read_errors": true, "write_errors": true, "checksum_errors": true},
+	"btrfs_device":     {"write_io_errs": true, "read_io_errs": true, "flush_io_errs": true, "corruption_errs": true, "generation_errs": true},
+	"sink_write":       {"written_batches": true, "written_points": true, "failed_batches": true, "failed_points": true, "dropped_batches": true, "dropped_points": true, "retries": true},
+}
+
+var otlpUnits = map[string]string{
+	"disk.temperature":            "Cel",
+	"disk_io.read_bytes_per_sec":  "By/s",
+	"disk_io.write_bytes_per_sec": "By/s",
+	"disk_io.read_await_ms":       "ms",
+	"disk_io.write_await_ms":      "ms",
+	"disk_io.await_ms":            "ms",
+	"disk_io.utilization_percent": "%",
+	"zfs_pool.size":               "By",
+	"zfs_pool.allocated":          "By",
+	"zfs_pool.free":               "By",
+	"zfs_pool.capacity":           "%",
+}
+
+// otlpExporter sends an export request over gRPC or HTTP/protobuf.
+type otlpExporter interface {
+	Export(ctx context.Context, request *colmetricpb.ExportMetricsServiceRequest) error
+	Close() error
+}
+
+// otlpExport is the export request of a collection and its number of points.
+type otlpExport struct {
+	request *colmetricpb.ExportMetricsServiceRequest
+	points  int
+}
+
+// OTLPSink exports the collections to an OpenTelemetry collector. Only the
+// latest collection waits to be exported: gauges are snapshots and counters
+// are cumulative, so skipping a cycle loses nothing.
+type OTLPSink struct {
+	name     string
+	exporter otlpExporter
+	policy   RetryPolicy
+	start    time.Time
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	pending chan otlpExport
+	done    chan struct{}
+
+	mu    sync.Mutex
+	stats WriteStats
+}
+
+func NewOTLPSink(config appconfig.SinkConfig) (*OTLPSink, error) {
+	var exporter otlpExporter
+	var err error
+	if config.OTLPProtocol == appconfig.OTLPProtocolHTTP {
+		exporter, err = newOTLPHTTPExporter(config.OTLPConfig)
+	} else {
+		exporter, err = newOTLPGRPCExporter(config.OTLPConfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sink := &OTLPSink{
+		name:     config.Name,
+		exporter: exporter,
+		policy:   DefaultRetryPolicy,
+		start:    time.Now(),
+		ctx:      ctx,
+		cancel:   cancel,
+		pending:  make(chan otlpExport, 1),
+		done:     make(chan struct{}),
+	}
+	go sink.run()
+	return sink, nil
+}
+
+func (s *OTLPSink) Name() string {
+	return s.name
+}
+
+// Write replaces the collection waiting to be exported, if any.
+func (s *OTLPSink) Write(_ context.Context, batch Batch) error {
+	export := otlpExport{request: s.exportRequest(batch), points: len(batch.Points)}
+	for {
+		select {
+		case s.pending <- export:
+			return nil
+		default:
+		}
+		select {
+		case dropped := <-s.pending:
+			s.record(func(stats *WriteStats) {
+				stats.DroppedBatches++
+				stats.DroppedPoints += int64(dropped.points)
+			})
+		default:
+		}
+	}
+}
+
+func (s *OTLPSink) run() {
+	defer close(s.done)
+	for export := range s.pending {
+		attempts, err := s.policy.Do(s.ctx, func() error {
+			ctx, cancel := context.WithTimeout(s.ctx, otlpTimeout)
+			defer cancel()
+			return s.exporter.Export(ctx, export.request)
+		})
+		s.record(func(stats *WriteStats) {
+			stats.Retries += int64(attempts - 1)
+			if err != nil {
+				stats.FailedBatches++
+				stats.FailedPoints += int64(export.points)
+				stats.LastError = err.Error()
+				return
+			}
+			stats.WrittenBatches++
+			stats.WrittenPoints += int64(export.points)
+			stats.LastSuccess = time.Now()
+		})
+		if err != nil {
+			logrus.Errorf("Error exporting metrics to %s after %d attempts: %v", s.name, attempts, err)
+		}
+	}
+}
+
+func (s *OTLPSink) record(update func(stats *WriteStats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update(&s.stats)
+}
+
+func (s *OTLPSink) Stats() WriteStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	stats.Queued = len(s.pending)
+	return stats
+}
+
+func (s *OTLPSink) Close() error {
+	close(s.pending)
+	select {
+	case <-s.done:
+	case <-time.After(influxCloseTimeout):
+		s.cancel()
+		<-s.done
+	}
+	s.cancel()
+	return s.exporter.Close()
+}
+
+// exportRequest converts the points of a batch into metrics named
+// smp.<measurement>.<field>. The host and client are resource attributes and
+// the other tags are data point attributes. String fields are skipped.
+func (s *OTLPSink) exportRequest(batch Batch) *colmetricpb.ExportMetricsServiceRequest {
+	metrics := make(map[string]*metricpb.Metric)
+	for _, point := range batch.Points {
+		attributes := otlpAttributes(point.Tags)
+		timestamp := uint64(point.Time.UnixNano())
+		for field, value := range point.Fields {
+			dataPoint := &metricpb.NumberDataPoint{Attributes: attributes, TimeUnixNano: timestamp}
+			if !setOTLPValue(dataPoint, value) {
+				continue
+			}
+			key := point.Measurement + "." + field
+			metric := metrics[key]
+			if metric == nil {
+				metric = s.newMetric(point.Measurement, field)
+				metrics[key] = metric
+			}
+			if sum := metric.GetSum(); sum != nil {
+				dataPoint.StartTimeUnixNano = uint64(s.start.UnixNano())
+				sum.DataPoints = append(sum.DataPoints, dataPoint)
+			} else {
+				metric.GetGauge().DataPoints = append(metric.GetGauge().DataPoints, dataPoint)
+			}
+		}
+	}
+	up := &metricpb.Metric{Name: "smp.collector.up", Unit: "1", Data: &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{}}}
+	for _, collector := range batch.Collectors {
+		var value int64 = 1
+		if collector.Error != nil {
+			value = 0
+		}
+		up.GetGauge().DataPoints = append(up.GetGauge().DataPoints, &metricpb.NumberDataPoint{
+			Attributes:   otlpAttributes(map[string]string{"collector": collector.Name}),
+			TimeUnixNano: uint64(batch.Time.UnixNano()),
+			Value:        &metricpb.NumberDataPoint_AsInt{AsInt: value},
+		})
+	}
+	if len(up.GetGauge().DataPoints) > 0 {
+		metrics[up.Name] = up
+	}
+
+	sorted := make([]*metricpb.Metric, 0, len(metrics))
+	for _, metric := range metrics {
+		sorted = append(sorted, metric)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return &colmetricpb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricpb.ResourceMetrics{{
+			Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+				stringAttribute("service.name", "gama-client"),
+				stringAttribute("service.version", version.Version),
+				stringAttribute("host.name", batch.Host),
+				stringAttribute("smp.client", batch.Client),
+			}},
+			ScopeMetrics: []*metricpb.ScopeMetrics{{
+				Scope:   &commonpb.InstrumentationScope{Name: otlpScopeName, Version: version.Version},
+				Metrics: sorted,
+			}},
+		}},
+	}
+}
+
+func (s *OTLPSink) newMetric(measurement, field string) *metricpb.Metric {
+	metric := &metricpb.Metric{
+		Name: "smp." + measurement + "." + field,
+		Unit: otlpUnits[measurement+"."+field],
+	}
+	if otlpCounters[measurement][field] {
+		metric.Data = &metricpb.Metric_Sum{Sum: &metricpb.Sum{
+			AggregationTemporality: metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			IsMonotonic:            true,
+		}}
+	} else {
+		metric.Data = &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{}}
+	}
+	return metric
+}
+
+func setOTLPValue(dataPoint *metricpb.NumberDataPoint, value interface{}) bool {
+	switch v := value.(type) {
+	case int:
+		dataPoint.Value = &metricpb.NumberDataPoint_AsInt{AsInt: int64(v)}
+	case int64:
+		dataPoint.Value = &metricpb.NumberDataPoint_AsInt{AsInt: v}
+	case uint64:
+		dataPoint.Value = &metricpb.NumberDataPoint_AsInt{AsInt: int64(v)}
+	case float64:
+		dataPoint.Value = &metricpb.NumberDataPoint_AsDouble{AsDouble: v}
+	case bool:
+		var n int64
+		if v {
+			n = 1
+		}
+		dataPoint.Value = &metricpb.NumberDataPoint_AsInt{AsInt: n}
+	default:
+		return false
+	}
+	return true
+}
+
+func otlpAttributes(tags map[string]string) []*commonpb.KeyValue {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		if key != "host" && key != "client" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	attributes := make([]*commonpb.KeyValue, len(keys))
+	for i, key := range keys {
+		attributes[i] = stringAttribute(key, tags[key])
+	}
+	return attributes
+}
+
+func stringAttribute(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+type otlpGRPCExporter struct {
+	conn    *grpc.ClientConn
+	client  colmetricpb.MetricsServiceClient
+	headers metadata.MD
+}
+
+func newOTLPGRPCExporter(config appconfig.OTLPConfig) (*otlpGRPCExporter, error) {
+	target := config.OTLPEndpoint
+	creds := credentials.NewTLS(&tls.Config{})
+	switch {
+	case strings.HasPrefix(target, "http://"):
+		target = strings.TrimPrefix(target, "http://")
+		creds = insecure.NewCredentials()
+	case strings.HasPrefix(target, "https://"):
+		target = strings.TrimPrefix(target, "https://")
+	case config.OTLPInsecure:
+		creds = insecure.NewCredentials()
+	}
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP gRPC client: %w", err)
+	}
+	return &otlpGRPCExporter{
+		conn:    conn,
+		client:  colmetricpb.NewMetricsServiceClient(conn),
+		headers: metadata.New(config.OTLPHeaders),
+	}, nil
+}
+
+func (e *otlpGRPCExporter) Export(ctx context.Context, request *colmetricpb.ExportMetricsServiceRequest) error {
+	ctx = metadata.NewOutgoingContext(ctx, e.headers)
+	response, err := e.client.Export(ctx, request)
+	if err != nil {
+		switch status.Code(err) {
+		case codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded, codes.Aborted:
+			return &RetryableError{Err: err}
+		}
+		return err
+	}
+	if rejected := response.GetPartialSuccess().GetRejectedDataPoints(); rejected > 0 {
+		logrus.Warnf("OTLP collector rejected %d data points: %s", rejected, response.GetPartialSuccess().GetErrorMessage())
+	}
+	return nil
+}
+
+func (e *otlpGRPCExporter) Close() error {
+	return e.conn.Close()
+}
+
+type otlpHTTPExporter struct {
+	client  *http.Client
+	url     string
+	headers map[string]string
+}
+
+func newOTLPHTTPExporter(config appconfig.OTLPConfig) (*otlpHTTPExporter, error) {
+	endpoint, err := url.Parse(config.OTLPEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid otlp_endpoint: %w", err)
+	}
+	if endpoint.Path == "" || endpoint.Path == "/" {
+		endpoint.Path = "/v1/metrics"
+	}
+	return &otlpHTTPExporter{
+		client:  &http.Client{Timeout: otlpTimeout},
+		url:     endpoint.String(),
+		headers: config.OTLPHeaders,
+	}, nil
+}
+
+func (e *otlpHTTPExporter) Export(ctx context.Context, request *colmetricpb.ExportMetricsServiceRequest) error {
+	body, err := proto.Marshal(request)
+	if err != nil {
+		return err
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpRequest.Header.Set("Content-Type", "application/x-protobuf")
+	for key, value := range e.headers {
+		httpRequest.Header.Set(key, value)
+	}
+	response, err := e.client.Do(httpRequest)
+	if err != nil {
+		return &RetryableError{Err: err}
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return ResponseError(response)
+	}
+	return nil
+}
+
+func (e *otlpHTTPExporter) Close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,228 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"gama-client/internal/appconfig"
+	"gama-client/internal/version"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func otlpBatch() Batch {
+	tags := map[string]string{"device": "/dev/sda", "host": "web1", "client": "acme"}
+	return Batch{
+		Time:   testTime,
+		Host:   "web1",
+		Client: "acme",
+		Points: []Point{
+			{Measurement: "disk", Tags: tags, Time: testTime, Fields: map[string]interface{}{
+				"temperature": 41, "condition": "All checks passed", "smart_passed": true,
+			}},
+			{Measurement: "disk_reliability", Tags: tags, Time: testTime, Fields: map[string]interface{}{
+				"read_errors_total": int64(12), "write_errors_total": int64(3), "power_on_hours": 8760,
+			}},
+			{Measurement: "disk_io", Tags: tags, Time: testTime, Fields: map[string]interface{}{
+				"utilization_percent": 12.5, "reads": uint64(1) << 40,
+			}},
+		},
+		Collectors: []CollectorStatus{{Name: "smart"}, {Name: "zfs", Error: errors.New("zpool not found")}},
+	}
+}
+
+func attributes(keyValues []*commonpb.KeyValue) map[string]string {
+	values := make(map[string]string, len(keyValues))
+	for _, keyValue := range keyValues {
+		values[keyValue.Key] = keyValue.Value.GetStringValue()
+	}
+	return values
+}
+
+// checkOTLPRequest checks the export request of otlpBatch.
+func checkOTLPRequest(t *testing.T, request *colmetricpb.ExportMetricsServiceRequest, start time.Time) {
+	t.Helper()
+	if len(request.ResourceMetrics) != 1 || len(request.ResourceMetrics[0].ScopeMetrics) != 1 {
+		t.Fatalf("got %v", request)
+	}
+	resource := attributes(request.ResourceMetrics[0].Resource.Attributes)
+	if resource["service.name"] != "gama-client" || resource["service.version"] != version.Version ||
+		resource["host.name"] != "web1" || resource["smp.client"] != "acme" {
+		t.Errorf("got resource %v", resource)
+	}
+	scope := request.ResourceMetrics[0].ScopeMetrics[0]
+	if scope.Scope.Name != otlpScopeName || scope.Scope.Version != version.Version {
+		t.Errorf("got scope %v", scope.Scope)
+	}
+
+	var names []string
+	metrics := make(map[string]*metricpb.Metric)
+	for _, metric := range scope.Metrics {
+		names = append(names, metric.Name)
+		metrics[metric.Name] = metric
+	}
+	want := []string{
+		"smp.collector.up", "smp.disk.smart_passed", "smp.disk.temperature", "smp.disk_io.reads", "smp.disk_io.utilization_percent",
+		"smp.disk_reliability.power_on_hours", "smp.disk_reliability.read_errors_total", "smp.disk_reliability.write_errors_total",
+	}
+	if !equalStrings(names, want) {
+		t.Fatalf("got metrics %q, want %q", names, want)
+	}
+
+	for _, name := range []string{"smp.disk_reliability.read_errors_total", "smp.disk_reliability.write_errors_total"} {
+		sum := metrics[name].GetSum()
+		if sum == nil || !sum.IsMonotonic || sum.AggregationTemporality != metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+			t.Fatalf("%s: got %v, want a monotonic cumulative sum", name, metrics[name])
+		}
+		point := sum.DataPoints[0]
+		if point.StartTimeUnixNano != uint64(start.UnixNano()) || point.TimeUnixNano != uint64(testTime.UnixNano()) {
+			t.Errorf("%s: got start %d and time %d", name, point.StartTimeUnixNano, point.TimeUnixNano)
+		}
+	}
+	if point := metrics["smp.disk_reliability.read_errors_total"].GetSum().DataPoints[0]; point.GetAsInt() != 12 {
+		t.Errorf("got read errors %v", point)
+	}
+
+	gauges := map[string]*metricpb.NumberDataPoint{}
+	for _, name := range []string{"smp.disk.temperature", "smp.disk.smart_passed", "smp.disk_io.reads", "smp.disk_io.utilization_percent", "smp.disk_reliability.power_on_hours"} {
+		gauge := metrics[name].GetGauge()
+		if gauge == nil || len(gauge.DataPoints) != 1 {
+			t.Fatalf("%s: got %v, want a gauge", name, metrics[name])
+		}
+		gauges[name] = gauge.DataPoints[0]
+	}
+	temperature := gauges["smp.disk.temperature"]
+	if temperature.GetAsInt() != 41 || metrics["smp.disk.temperature"].Unit != "Cel" {
+		t.Errorf("got temperature %v in %q", temperature, metrics["smp.disk.temperature"].Unit)
+	}
+	if labels := attributes(temperature.Attributes); len(labels) != 1 || labels["device"] != "/dev/sda" {
+		t.Errorf("got attributes %v, want the device only", labels)
+	}
+	if gauges["smp.disk.smart_passed"].GetAsInt() != 1 || gauges["smp.disk_io.reads"].GetAsInt() != 1<<40 ||
+		gauges["smp.disk_io.utilization_percent"].GetAsDouble() != 12.5 {
+		t.Errorf("got %v", gauges)
+	}
+
+	up := metrics["smp.collector.up"].GetGauge()
+	if up == nil || len(up.DataPoints) != 2 {
+		t.Fatalf("got %v", metrics["smp.collector.up"])
+	}
+	for _, point := range up.DataPoints {
+		collector := attributes(point.Attributes)["collector"]
+		if want := map[string]int64{"smart": 1, "zfs": 0}[collector]; point.GetAsInt() != want {
+			t.Errorf("collector %s: got up %d, want %d", collector, point.GetAsInt(), want)
+		}
+	}
+}
+
+func equalStrings(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestOTLPExportRequest(t *testing.T) {
+	output := &OTLPSink{start: testTime.Add(-time.Hour)}
+	checkOTLPRequest(t, output.exportRequest(otlpBatch()), output.start)
+}
+
+// metricsServer records the requests and the metadata of a gRPC export.
+type metricsServer struct {
+	colmetricpb.UnimplementedMetricsServiceServer
+	requests chan *colmetricpb.ExportMetricsServiceRequest
+	metadata chan metadata.MD
+}
+
+func (s *metricsServer) Export(ctx context.Context, request *colmetricpb.ExportMetricsServiceRequest) (*colmetricpb.ExportMetricsServiceResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.metadata <- md
+	s.requests <- request
+	return &colmetricpb.ExportMetricsServiceResponse{}, nil
+}
+
+func TestOTLPSinkGRPC(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	received := &metricsServer{requests: make(chan *colmetricpb.ExportMetricsServiceRequest, 1), metadata: make(chan metadata.MD, 1)}
+	colmetricpb.RegisterMetricsServiceServer(server, received)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	output, err := NewOTLPSink(appconfig.SinkConfig{Name: "otel", OTLPConfig: appconfig.OTLPConfig{
+		OTLPEndpoint: "http://" + listener.Addr().String(),
+		OTLPProtocol: appconfig.OTLPProtocolGRPC,
+		OTLPHeaders:  map[string]string{"authorization": "Bearer secret"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+	if err := output.Write(context.Background(), otlpBatch()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case request := <-received.requests:
+		if md := <-received.metadata; len(md.Get("authorization")) != 1 || md.Get("authorization")[0] != "Bearer secret" {
+			t.Errorf("got metadata %v", md)
+		}
+		checkOTLPRequest(t, request, output.start)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no export received")
+	}
+}
+
+func TestOTLPSinkHTTP(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- r
+		bodies <- body
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}))
+	defer server.Close()
+
+	output, err := NewOTLPSink(appconfig.SinkConfig{Name: "otel", OTLPConfig: appconfig.OTLPConfig{
+		OTLPEndpoint: server.URL,
+		OTLPProtocol: appconfig.OTLPProtocolHTTP,
+		OTLPHeaders:  map[string]string{"Authorization": "Bearer secret"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+	if err := output.Write(context.Background(), otlpBatch()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case request := <-requests:
+		if request.URL.Path != "/v1/metrics" || request.Header.Get("Content-Type") != "application/x-protobuf" || request.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("got %s with %v", request.URL.Path, request.Header)
+		}
+		var export colmetricpb.ExportMetricsServiceRequest
+		if err := proto.Unmarshal(<-bodies, &export); err != nil {
+			t.Fatal(err)
+		}
+		checkOTLPRequest(t, &export, output.start)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no export received")
+	}
+}
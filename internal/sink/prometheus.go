@@ -0,0 +1,180 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gama-client/internal/appconfig"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const metricPrefix = "smp_"
+
+// PrometheusSink serves the latest collection in the Prometheus text
+// exposition format. Scrapes only read the cached batch, they never trigger a
+// collection.
+type PrometheusSink struct {
+	name   string
+	server *http.Server
+
+	mu    sync.RWMutex
+	batch *Batch
+}
+
+func NewPrometheusSink(config appconfig.SinkConfig) (*PrometheusSink, error) {
+	listener, err := net.Listen("tcp", config.ListenAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", config.ListenAddress, err)
+	}
+	sink := &PrometheusSink{name: config.Name}
+	mux := http.NewServeMux()
+	mux.HandleFunc(config.MetricsPath, sink.serveMetrics)
+	sink.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := sink.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.Errorf("Prometheus exporter %s stopped: %v", config.Name, err)
+		}
+	}()
+	logrus.Infof("Serving Prometheus metrics on %s%s", config.ListenAddress, config.MetricsPath)
+	return sink, nil
+}
+
+func (s *PrometheusSink) Name() string {
+	return s.name
+}
+
+func (s *PrometheusSink) Write(_ context.Context, batch Batch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batch = &batch
+	return nil
+}
+
+func (s *PrometheusSink) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+func (s *PrometheusSink) serveMetrics(w http.ResponseWriter, _ *http.Request) {
+	s.mu.RLock()
+	batch := s.batch
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if batch == nil {
+		fmt.Fprintf(w, "# No collection yet\n")
+		return
+	}
+	WritePrometheus(w, *batch)
+}
+
+type sample struct {
+	labels string
+	value  float64
+}
+
+// WritePrometheus renders a batch. Every numeric field of a point becomes the
+// gauge smp_<measurement>_<field> labelled with the point tags; string fields
+// are skipped. Collector health is exported as smp_collector_up.
+func WritePrometheus(w io.Writer, batch Batch) {
+	families := make(map[string][]sample)
+	for _, point := range batch.Points {
+		labels := formatLabels(point.Tags)
+		for field, value := range point.Fields {
+			number, ok := numericValue(value)
+			if !ok {
+				continue
+			}
+			name := metricName(point.Measurement + "_" + field)
+			families[name] = append(families[name], sample{labels: labels, value: number})
+		}
+	}
+	agentLabels := map[string]string{"host": batch.Host, "client": batch.Client}
+	for _, collector := range batch.Collectors {
+		up := 1.0
+		if collector.Error != nil {
+			up = 0
+		}
+		labels := map[string]string{"host": batch.Host, "client": batch.Client, "collector": collector.Name}
+		families[metricPrefix+"collector_up"] = append(families[metricPrefix+"collector_up"], sample{labels: formatLabels(labels), value: up})
+	}
+	families[metricPrefix+"last_collection_timestamp_seconds"] = []sample{{
+		labels: formatLabels(agentLabels),
+		value:  float64(batch.Time.UnixNano()) / 1e9,
+	}}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		samples := families[name]
+		sort.Slice(samples, func(i, j int) bool { return samples[i].labels < samples[j].labels })
+		fmt.Fprintf(w, "# TYPE %s gauge\n", name)
+		for _, sample := range samples {
+			fmt.Fprintf(w, "%s%s %v\n", name, sample.labels, sample.value)
+		}
+	}
+}
+
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func metricName(name string) string {
+	return metricPrefix + sanitizeName(name)
+}
+
+func sanitizeName(name string) string {
+	var builder strings.Builder
+	for i, r := range name {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9' && i > 0) {
+			builder.WriteRune(r)
+		} else {
+			builder.WriteByte('_')
+		}
+	}
+	return builder.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprintf(`%s="%s"`, sanitizeName(key), labelEscaper.Replace(tags[key]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
@@ -0,0 +1,70 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func prometheusBatch() Batch {
+	return Batch{
+		Time:   testTime,
+		Host:   "web1",
+		Client: "acme",
+		Points: []Point{
+			{Measurement: "disk", Tags: map[string]string{"device": "/dev/sdb", "host": "web1"}, Time: testTime, Fields: map[string]interface{}{
+				"temperature": 43, "smart_passed": false, "condition": "Reallocated sectors", "reads": uint64(1) << 40,
+			}},
+			{Measurement: "disk", Tags: map[string]string{"device": "/dev/sda", "host": "web1"}, Time: testTime, Fields: map[string]interface{}{
+				"temperature": 38, "smart_passed": true, "condition": "All checks passed", "reads": uint64(42),
+			}},
+			{Measurement: "disk_io", Tags: map[string]string{"device": "/dev/sda", "model": "Disk \"Pro\" \\ 1TB\nrev2"}, Time: testTime, Fields: map[string]interface{}{
+				"utilization_percent": 12.5, "read_bytes": int64(4096),
+			}},
+			{Measurement: "1wire", Tags: map[string]string{"0sensor": "28-01", "bus-id": "w1"}, Time: testTime, Fields: map[string]interface{}{
+				"temperature": 21.25,
+			}},
+		},
+		Collectors: []CollectorStatus{{Name: "zfs", Error: errors.New("zpool not found")}, {Name: "smart"}},
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	want, err := os.ReadFile(filepath.Join("testdata", "prometheus.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got strings.Builder
+	WritePrometheus(&got, prometheusBatch())
+	if got.String() != string(want) {
+		t.Errorf("got\n%s\nwant\n%s", got.String(), want)
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	output := &PrometheusSink{name: "prometheus"}
+	recorder := httptest.NewRecorder()
+	output.serveMetrics(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if body := recorder.Body.String(); body != "# No collection yet\n" {
+		t.Errorf("got %q before the first collection", body)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("got Content-Type %q", contentType)
+	}
+
+	if err := output.Write(context.Background(), prometheusBatch()); err != nil {
+		t.Fatal(err)
+	}
+	recorder = httptest.NewRecorder()
+	output.serveMetrics(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	var want strings.Builder
+	WritePrometheus(&want, prometheusBatch())
+	if body := recorder.Body.String(); body != want.String() {
+		t.Errorf("got %q, want %q", body, want.String())
+	}
+}
@@ -0,0 +1,103 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy bounds the attempts made to deliver a batch. The delay doubles
+// after every failure, up to MaxInterval, unless the server asked for a longer
+// one.
+type RetryPolicy struct {
+	MaxAttempts     int
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	// MaxRetryAfter is the longest Retry-After that is waited for; the batch
+	// fails if the server asks for more.
+	MaxRetryAfter time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:     5,
+	InitialInterval: time.Second,
+	MaxInterval:     30 * time.Second,
+	MaxRetryAfter:   5 * time.Minute,
+}
+
+// RetryableError marks a failure that may succeed later, with the delay the
+// server asked for, if any.
+type RetryableError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryableError) Unwrap() error {
+	return e.Err
+}
+
+// Do calls fn until it succeeds, returns an error that is not a
+// RetryableError, or the attempts are exhausted. It returns the number of
+// attempts made.
+func (p RetryPolicy) Do(ctx context.Context, fn func() error) (int, error) {
+	interval := p.InitialInterval
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		var retryable *RetryableError
+		if err == nil || !errors.As(err, &retryable) || attempt >= p.MaxAttempts {
+			return attempt, err
+		}
+		delay := interval + time.Duration(rand.Int63n(int64(interval)/2+1))
+		if retryable.RetryAfter > 0 {
+			if retryable.RetryAfter > p.MaxRetryAfter {
+				return attempt, fmt.Errorf("server asked to retry after %v: %w", retryable.RetryAfter, err)
+			}
+			delay = retryable.RetryAfter
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, err
+		case <-timer.C:
+		}
+		interval = min(interval*2, p.MaxInterval)
+	}
+}
+
+// ResponseError turns a failed HTTP response into an error including the start
+// of its body. 429 and 5xx responses are retryable, with the delay of their
+// Retry-After header.
+func ResponseError(response *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+	err := fmt.Errorf("unexpected status %s: %s", response.Status, strings.TrimSpace(string(body)))
+	if response.StatusCode != http.StatusTooManyRequests && response.StatusCode < 500 {
+		return err
+	}
+	return &RetryableError{Err: err, RetryAfter: parseRetryAfter(response.Header.Get("Retry-After"))}
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as an
+// HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
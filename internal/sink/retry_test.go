@@ -0,0 +1,137 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+var errUnavailable = errors.New("server unavailable")
+
+// attemptTimes calls Do with fn failing with err, and returns the number of
+// attempts, the delays between them and the error.
+func attemptTimes(ctx context.Context, policy RetryPolicy, err error) (int, []time.Duration, error) {
+	var times []time.Time
+	attempts, err := policy.Do(ctx, func() error {
+		times = append(times, time.Now())
+		return err
+	})
+	var delays []time.Duration
+	for i := 1; i < len(times); i++ {
+		delays = append(delays, times[i].Sub(times[i-1]))
+	}
+	return attempts, delays, err
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 6, InitialInterval: 20 * time.Millisecond, MaxInterval: 40 * time.Millisecond, MaxRetryAfter: time.Second}
+	attempts, delays, err := attemptTimes(context.Background(), policy, &RetryableError{Err: errUnavailable})
+	if attempts != 6 || !errors.Is(err, errUnavailable) {
+		t.Fatalf("got %d attempts and %v", attempts, err)
+	}
+	// The delay doubles up to MaxInterval, plus up to half of it as jitter.
+	for i, interval := range []time.Duration{20, 40, 40, 40, 40} {
+		interval *= time.Millisecond
+		if delays[i] < interval || delays[i] > interval*3/2+100*time.Millisecond {
+			t.Errorf("delay %d: got %v, want %v to %v", i, delays[i], interval, interval*3/2)
+		}
+	}
+}
+
+func TestRetryPolicyRetryAfter(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 2, InitialInterval: time.Millisecond, MaxInterval: time.Millisecond, MaxRetryAfter: 100 * time.Millisecond}
+	attempts, delays, _ := attemptTimes(context.Background(), policy, &RetryableError{Err: errUnavailable, RetryAfter: 50 * time.Millisecond})
+	if attempts != 2 || delays[0] < 50*time.Millisecond {
+		t.Errorf("got %d attempts, %v apart, want the Retry-After delay", attempts, delays)
+	}
+
+	// A longer Retry-After than MaxRetryAfter fails the batch at once.
+	attempts, _, err := attemptTimes(context.Background(), policy, &RetryableError{Err: errUnavailable, RetryAfter: time.Hour})
+	if attempts != 1 || !errors.Is(err, errUnavailable) || !strings.Contains(err.Error(), "retry after 1h0m0s") {
+		t.Errorf("got %d attempts and %v", attempts, err)
+	}
+}
+
+func TestRetryPolicyStopsOnPermanentError(t *testing.T) {
+	attempts, _, err := attemptTimes(context.Background(), DefaultRetryPolicy, errUnavailable)
+	if attempts != 1 || err != errUnavailable {
+		t.Errorf("got %d attempts and %v", attempts, err)
+	}
+	if attempts, _, err := attemptTimes(context.Background(), DefaultRetryPolicy, nil); attempts != 1 || err != nil {
+		t.Errorf("got %d attempts and %v", attempts, err)
+	}
+}
+
+func TestRetryPolicyStopsOnCancel(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, InitialInterval: time.Hour, MaxInterval: time.Hour, MaxRetryAfter: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	attempts, _, err := attemptTimes(ctx, policy, &RetryableError{Err: errUnavailable})
+	if attempts != 1 || !errors.Is(err, errUnavailable) || time.Since(start) > 5*time.Second {
+		t.Errorf("got %d attempts and %v after %v", attempts, err, time.Since(start))
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := map[string]time.Duration{
+		"":                              0,
+		"120":                           2 * time.Minute,
+		"0":                             0,
+		"-5":                            0,
+		"soon":                          0,
+		"Wed, 21 Oct 2015 07:28:00 GMT": 0,
+	}
+	for value, want := range tests {
+		if got := parseRetryAfter(value); got != want {
+			t.Errorf("%q: got %v, want %v", value, got, want)
+		}
+	}
+	date := time.Now().Add(90 * time.Second).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(date); got < 85*time.Second || got > 90*time.Second {
+		t.Errorf("%q: got %v, want about 90s", date, got)
+	}
+}
+
+func TestResponseError(t *testing.T) {
+	tests := []struct {
+		status     int
+		retryAfter string
+		retryable  bool
+		delay      time.Duration
+	}{
+		{status: http.StatusBadRequest},
+		{status: http.StatusUnauthorized},
+		{status: http.StatusNotFound},
+		{status: http.StatusTooManyRequests, retryAfter: "7", retryable: true, delay: 7 * time.Second},
+		{status: http.StatusInternalServerError, retryable: true},
+		{status: http.StatusServiceUnavailable, retryAfter: "30", retryable: true, delay: 30 * time.Second},
+	}
+	for _, test := range tests {
+		response := &http.Response{
+			StatusCode: test.status,
+			Status:     http.StatusText(test.status),
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader("  partial write: field type conflict\n")),
+		}
+		if test.retryAfter != "" {
+			response.Header.Set("Retry-After", test.retryAfter)
+		}
+		err := ResponseError(response)
+		if !strings.HasSuffix(err.Error(), ": partial write: field type conflict") {
+			t.Errorf("%d: got %q", test.status, err)
+		}
+		var retryable *RetryableError
+		if errors.As(err, &retryable) != test.retryable {
+			t.Errorf("%d: got retryable %v, want %v", test.status, !test.retryable, test.retryable)
+			continue
+		}
+		if test.retryable && retryable.RetryAfter != test.delay {
+			t.Errorf("%d: got Retry-After %v, want %v", test.status, retryable.RetryAfter, test.delay)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"gama-client/internal/appconfig"
+	"gama-client/internal/diskinfo"
+	"time"
+)
+
+// Point is a measurement of a collection cycle, independent of the format of
+// the output it is sent to.
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]interface{}
+	Time        time.Time
+}
+
+// CollectorStatus reports whether a collector succeeded in a cycle.
+type CollectorStatus struct {
+	Name  string
+	Error error
+}
+
+// Batch is everything collected in one cycle: the classified disks and the
+// points built from them and from the other collectors.
+type Batch struct {
+	Time       time.Time
+	Host       string
+	Client     string
+	Disks      []diskinfo.DiskInfo
+	Points     []Point
+	Collectors []CollectorStatus
+}
+
+// Sink is an output receiving every collection.
+type Sink interface {
+	Name() string
+	Write(ctx context.Context, batch Batch) error
+	Close() error
+}
+
+// WriteStats counts the outcome of the writes of a sink since it started.
+type WriteStats struct {
+	WrittenBatches int64
+	WrittenPoints  int64
+	FailedBatches  int64
+	FailedPoints   int64
+	DroppedBatches int64
+	DroppedPoints  int64
+	Retries        int64
+	Queued         int
+	LastSuccess    time.Time
+	LastError      string
+
+	Spooling            bool
+	SpooledBatches      int64
+	SpooledBytes        int64
+	SpoolDroppedBatches int64
+	SpoolDroppedBytes   int64
+}
+
+// StatsReporter is implemented by the sinks that report their write outcomes.
+type StatsReporter interface {
+	Stats() WriteStats
+}
+
+// NewSinks builds the sinks listed in the configuration.
+func NewSinks(config *appconfig.AppConfig) ([]Sink, error) {
+	var sinks []Sink
+	for _, sinkConfig := range config.SinkConfigs() {
+		sink, err := newSink(sinkConfig, config.InfluxTags)
+		if err != nil {
+			for _, created := range sinks {
+				created.Close()
+			}
+			return nil, fmt.Errorf("failed to create sink %q: %w", sinkConfig.Name, err)
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+func newSink(config appconfig.SinkConfig, tags appconfig.InfluxTagsConfig) (Sink, error) {
+	switch config.Type {
+	case appconfig.SinkInfluxDB:
+		return NewInfluxSink(config)
+	case appconfig.SinkInfluxDBV1:
+		return NewInfluxV1Sink(config)
+	case appconfig.SinkLineProtocol:
+		return NewLineProtocolSink(config)
+	case appconfig.SinkOTLP:
+		return NewOTLPSink(config)
+	case appconfig.SinkMQTT:
+		return NewMQTTSink(config, tags)
+	case appconfig.SinkPrometheus:
+		return NewPrometheusSink(config)
+	case appconfig.SinkHistory:
+		return NewHistorySink(config)
+	default:
+		return nil, fmt.Errorf("unknown sink type %q", config.Type)
+	}
+}
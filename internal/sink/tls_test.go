@@ -0,0 +1,196 @@
+package sink
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"gama-client/internal/appconfig"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testPKI is a CA and the server and client certificates it signed. The CA
+// and the client certificate are also written to PEM files.
+type testPKI struct {
+	pool     *x509.CertPool
+	server   tls.Certificate
+	caFile   string
+	certFile string
+	keyFile  string
+}
+
+func newTestPKI(t *testing.T) testPKI {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issue := func(serial int64, name string, usage x509.ExtKeyUsage) (tls.Certificate, []byte, []byte) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certificate := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+		return certificate, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	}
+	server, _, _ := issue(2, "influxdb", x509.ExtKeyUsageServerAuth)
+	_, clientPEM, clientKeyPEM := issue(3, "agent", x509.ExtKeyUsageClientAuth)
+
+	dir := t.TempDir()
+	pki := testPKI{
+		pool:     x509.NewCertPool(),
+		server:   server,
+		caFile:   filepath.Join(dir, "ca.pem"),
+		certFile: filepath.Join(dir, "client.pem"),
+		keyFile:  filepath.Join(dir, "client-key.pem"),
+	}
+	pki.pool.AddCert(ca)
+	files := map[string][]byte{
+		pki.caFile:   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+		pki.certFile: clientPEM,
+		pki.keyFile:  clientKeyPEM,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return pki
+}
+
+// v1Writer returns the writer of an InfluxDB 1.x sink.
+func v1Writer(t *testing.T, url string, options appconfig.InfluxOptions) lineWriter {
+	t.Helper()
+	output, err := NewInfluxV1Sink(appconfig.SinkConfig{
+		Name:           "influxdb",
+		InfluxConfig:   appconfig.InfluxConfig{InfluxURL: url, InfluxOptions: options},
+		InfluxV1Config: appconfig.InfluxV1Config{InfluxDatabase: "smp"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { output.Close() })
+	return output.writer
+}
+
+func TestInfluxClientCertificate(t *testing.T) {
+	pki := newTestPKI(t)
+	lines := make(chan string, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		lines <- string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{pki.server}, ClientCAs: pki.pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	// The rejected handshakes are expected.
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		options appconfig.InfluxOptions
+		wantErr bool
+	}{
+		{name: "client certificate", options: appconfig.InfluxOptions{CAFile: pki.caFile, CertFile: pki.certFile, KeyFile: pki.keyFile}},
+		{name: "without client certificate", options: appconfig.InfluxOptions{CAFile: pki.caFile}, wantErr: true},
+		{name: "without CA", options: appconfig.InfluxOptions{CertFile: pki.certFile, KeyFile: pki.keyFile}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := v1Writer(t, server.URL, test.options).WriteLines(context.Background(), testBatchLine)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got %v, want error %v", err, test.wantErr)
+			}
+			if err == nil {
+				if got := <-lines; got != testBatchLine {
+					t.Errorf("got %q, want %q", got, testBatchLine)
+				}
+			}
+		})
+	}
+}
+
+func TestInfluxProxy(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer proxy.Close()
+
+	// The server is never reached, only the proxy answers.
+	writer := v1Writer(t, "http://influxdb.invalid:8086", appconfig.InfluxOptions{ProxyURL: proxy.URL})
+	if err := writer.WriteLines(context.Background(), testBatchLine); err != nil {
+		t.Fatal(err)
+	}
+	request := <-requests
+	if request.URL.Host != "influxdb.invalid:8086" || request.URL.Path != "/write" || request.URL.Query().Get("db") != "smp" {
+		t.Errorf("proxy got %s", request.URL)
+	}
+}
+
+func TestNewTLSConfigErrors(t *testing.T) {
+	pki := newTestPKI(t)
+	tests := []struct {
+		name                      string
+		caFile, certFile, keyFile string
+	}{
+		{name: "missing CA", caFile: filepath.Join(t.TempDir(), "missing.pem")},
+		{name: "CA without certificates", caFile: pki.keyFile},
+		{name: "key of another certificate", certFile: pki.certFile, keyFile: pki.caFile},
+	}
+	for _, test := range tests {
+		if _, err := newTLSConfig(test.caFile, test.certFile, test.keyFile, false); err == nil {
+			t.Errorf("%s: got no error", test.name)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package spool
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	fileSuffix = ".lp"
+	tempSuffix = ".tmp"
+)
+
+// Spool is an append-only queue of batches stored one per file in a
+// directory. Files are written to a temporary name, synced and renamed, so a
+// crash leaves either the whole batch or nothing. The file names carry a
+// sequence number, which keeps the replay order across restarts, and the time
+// the batch was spooled.
+type Spool struct {
+	dir      string
+	maxBytes int64
+	maxAge   time.Duration
+
+	mu      sync.Mutex
+	entries []entry
+	bytes   int64
+	nextSeq uint64
+	dropped Stats
+}
+
+type entry struct {
+	name    string
+	seq     uint64
+	created time.Time
+	size    int64
+}
+
+// Stats reports the batches waiting in the spool, or, for the dropped
+// counters, those discarded by the size and age limits.
+type Stats struct {
+	Batches int64
+	Bytes   int64
+}
+
+// Open loads the batches left in dir by a previous run. A maxBytes or maxAge of
+// zero disables that limit.
+func Open(dir string, maxBytes int64, maxAge time.Duration) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool directory: %w", err)
+	}
+	s := &Spool{dir: dir, maxBytes: maxBytes, maxAge: maxAge}
+	for _, file := range files {
+		name := file.Name()
+		if strings.HasSuffix(name, tempSuffix) {
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		e, ok := parseName(name)
+		if !ok {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		e.size = info.Size()
+		s.entries = append(s.entries, e)
+		s.bytes += e.size
+	}
+	sort.Slice(s.entries, func(i, j int) bool { return s.entries[i].seq < s.entries[j].seq })
+	if len(s.entries) > 0 {
+		s.nextSeq = s.entries[len(s.entries)-1].seq + 1
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enforceLimits()
+	return s, nil
+}
+
+func parseName(name string) (entry, bool) {
+	base, ok := strings.CutSuffix(name, fileSuffix)
+	if !ok {
+		return entry{}, false
+	}
+	seqPart, timePart, ok := strings.Cut(base, "-")
+	if !ok {
+		return entry{}, false
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return entry{}, false
+	}
+	nanos, err := strconv.ParseInt(timePart, 10, 64)
+	if err != nil {
+		return entry{}, false
+	}
+	return entry{name: name, seq: seq, created: time.Unix(0, nanos)}, true
+}
+
+// Append stores a batch at the end of the spool, then drops the oldest
+// batches beyond the limits.
+func (s *Spool) Append(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	e := entry{
+		name:    fmt.Sprintf("%020d-%d%s", s.nextSeq, now.UnixNano(), fileSuffix),
+		seq:     s.nextSeq,
+		created: now,
+		size:    int64(len(data)),
+	}
+	if err := s.writeFile(e.name, data); err != nil {
+		return err
+	}
+	s.nextSeq++
+	s.entries = append(s.entries, e)
+	s.bytes += e.size
+	s.enforceLimits()
+	return nil
+}
+
+func (s *Spool) writeFile(name string, data []byte) error {
+	temp := filepath.Join(s.dir, name+tempSuffix)
+	file, err := os.OpenFile(temp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create spool file: %w", err)
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp, filepath.Join(s.dir, name))
+	}
+	if err != nil {
+		os.Remove(temp)
+		return fmt.Errorf("failed to write spool file: %w", err)
+	}
+	syncDir(s.dir)
+	return nil
+}
+
+// syncDir persists the rename. Directories cannot be synced on every platform,
+// so failures are ignored.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// enforceLimits drops the oldest batches until the spool fits in maxBytes and
+// holds nothing older than maxAge. The caller holds the lock.
+func (s *Spool) enforceLimits() {
+	cutoff := time.Now().Add(-s.maxAge)
+	for len(s.entries) > 0 {
+		oldest := s.entries[0]
+		overSize := s.maxBytes > 0 && s.bytes > s.maxBytes
+		expired := s.maxAge > 0 && oldest.created.Before(cutoff)
+		if !overSize && !expired {
+			return
+		}
+		s.dropped.Batches++
+		s.dropped.Bytes += oldest.size
+		s.removeOldest()
+	}
+}
+
+func (s *Spool) removeOldest() {
+	oldest := s.entries[0]
+	os.Remove(filepath.Join(s.dir, oldest.name))
+	s.entries = s.entries[1:]
+	s.bytes -= oldest.size
+}
+
+// Oldest returns the first batch to replay. ok is false when the spool is
+// empty. A batch that cannot be read is dropped and the next one returned.
+func (s *Spool) Oldest() (data []byte, ok bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enforceLimits()
+	for len(s.entries) > 0 {
+		oldest := s.entries[0]
+		data, err := os.ReadFile(filepath.Join(s.dir, oldest.name))
+		if err == nil {
+			return data, true, nil
+		}
+		s.dropped.Batches++
+		s.dropped.Bytes += oldest.size
+		s.removeOldest()
+		if !os.IsNotExist(err) {
+			return nil, false, fmt.Errorf("failed to read spool file %s: %w", oldest.name, err)
+		}
+	}
+	return nil, false, nil
+}
+
+// Remove deletes the batch returned by Oldest once it was delivered.
+func (s *Spool) Remove() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.entries) > 0 {
+		s.removeOldest()
+	}
+}
+
+// Len returns the number of spooled batches.
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// Stats returns the spooled batches and those dropped by the limits since the
+// spool was opened.
+func (s *Spool) Stats() (spooled, dropped Stats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{Batches: int64(len(s.entries)), Bytes: s.bytes}, s.dropped
+}
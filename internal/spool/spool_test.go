@@ -0,0 +1,161 @@
+package spool
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func open(t *testing.T, dir string, maxBytes int64, maxAge time.Duration) *Spool {
+	t.Helper()
+	s, err := Open(dir, maxBytes, maxAge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func appendAll(t *testing.T, s *Spool, batches ...string) {
+	t.Helper()
+	for _, batch := range batches {
+		if err := s.Append([]byte(batch)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// drain replays the spool, returning the batches in order.
+func drain(t *testing.T, s *Spool) []string {
+	t.Helper()
+	var batches []string
+	for {
+		data, ok, err := s.Oldest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			return batches
+		}
+		batches = append(batches, string(data))
+		s.Remove()
+	}
+}
+
+func equal(got, want []string) bool {
+	return fmt.Sprint(got) == fmt.Sprint(want)
+}
+
+func TestSpoolOrderAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+	s := open(t, dir, 0, 0)
+	appendAll(t, s, "a", "b", "c")
+	data, ok, err := s.Oldest()
+	if err != nil || !ok || string(data) != "a" {
+		t.Fatalf("got %q, %v, %v", data, ok, err)
+	}
+	s.Remove()
+
+	reopened := open(t, dir, 0, 0)
+	if reopened.Len() != 2 {
+		t.Fatalf("got %d batches after reopening, want 2", reopened.Len())
+	}
+	appendAll(t, reopened, "d")
+	if got, want := drain(t, reopened), []string{"b", "c", "d"}; !equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if spooled, _ := reopened.Stats(); spooled != (Stats{}) {
+		t.Errorf("got %+v for an empty spool", spooled)
+	}
+}
+
+func TestSpoolRemovesTemporaryFiles(t *testing.T) {
+	dir := t.TempDir()
+	appendAll(t, open(t, dir, 0, 0), "a")
+	// A crash in the middle of a write leaves a temporary file behind.
+	partial := filepath.Join(dir, fmt.Sprintf("%020d-%d%s%s", 1, time.Now().UnixNano(), fileSuffix, tempSuffix))
+	if err := os.WriteFile(partial, []byte("par"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("not a batch"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := open(t, dir, 0, 0)
+	if _, err := os.Stat(partial); !os.IsNotExist(err) {
+		t.Errorf("temporary file left: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "README")); err != nil {
+		t.Errorf("unrelated file removed: %v", err)
+	}
+	if got := drain(t, s); !equal(got, []string{"a"}) {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestSpoolDropsOldestBeyondSize(t *testing.T) {
+	s := open(t, t.TempDir(), 10, 0)
+	appendAll(t, s, "aaaa", "bbbb", "cccc")
+	spooled, dropped := s.Stats()
+	if spooled != (Stats{Batches: 2, Bytes: 8}) || dropped != (Stats{Batches: 1, Bytes: 4}) {
+		t.Errorf("got spooled %+v and dropped %+v", spooled, dropped)
+	}
+	if got := drain(t, s); !equal(got, []string{"bbbb", "cccc"}) {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestSpoolDropsExpiredBatches(t *testing.T) {
+	dir := t.TempDir()
+	old := fmt.Sprintf("%020d-%d%s", 0, time.Now().Add(-2*time.Hour).UnixNano(), fileSuffix)
+	if err := os.WriteFile(filepath.Join(dir, old), []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s := open(t, dir, 0, time.Hour)
+	if _, err := os.Stat(filepath.Join(dir, old)); !os.IsNotExist(err) {
+		t.Errorf("expired batch left: %v", err)
+	}
+	appendAll(t, s, "new")
+	if got := drain(t, s); !equal(got, []string{"new"}) {
+		t.Errorf("got %q", got)
+	}
+	if _, dropped := s.Stats(); dropped != (Stats{Batches: 1, Bytes: 3}) {
+		t.Errorf("got dropped %+v", dropped)
+	}
+
+	// Batches expire while waiting for the replay too.
+	s.maxAge = time.Millisecond
+	appendAll(t, s, "late")
+	time.Sleep(5 * time.Millisecond)
+	if data, ok, err := s.Oldest(); ok || err != nil {
+		t.Errorf("got %q, %v, %v for an expired batch", data, ok, err)
+	}
+}
+
+func TestSpoolOldestDropsUnreadableFiles(t *testing.T) {
+	dir := t.TempDir()
+	s := open(t, dir, 0, 0)
+	appendAll(t, s, "a", "b", "c")
+	// The first batch was deleted and the second one cannot be read.
+	if err := os.Remove(filepath.Join(dir, s.entries[0].name)); err != nil {
+		t.Fatal(err)
+	}
+	second := filepath.Join(dir, s.entries[1].name)
+	if err := os.Remove(second); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(second, 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, err := s.Oldest(); ok || err == nil {
+		t.Errorf("got %v, %v, want the error of the unreadable batch", ok, err)
+	}
+	if got := drain(t, s); !equal(got, []string{"c"}) {
+		t.Errorf("got %q, want the batch after the unreadable ones", got)
+	}
+	if _, dropped := s.Stats(); dropped.Batches != 2 {
+		t.Errorf("got %d dropped batches, want 2", dropped.Batches)
+	}
+}
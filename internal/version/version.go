@@ -0,0 +1,5 @@
+package version
+
+// Version is the release of the agent, set at build time with
+// -ldflags "-X gama-client/internal/version.Version=<version>".
+var Version = "dev"
@@ -0,0 +1,370 @@
+package zfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"gama-client/internal/cmdrunner"
+	"gama-client/internal/diskinfo"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type Vdev struct {
+	Name string
+	// Depth is the indentation level below the pool, 1 for top-level vdevs.
+	Depth int
+	// Section is empty for data vdevs, otherwise logs, cache, spares or special.
+	Section        string
+	State          string
+	ReadErrors     uint64
+	WriteErrors    uint64
+	ChecksumErrors uint64
+	Message        string
+	Leaf           bool
+	DeviceName     string
+	DiskName       string
+}
+
+func (v Vdev) Status() (diskinfo.StatusType, string) {
+	switch v.State {
+	case "FAULTED", "UNAVAIL", "REMOVED":
+		return diskinfo.StatusError, fmt.Sprintf("ZFS vdev %s is %s", v.Name, v.State)
+	case "DEGRADED", "OFFLINE":
+		return diskinfo.StatusWarning, fmt.Sprintf("ZFS vdev %s is %s", v.Name, v.State)
+	}
+	if v.ReadErrors+v.WriteErrors+v.ChecksumErrors > 0 {
+		return diskinfo.StatusWarning, fmt.Sprintf("ZFS vdev %s has errors (read %d, write %d, checksum %d)",
+			v.Name, v.ReadErrors, v.WriteErrors, v.ChecksumErrors)
+	}
+	return diskinfo.StatusSafe, "All checks passed"
+}
+
+type Pool struct {
+	Name          string
+	State         string
+	Size          uint64
+	Allocated     uint64
+	Free          uint64
+	Fragmentation float64
+	Capacity      float64
+	// ScanFunction is scrub or resilver, empty when no scan was ever requested.
+	ScanFunction string
+	// ScanState is finished, in_progress, canceled or none.
+	ScanState    string
+	ScanProgress float64
+	ScanErrors   int
+	DataErrors   string
+	Vdevs        []Vdev
+}
+
+func (p Pool) ErrorTotals() (read, write, checksum uint64) {
+	for _, vdev := range p.Vdevs {
+		if vdev.Depth == 0 {
+			return vdev.ReadErrors, vdev.WriteErrors, vdev.ChecksumErrors
+		}
+	}
+	return 0, 0, 0
+}
+
+func (p Pool) Status() (diskinfo.StatusType, string) {
+	if p.State != "ONLINE" {
+		return diskinfo.StatusError, fmt.Sprintf("ZFS pool %s is %s", p.Name, p.State)
+	}
+	if read, write, checksum := p.ErrorTotals(); read+write+checksum > 0 {
+		return diskinfo.StatusWarning, fmt.Sprintf("ZFS pool %s has errors (read %d, write %d, checksum %d)", p.Name, read, write, checksum)
+	}
+	if p.ScanErrors > 0 {
+		return diskinfo.StatusWarning, fmt.Sprintf("ZFS pool %s last %s found %d errors", p.Name, p.ScanFunction, p.ScanErrors)
+	}
+	if p.Capacity >= 90 {
+		return diskinfo.StatusWarning, fmt.Sprintf("ZFS pool %s capacity exceeds 90%%", p.Name)
+	}
+	return diskinfo.StatusSafe, "All checks passed"
+}
+
+func (p Pool) StatusToInt() int {
+	status, _ := p.Status()
+	return diskinfo.DiskInfo{Status: status}.StatusToInt()
+}
+
+// Collector runs zpool through a cmdrunner.Runner so the parsing can be fed
+// with captured output.
+type Collector struct {
+	ctx     context.Context
+	runner  cmdrunner.Runner
+	sysRoot string
+	// resolve turns the vdev path printed by zpool into the kernel device.
+	resolve func(path string) (string, error)
+}
+
+func NewCollector(ctx context.Context, runner cmdrunner.Runner) *Collector {
+	return &Collector{ctx: ctx, runner: runner, sysRoot: diskinfo.DefaultSysRoot, resolve: filepath.EvalSymlinks}
+}
+
+// Collect returns no pools when the ZFS tools are not installed.
+func (c *Collector) Collect() ([]Pool, error) {
+	listOutput, err := c.runner.Run(c.ctx, "zpool", "list", "-Hp", "-o", "name,size,allocated,free,fragmentation,capacity,health")
+	if err != nil {
+		if cmdrunner.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to run zpool list: %w", err)
+	}
+	pools, err := ParseList(listOutput)
+	if err != nil {
+		return nil, err
+	}
+	if len(pools) == 0 {
+		return nil, nil
+	}
+
+	statusOutput, err := c.runner.Run(c.ctx, "zpool", "status", "-p", "-P")
+	if err != nil {
+		return nil, fmt.Errorf("failed to run zpool status: %w", err)
+	}
+	statuses, err := ParseStatus(statusOutput)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pools {
+		status, ok := statuses[pools[i].Name]
+		if !ok {
+			continue
+		}
+		pools[i].State = status.State
+		pools[i].ScanFunction = status.ScanFunction
+		pools[i].ScanState = status.ScanState
+		pools[i].ScanProgress = status.ScanProgress
+		pools[i].ScanErrors = status.ScanErrors
+		pools[i].DataErrors = status.DataErrors
+		pools[i].Vdevs = status.Vdevs
+		c.resolveDevices(&pools[i])
+	}
+	return pools, nil
+}
+
+func (c *Collector) resolveDevices(pool *Pool) {
+	for i := range pool.Vdevs {
+		vdev := &pool.Vdevs[i]
+		if !vdev.Leaf || !strings.HasPrefix(vdev.Name, "/dev/") {
+			continue
+		}
+		device := vdev.Name
+		if resolved, err := c.resolve(device); err == nil {
+			device = resolved
+		}
+		vdev.DeviceName = device
+		vdev.DiskName = diskinfo.ParentDevice(c.sysRoot, device)
+	}
+}
+
+// ParseList parses the output of `zpool list -Hp -o name,size,allocated,free,fragmentation,capacity,health`.
+func ParseList(output []byte) ([]Pool, error) {
+	var pools []Pool
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 7 {
+			return nil, fmt.Errorf("unexpected zpool list line: %q", line)
+		}
+		pools = append(pools, Pool{
+			Name:          fields[0],
+			Size:          parseUint(fields[1]),
+			Allocated:     parseUint(fields[2]),
+			Free:          parseUint(fields[3]),
+			Fragmentation: parseFloat(fields[4]),
+			Capacity:      parseFloat(fields[5]),
+			State:         fields[6],
+			ScanState:     "none",
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read zpool list output: %w", err)
+	}
+	return pools, nil
+}
+
+var (
+	scanErrors   = regexp.MustCompile(`with (\d+) errors`)
+	scanProgress = regexp.MustCompile(`([\d.]+)% done`)
+)
+
+// ParseStatus parses the output of `zpool status -p` into pools keyed by name.
+// Only the state, scan and config sections are filled in.
+func ParseStatus(output []byte) (map[string]Pool, error) {
+	pools := make(map[string]Pool)
+	var current *Pool
+	var inConfig, inScan bool
+	var section string
+	flush := func() {
+		if current != nil {
+			markLeaves(current.Vdevs)
+			pools[current.Name] = *current
+		}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		key, value, isKey := strings.Cut(trimmed, ":")
+		if isKey && !strings.HasPrefix(line, "\t") && !strings.Contains(key, " ") {
+			inScan = false
+			value = strings.TrimSpace(value)
+			switch key {
+			case "pool":
+				flush()
+				current = &Pool{Name: value, ScanState: "none"}
+				inConfig = false
+				continue
+			case "state":
+				if current != nil {
+					current.State = value
+				}
+				continue
+			case "scan":
+				if current != nil {
+					parseScan(current, value)
+					inScan = true
+				}
+				continue
+			case "config":
+				inConfig = true
+				section = ""
+				continue
+			case "errors":
+				inConfig = false
+				if current != nil {
+					current.DataErrors = value
+				}
+				continue
+			}
+		}
+		if current == nil || trimmed == "" {
+			continue
+		}
+		if inScan && !inConfig {
+			parseScan(current, trimmed)
+			continue
+		}
+		if !inConfig {
+			continue
+		}
+		fields := strings.Fields(trimmed)
+		if fields[0] == "NAME" {
+			continue
+		}
+		depth := indentDepth(line)
+		if depth == 0 && fields[0] != current.Name {
+			section = fields[0]
+			continue
+		}
+		vdev := Vdev{Name: fields[0], Depth: depth, Section: section}
+		if len(fields) > 1 {
+			vdev.State = fields[1]
+		}
+		if len(fields) > 4 {
+			vdev.ReadErrors = parseUint(fields[2])
+			vdev.WriteErrors = parseUint(fields[3])
+			vdev.ChecksumErrors = parseUint(fields[4])
+			vdev.Message = strings.Join(fields[5:], " ")
+		}
+		current.Vdevs = append(current.Vdevs, vdev)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read zpool status output: %w", err)
+	}
+	flush()
+	return pools, nil
+}
+
+// markLeaves flags the vdevs without children, which are the actual devices.
+func markLeaves(vdevs []Vdev) {
+	for i := range vdevs {
+		if vdevs[i].Depth == 0 {
+			continue
+		}
+		last := i == len(vdevs)-1
+		vdevs[i].Leaf = last || vdevs[i+1].Depth <= vdevs[i].Depth || vdevs[i+1].Section != vdevs[i].Section
+	}
+}
+
+func parseScan(pool *Pool, value string) {
+	switch {
+	case strings.HasPrefix(value, "none requested"):
+		pool.ScanState = "none"
+	case strings.HasPrefix(value, "scrub"):
+		pool.ScanFunction = "scrub"
+	case strings.HasPrefix(value, "resilver"):
+		pool.ScanFunction = "resilver"
+	}
+	switch {
+	case strings.Contains(value, "in progress"):
+		pool.ScanState = "in_progress"
+	case strings.Contains(value, "canceled"):
+		pool.ScanState = "canceled"
+	case scanErrors.MatchString(value):
+		pool.ScanState = "finished"
+		pool.ScanProgress = 100
+	}
+	if match := scanErrors.FindStringSubmatch(value); match != nil {
+		pool.ScanErrors, _ = strconv.Atoi(match[1])
+	}
+	if match := scanProgress.FindStringSubmatch(value); match != nil {
+		pool.ScanProgress = parseFloat(match[1])
+	}
+}
+
+// indentDepth converts the two-space indentation of the config section, which
+// starts after a tab, into the vdev depth.
+func indentDepth(line string) int {
+	line = strings.TrimPrefix(line, "\t")
+	spaces := len(line) - len(strings.TrimLeft(line, " "))
+	return spaces / 2
+}
+
+// ApplyToDisks escalates the disks backing a degraded or faulted vdev, and the
+// disks of a pool that is not healthy.
+func ApplyToDisks(disks []diskinfo.DiskInfo, pools []Pool) {
+	for _, pool := range pools {
+		poolStatus, poolCondition := pool.Status()
+		for _, vdev := range pool.Vdevs {
+			if !vdev.Leaf || vdev.DeviceName == "" {
+				continue
+			}
+			status, condition := vdev.Status()
+			for i := range disks {
+				if disks[i].DeviceName == vdev.DeviceName || disks[i].DeviceName == vdev.DiskName {
+					disks[i].Escalate(status, diskinfo.CheckZFS, condition)
+					if poolStatus == diskinfo.StatusError {
+						disks[i].Escalate(diskinfo.StatusWarning, diskinfo.CheckZFS, poolCondition)
+					}
+				}
+			}
+		}
+	}
+}
+
+func parseUint(value string) uint64 {
+	parsed, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return parsed
+}
+
+func parseFloat(value string) float64 {
+	parsed, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil {
+		return 0
+	}
+	return parsed
+}
@@ -0,0 +1,245 @@
+package zfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gama-client/internal/cmdrunner"
+	"gama-client/internal/diskinfo"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const byID = "/dev/disk/by-id/ata-WDC_WD40EFRX-68N32N0_WD-WCC7K"
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func vdevByName(t *testing.T, pool Pool, name string) Vdev {
+	t.Helper()
+	for _, vdev := range pool.Vdevs {
+		if vdev.Name == name {
+			return vdev
+		}
+	}
+	t.Fatalf("vdev %s not found in pool %s", name, pool.Name)
+	return Vdev{}
+}
+
+func TestParseList(t *testing.T) {
+	pools, err := ParseList(readFixture(t, "zpool_list.txt"))
+	if err != nil {
+		t.Fatalf("ParseList: %v", err)
+	}
+	if len(pools) != 2 {
+		t.Fatalf("got %d pools, want 2", len(pools))
+	}
+	tank := pools[0]
+	if tank.Name != "tank" || tank.Size != 15994458210304 || tank.Allocated != 4105375956992 || tank.Free != 11889082253312 ||
+		tank.Fragmentation != 3 || tank.Capacity != 25 || tank.State != "DEGRADED" || tank.ScanState != "none" {
+		t.Errorf("got %+v", tank)
+	}
+	if rpool := pools[1]; rpool.Capacity != 92 || rpool.State != "ONLINE" {
+		t.Errorf("got %+v", rpool)
+	}
+
+	if _, err := ParseList([]byte("tank\t100\t50\n")); err == nil {
+		t.Error("expected an error for a short line")
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	pools, err := ParseStatus(readFixture(t, "zpool_status.txt"))
+	if err != nil {
+		t.Fatalf("ParseStatus: %v", err)
+	}
+	if len(pools) != 2 {
+		t.Fatalf("got %d pools, want 2", len(pools))
+	}
+
+	tank := pools["tank"]
+	if tank.State != "DEGRADED" || tank.ScanFunction != "resilver" || tank.ScanState != "in_progress" || tank.ScanProgress != 16.81 {
+		t.Errorf("tank: got state %s, scan %s %s %g", tank.State, tank.ScanFunction, tank.ScanState, tank.ScanProgress)
+	}
+	if tank.DataErrors != "No known data errors" {
+		t.Errorf("tank: got data errors %q", tank.DataErrors)
+	}
+	if len(tank.Vdevs) != 13 {
+		t.Fatalf("tank: got %d vdevs, want 13", len(tank.Vdevs))
+	}
+	unavailable := vdevByName(t, tank, byID+"3-part1")
+	if unavailable.State != "UNAVAIL" || unavailable.Depth != 3 || unavailable.Message != "was "+byID+"3-part1" {
+		t.Errorf("got %+v", unavailable)
+	}
+	if vdev := vdevByName(t, tank, byID+"2-part1"); vdev.ChecksumErrors != 2 {
+		t.Errorf("got %+v", vdev)
+	}
+
+	rpool := pools["rpool"]
+	if rpool.ScanFunction != "scrub" || rpool.ScanState != "finished" || rpool.ScanProgress != 100 || rpool.ScanErrors != 3 {
+		t.Errorf("rpool: got scan %s %s %g with %d errors", rpool.ScanFunction, rpool.ScanState, rpool.ScanProgress, rpool.ScanErrors)
+	}
+}
+
+func TestParseStatusMarksLeaves(t *testing.T) {
+	pools, err := ParseStatus(readFixture(t, "zpool_status.txt"))
+	if err != nil {
+		t.Fatalf("ParseStatus: %v", err)
+	}
+	tests := []struct {
+		name    string
+		section string
+		leaf    bool
+	}{
+		{"tank", "", false},
+		{"raidz2-0", "", false},
+		{byID + "1-part1", "", true},
+		{"replacing-2", "", false},
+		{byID + "3-part1", "", true},
+		{byID + "5-part1", "", true},
+		{byID + "4-part1", "", true},
+		{"mirror-1", "logs", false},
+		{"/dev/nvme0n1p1", "logs", true},
+		{"/dev/nvme1n1p1", "logs", true},
+		{"/dev/nvme0n1p2", "cache", true},
+		{byID + "6-part1", "spares", true},
+	}
+	for _, test := range tests {
+		vdev := vdevByName(t, pools["tank"], test.name)
+		if vdev.Section != test.section || vdev.Leaf != test.leaf {
+			t.Errorf("%s: got section %q leaf %v, want %q %v", test.name, vdev.Section, vdev.Leaf, test.section, test.leaf)
+		}
+	}
+	if spare := vdevByName(t, pools["tank"], byID+"6-part1"); spare.State != "AVAIL" {
+		t.Errorf("got spare state %q", spare.State)
+	}
+}
+
+func TestPoolStatus(t *testing.T) {
+	pools, err := ParseStatus(readFixture(t, "zpool_status.txt"))
+	if err != nil {
+		t.Fatalf("ParseStatus: %v", err)
+	}
+	if status, condition := pools["tank"].Status(); status != diskinfo.StatusError || condition != "ZFS pool tank is DEGRADED" {
+		t.Errorf("tank: got %s %q", status, condition)
+	}
+	if status, condition := pools["rpool"].Status(); status != diskinfo.StatusWarning || condition != "ZFS pool rpool last scrub found 3 errors" {
+		t.Errorf("rpool: got %s %q", status, condition)
+	}
+	full := Pool{Name: "backup", State: "ONLINE", Capacity: 95}
+	if status, condition := full.Status(); status != diskinfo.StatusWarning || condition != "ZFS pool backup capacity exceeds 90%" {
+		t.Errorf("backup: got %s %q", status, condition)
+	}
+}
+
+// fixtureCollector runs zpool against the captured outputs and resolves the
+// by-id links of the fixture to sd devices.
+func fixtureCollector(t *testing.T) *Collector {
+	runner := cmdrunner.RunnerFunc(func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		switch args[0] {
+		case "list":
+			return readFixture(t, "zpool_list.txt"), nil
+		case "status":
+			return readFixture(t, "zpool_status.txt"), nil
+		}
+		return nil, fmt.Errorf("unexpected command %s %s", name, strings.Join(args, " "))
+	})
+	links := map[string]string{
+		byID + "1-part1": "/dev/sdc1",
+		byID + "2-part1": "/dev/sdd1",
+		byID + "4-part1": "/dev/sdf1",
+		byID + "5-part1": "/dev/sdg1",
+		byID + "6-part1": "/dev/sdh1",
+	}
+	resolve := func(path string) (string, error) {
+		if target, ok := links[path]; ok {
+			return target, nil
+		}
+		if strings.HasPrefix(path, "/dev/disk/") {
+			return "", os.ErrNotExist
+		}
+		return path, nil
+	}
+	return &Collector{ctx: context.Background(), runner: runner, resolve: resolve}
+}
+
+func TestCollectorResolvesDevices(t *testing.T) {
+	pools, err := fixtureCollector(t).Collect()
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	if len(pools) != 2 || pools[0].Name != "tank" {
+		t.Fatalf("got %+v", pools)
+	}
+	tank := pools[0]
+	if tank.ScanFunction != "resilver" || len(tank.Vdevs) != 13 {
+		t.Errorf("status not merged into the listed pool: %+v", tank)
+	}
+	if vdev := vdevByName(t, tank, byID+"2-part1"); vdev.DeviceName != "/dev/sdd1" || vdev.DiskName != "/dev/sdd" {
+		t.Errorf("got %+v", vdev)
+	}
+	if vdev := vdevByName(t, tank, "/dev/nvme1n1p1"); vdev.DiskName != "/dev/nvme1n1" {
+		t.Errorf("got %+v", vdev)
+	}
+	if vdev := vdevByName(t, tank, "raidz2-0"); vdev.DeviceName != "" {
+		t.Errorf("interior vdev resolved to %s", vdev.DeviceName)
+	}
+}
+
+func TestCollectorWithoutZFS(t *testing.T) {
+	runner := cmdrunner.RunnerFunc(func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		return nil, &exec.Error{Name: name, Err: exec.ErrNotFound}
+	})
+	pools, err := NewCollector(context.Background(), runner).Collect()
+	if pools != nil || err != nil {
+		t.Errorf("got %v, %v", pools, err)
+	}
+
+	runner = cmdrunner.RunnerFunc(func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		return nil, errors.New("permission denied")
+	})
+	if _, err := NewCollector(context.Background(), runner).Collect(); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestApplyToDisks(t *testing.T) {
+	pools, err := fixtureCollector(t).Collect()
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	devices := []string{"/dev/sdc", "/dev/sdd", "/dev/sdh", "/dev/sda", "/dev/nvme0n1"}
+	disks := make([]diskinfo.DiskInfo, len(devices))
+	for i, device := range devices {
+		disks[i] = diskinfo.DiskInfo{Status: diskinfo.StatusSafe, Check: diskinfo.CheckOK, Condition: "All checks passed", DeviceName: device}
+	}
+	ApplyToDisks(disks, pools)
+
+	tests := []struct {
+		status    diskinfo.StatusType
+		check     string
+		condition string
+	}{
+		{diskinfo.StatusWarning, diskinfo.CheckZFS, "ZFS pool tank is DEGRADED"},
+		{diskinfo.StatusWarning, diskinfo.CheckZFS, "ZFS vdev " + byID + "2-part1 has errors (read 0, write 0, checksum 2)"},
+		{diskinfo.StatusWarning, diskinfo.CheckZFS, "ZFS pool tank is DEGRADED"},
+		// A pool in Warning does not escalate its healthy disks.
+		{diskinfo.StatusSafe, diskinfo.CheckOK, "All checks passed"},
+		{diskinfo.StatusWarning, diskinfo.CheckZFS, "ZFS pool tank is DEGRADED"},
+	}
+	for i, test := range tests {
+		disk := disks[i]
+		if disk.Status != test.status || disk.Check != test.check || disk.Condition != test.condition {
+			t.Errorf("%s: got %s %s %q, want %s %s %q", disk.DeviceName, disk.Status, disk.Check, disk.Condition, test.status, test.check, test.condition)
+		}
+	}
+}